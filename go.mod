@@ -1,15 +1,15 @@
 module github.com/jing332/tts-server-go
 
-go 1.19
+go 1.20
 
 require (
 	github.com/antonfisher/nested-logrus-formatter v1.3.1
 	github.com/gorilla/websocket v1.5.0
+	github.com/satori/go.uuid v1.2.0
 	github.com/sirupsen/logrus v1.9.0
 )
 
 require (
-	github.com/satori/go.uuid v1.2.0 // indirect
 	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 )
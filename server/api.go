@@ -10,29 +10,70 @@ import (
 	tts_server_go "github.com/jing332/tts-server-go"
 	"io"
 	"io/fs"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/gorilla/websocket"
+	"github.com/jing332/tts-server-go/config"
+	"github.com/jing332/tts-server-go/tts"
 	"github.com/jing332/tts-server-go/tts/azure"
+	"github.com/jing332/tts-server-go/tts/cache"
 	"github.com/jing332/tts-server-go/tts/creation"
 	"github.com/jing332/tts-server-go/tts/edge"
+	"github.com/jing332/tts-server-go/tts/lexicon"
+	"github.com/jing332/tts-server-go/tts/normalize"
+	"github.com/jing332/tts-server-go/tts/retry"
+	"github.com/jing332/tts-server-go/tts/ssml"
+	"github.com/jing332/tts-server-go/tts/subtitle"
 	log "github.com/sirupsen/logrus"
 )
 
 type GracefulServer struct {
 	Token      string
 	UseDnsEdge bool
+	PoolSize   int // Edge, Azure 每个引擎的最大WebSocket连接数
 
 	Server       *http.Server
 	serveMux     *http.ServeMux
 	shutdownLoad chan struct{}
 
-	edgeLock     sync.Mutex
-	azureLock    sync.Mutex
-	creationLock sync.Mutex
+	// Engines 已注册的TTS引擎，为空时使用内置的 Edge, Azure, Creation
+	Engines *tts.Registry
+
+	// Cache 音频缓存，为空时使用32MB内存缓存
+	Cache *cache.Cache
+
+	LegadoTimeout      time.Duration // 阅读网络导入接口超时, 默认15s
+	SynthesizeTimeout  time.Duration // 非流式合成接口超时, 默认30s
+	VoicesTimeout      time.Duration // 发音人列表接口超时, 默认30s
+	RetryAttempts      int           // 合成失败最多尝试次数, 默认3
+	RetryDelay         time.Duration // 首次重试间隔, 之后按指数退避加倍并加入随机抖动, 默认1s, 负数为不等待
+	RetryMaxDelay      time.Duration // 最大重试间隔, 默认30s
+	StreamStallTimeout time.Duration // 流式传输时客户端停止读取的最长时间, 超过时取消合成, 默认30s
+
+	// Breakers 各引擎的熔断器, 连续失败后暂停请求该引擎, 为空时使用默认设置
+	Breakers *retry.Breakers
+
+	// Profiles 发音人预设，请求参数 profile=名称 使用
+	Profiles map[string]*config.Profile
+
+	// Lexicon 全局读音与文本替换规则, 为空时创建空规则集
+	Lexicon *lexicon.Lexicon
+
+	// Failover 主引擎名称: 故障转移策略, 实际使用的引擎通过响应头 X-TTS-Engine 返回
+	Failover map[string]*config.Failover
+
+	JobWorkers   int           // 长文本任务的工作协程数, 即同时合成的任务数, 默认2
+	JobQueueSize int           // 排队任务的最大数量, 默认100
+	JobTTL       time.Duration // 已结束任务的保留时间, 默认1h
+
+	voices          voicesCache
+	jobs            jobQueue
+	profileLexicons sync.Map /* 预设名称: *lexicon.Lexicon */
 }
 
 //go:embed public/*
@@ -43,18 +84,86 @@ func (s *GracefulServer) HandleFunc() {
 	if s.serveMux == nil {
 		s.serveMux = &http.ServeMux{}
 	}
+	if s.Engines == nil {
+		s.Engines = tts.NewRegistry()
+		s.Engines.Register(tts.EngineEdge, &edge.Engine{DnsLookupEnabled: s.UseDnsEdge, DnsFallback: true, PoolSize: s.PoolSize})
+		s.Engines.Register(tts.EngineAzure, &azure.Engine{PoolSize: s.PoolSize})
+		s.Engines.Register(tts.EngineCreation, &creation.Engine{})
+	}
+	if s.Lexicon == nil {
+		s.Lexicon = &lexicon.Lexicon{}
+	}
+	if s.Cache == nil {
+		s.Cache = &cache.Cache{MaxSize: 32 << 20}
+	}
+	if s.Breakers == nil {
+		s.Breakers = &retry.Breakers{}
+	}
+	if s.JobWorkers <= 0 {
+		s.JobWorkers = 2
+	}
+	if s.JobQueueSize <= 0 {
+		s.JobQueueSize = 100
+	}
+	if s.JobTTL <= 0 {
+		s.JobTTL = time.Hour
+	}
+	if s.LegadoTimeout <= 0 {
+		s.LegadoTimeout = 15 * time.Second
+	}
+	if s.SynthesizeTimeout <= 0 {
+		s.SynthesizeTimeout = 30 * time.Second
+	}
+	if s.VoicesTimeout <= 0 {
+		s.VoicesTimeout = 30 * time.Second
+	}
+	if s.StreamStallTimeout <= 0 {
+		s.StreamStallTimeout = 30 * time.Second
+	}
+	if s.RetryAttempts <= 0 {
+		s.RetryAttempts = 3
+	}
+	if s.RetryDelay == 0 {
+		s.RetryDelay = time.Second
+	}
 
 	webFilesFs, _ := fs.Sub(webFiles, "public")
 	s.serveMux.Handle("/", http.FileServer(http.FS(webFilesFs)))
-	s.serveMux.Handle("/api/legado", http.TimeoutHandler(http.HandlerFunc(s.legadoAPIHandler), 15*time.Second, "timeout"))
+	s.serveMux.Handle("/api/legado", http.TimeoutHandler(http.HandlerFunc(s.legadoAPIHandler), s.LegadoTimeout, "timeout"))
+
+	s.serveMux.Handle("/api/azure", timeoutHandler(http.HandlerFunc(s.azureAPIHandler), s.SynthesizeTimeout))
+	s.serveMux.Handle("/api/azure/voices", http.TimeoutHandler(s.voicesAPIHandler(tts.EngineAzure), s.VoicesTimeout, "timeout"))
+
+	s.serveMux.Handle("/api/ra", timeoutHandler(http.HandlerFunc(s.edgeAPIHandler), s.SynthesizeTimeout))
+	s.serveMux.Handle("/api/ra/voices", http.TimeoutHandler(s.voicesAPIHandler(tts.EngineEdge), s.VoicesTimeout, "timeout"))
+
+	s.serveMux.Handle("/api/creation", timeoutHandler(http.HandlerFunc(s.creationAPIHandler), s.SynthesizeTimeout))
+	s.serveMux.Handle("/api/creation/voices", http.TimeoutHandler(s.voicesAPIHandler(tts.EngineCreation), s.VoicesTimeout, "timeout"))
+
+	s.serveMux.Handle("/api/tts", timeoutHandler(http.HandlerFunc(s.ttsAPIHandler), s.SynthesizeTimeout))
+
+	/* 多段合成由处理函数按段数控制超时 */
+	s.serveMux.HandleFunc("/api/dialogue", s.dialogueAPIHandler)
+
+	/* 长文本任务在后台合成, 不限时 */
+	s.serveMux.HandleFunc("/api/jobs", s.jobsAPIHandler)
+	s.serveMux.HandleFunc("/api/jobs/", s.jobAPIHandler)
 
-	s.serveMux.Handle("/api/azure", http.TimeoutHandler(http.HandlerFunc(s.azureAPIHandler), 30*time.Second, "timeout"))
-	s.serveMux.Handle("/api/azure/voices", http.TimeoutHandler(http.HandlerFunc(s.azureVoicesAPIHandler), 30*time.Second, "timeout"))
+	s.serveMux.Handle("/api/voices", http.TimeoutHandler(http.HandlerFunc(s.allVoicesAPIHandler), s.VoicesTimeout, "timeout"))
 
-	s.serveMux.Handle("/api/ra", http.TimeoutHandler(http.HandlerFunc(s.edgeAPIHandler), 30*time.Second, "timeout"))
+	s.serveMux.Handle("/v1/audio/speech", timeoutHandler(http.HandlerFunc(s.openAISpeechHandler), s.SynthesizeTimeout))
+	s.serveMux.HandleFunc("/v1/models", s.openAIModelsHandler)
 
-	s.serveMux.Handle("/api/creation", http.TimeoutHandler(http.HandlerFunc(s.creationAPIHandler), 30*time.Second, "timeout"))
-	s.serveMux.Handle("/api/creation/voices", http.TimeoutHandler(http.HandlerFunc(s.creationVoicesAPIHandler), 30*time.Second, "timeout"))
+	s.serveMux.Handle("/process", timeoutHandler(http.HandlerFunc(s.maryProcessHandler), s.SynthesizeTimeout))
+	s.serveMux.Handle("/voices", http.TimeoutHandler(http.HandlerFunc(s.maryVoicesHandler), s.VoicesTimeout, "timeout"))
+	s.serveMux.Handle("/locales", http.TimeoutHandler(http.HandlerFunc(s.maryLocalesHandler), s.VoicesTimeout, "timeout"))
+
+	s.serveMux.HandleFunc("/api/cache", s.cacheAPIHandler)
+	s.serveMux.HandleFunc("/api/profiles", s.profilesAPIHandler)
+	s.serveMux.HandleFunc("/api/lexicon", s.lexiconAPIHandler)
+	s.serveMux.HandleFunc("/api/lexicon/preview", s.lexiconPreviewHandler)
+	s.serveMux.HandleFunc("/api/status", s.statusAPIHandler)
+	s.serveMux.Handle("/api/edge/endpoints", http.TimeoutHandler(http.HandlerFunc(s.edgeEndpointsAPIHandler), s.VoicesTimeout, "timeout"))
 }
 
 // ListenAndServe 监听服务
@@ -66,7 +175,7 @@ func (s *GracefulServer) ListenAndServe(port int64) error {
 	s.Server = &http.Server{
 		Addr:           ":" + strconv.FormatInt(port, 10),
 		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   60 * time.Second,
+		WriteTimeout:   60 * time.Second, /* 流式传输时在 speakStream 中单独设置 */
 		MaxHeaderBytes: 1 << 20,
 		Handler:        s.serveMux,
 	}
@@ -86,13 +195,9 @@ func (s *GracefulServer) ListenAndServe(port int64) error {
 
 // Close 强制关闭，会终止连接
 func (s *GracefulServer) Close() {
-	if ttsEdge != nil {
-		ttsEdge.CloseConn()
-		ttsEdge = nil
-	}
-	if ttsAzure != nil {
-		ttsAzure.CloseConn()
-		ttsAzure = nil
+	s.cancelJobs()
+	if s.Engines != nil {
+		s.Engines.Close()
 	}
 
 	_ = s.Server.Close()
@@ -114,10 +219,35 @@ func (s *GracefulServer) Shutdown(timeout time.Duration) error {
 	return nil
 }
 
-// 验证Token true表示成功或未设置Token
+/* 非流式请求使用TimeoutHandler, 流式请求不限时, 避免截断音频 */
+func timeoutHandler(h http.Handler, dt time.Duration) http.Handler {
+	th := http.TimeoutHandler(h, dt, "timeout")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isStream(r) {
+			h.ServeHTTP(w, r)
+		} else {
+			th.ServeHTTP(w, r)
+		}
+	})
+}
+
+/* 请求头 Stream: true 或参数 stream=true 开启流式传输 */
+func isStream(r *http.Request) bool {
+	v := r.Header.Get("Stream")
+	if v == "" {
+		v = r.URL.Query().Get("stream")
+	}
+	stream, _ := strconv.ParseBool(v)
+	return stream
+}
+
+// 验证Token true表示成功或未设置Token, 无法设置请求头的客户端可使用参数 token
 func (s *GracefulServer) verifyToken(w http.ResponseWriter, r *http.Request) bool {
 	if s.Token != "" {
 		token := r.Header.Get("Token")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
 		if s.Token != token {
 			log.Warnf("无效的Token: %s, 远程地址: %s", token, r.RemoteAddr)
 			w.WriteHeader(http.StatusUnauthorized)
@@ -128,233 +258,501 @@ func (s *GracefulServer) verifyToken(w http.ResponseWriter, r *http.Request) boo
 	return true
 }
 
-var ttsEdge *edge.TTS
-
 // Microsoft Edge 大声朗读接口
 func (s *GracefulServer) edgeAPIHandler(w http.ResponseWriter, r *http.Request) {
-	s.edgeLock.Lock()
-	defer s.edgeLock.Unlock()
 	defer r.Body.Close()
 	pass := s.verifyToken(w, r)
 	if !pass {
 		return
 	}
 
-	startTime := time.Now()
 	body, _ := io.ReadAll(r.Body)
-	ssml := string(body)
-	format := r.Header.Get("Format")
+	log.Infoln("接收到SSML(Edge):", string(body))
+	req, err := s.bodyRequest(r, tts.EngineEdge, string(body))
+	if err != nil {
+		writeErrorData(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.speak(w, r, tts.EngineEdge, req)
+}
 
-	log.Infoln("接收到SSML(Edge):", ssml)
-	if ttsEdge == nil {
-		ttsEdge = &edge.TTS{DnsLookupEnabled: s.UseDnsEdge}
+// 微软Azure TTS接口
+func (s *GracefulServer) azureAPIHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	pass := s.verifyToken(w, r)
+	if !pass {
+		return
 	}
 
-	var succeed = make(chan []byte)
-	var failed = make(chan error)
-	go func() {
-		for i := 0; i < 3; i++ { /* 循环3次, 成功则return */
-			data, err := ttsEdge.GetAudio(ssml, format)
-			if err != nil {
-				if websocket.IsCloseError(err, websocket.CloseAbnormalClosure) { /* 1006异常断开 */
-					log.Infoln("异常断开, 自动重连...")
-					time.Sleep(1000) /* 等待一秒 */
-				} else { /* 正常性错误，如SSML格式错误 */
-					failed <- err
-					return
-				}
-			} else { /* 成功 */
-				succeed <- data
-				return
-			}
+	body, _ := io.ReadAll(r.Body)
+	log.Infoln("接收到SSML(Azure): ", string(body))
+	req, err := s.bodyRequest(r, tts.EngineAzure, string(body))
+	if err != nil {
+		writeErrorData(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.speak(w, r, tts.EngineAzure, req)
+}
+
+func (s *GracefulServer) creationAPIHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	pass := s.verifyToken(w, r)
+	if !pass {
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	log.Infoln("接收到Json(Creation): ", string(body))
+
+	var reqData CreationJson
+	err := json.Unmarshal(body, &reqData)
+	if err != nil {
+		writeErrorData(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req := &tts.SpeakRequest{Format: reqData.Format}
+	if reqData.VoiceName != "" { /* 未指定发音人时可使用预设 */
+		req.Voice = reqData.VoiceProperty()
+	}
+	s.setText(req, tts.EngineCreation, queryTextOptions(r.URL.Query()), creationUnescaper.Replace(reqData.Text))
+	s.speak(w, r, tts.EngineCreation, req)
+}
+
+/* 旧版阅读配置在客户端转义文本, 还原后由服务端统一转义 */
+var creationUnescaper = strings.NewReplacer("&amp;", "&", "&quot;", `"`, "&apos;", "'", "&lt;", "<", "&gt;", ">")
+
+// GET合成接口, 用于<audio src>或只支持GET的客户端
+// 参数: engine(默认edge), text, voice, voiceId(Creation), rate, volume, pitch, style, role, format, profile, token
+func (s *GracefulServer) ttsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeErrorData(w, http.StatusMethodNotAllowed, "仅支持GET请求")
+		return
+	}
+	pass := s.verifyToken(w, r)
+	if !pass {
+		return
+	}
+
+	params := r.URL.Query()
+	text := params.Get("text")
+	log.Infoln("接收到文本(GET):", text)
+	if strings.TrimSpace(text) == "" {
+		writeErrorData(w, http.StatusBadRequest, "text 不能为空")
+		return
+	}
+	engine := params.Get("engine")
+	if engine == "" {
+		engine = tts.EngineEdge
+	}
+
+	req := &tts.SpeakRequest{Format: params.Get("format")}
+	if err := s.queryVoice(params, engine, req); err != nil {
+		writeErrorData(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.setText(req, engine, queryTextOptions(params), text)
+	s.speak(w, r, engine, req)
+}
+
+/* 根据请求参数 profile, voice, voiceId, rate, volume, pitch, style, role 设置发音人, 未指定格式时使用预设或默认格式 */
+func (s *GracefulServer) queryVoice(params url.Values, engine string, req *tts.SpeakRequest) error {
+	if mode := params.Get("normalize"); !normalize.ValidMode(mode) {
+		return fmt.Errorf("不支持的规范化方式: %s", mode)
+	}
+	if profile := params.Get("profile"); profile != "" {
+		if err := s.applyProfile(profile, engine, req); err != nil {
+			return err
 		}
-	}()
+	}
+	if req.Voice == nil {
+		req.Voice = tts.NewVoiceProperty(engine, "zh-CN-XiaoxiaoNeural")
+	}
+	if req.Format == "" {
+		req.Format = "audio-24khz-48kbitrate-mono-mp3"
+	}
 
-	select { /* 阻塞 等待结果 */
-	case data := <-succeed: /* 成功接收到音频 */
-		log.Infof("音频下载完成, 大小：%dKB", len(data)/1024)
-		err := writeAudioData(w, data, format)
-		if err != nil {
-			log.Warnln(err)
+	voice := req.Voice
+	if v := params.Get("voice"); v != "" {
+		voice.VoiceName = v
+	}
+	if v := params.Get("voiceId"); v != "" {
+		voice.VoiceId = v
+	}
+	if v := params.Get("style"); v != "" {
+		voice.Style = v
+	}
+	if v := params.Get("role"); v != "" {
+		voice.Role = v
+	}
+	for _, p := range []struct {
+		name  string
+		value *int8
+	}{{"rate", &voice.Rate}, {"volume", &voice.Volume}, {"pitch", &voice.Pitch}} {
+		v := strings.TrimSuffix(params.Get(p.name), "%")
+		if v == "" {
+			continue
 		}
-	case reason := <-failed: /* 失败 */
-		ttsEdge.CloseConn()
-		ttsEdge = nil
-		writeErrorData(w, http.StatusInternalServerError, "获取音频失败(Edge): "+reason.Error())
-	case <-r.Context().Done(): /* 与阅读APP断开连接 超时15s */
-		log.Warnln("客户端(阅读APP)连接 超时关闭/意外断开")
-		select { /* 3s内如果成功下载, 就保留与微软服务器的连接 */
-		case <-succeed:
-			log.Debugln("断开后3s内成功下载")
-		case <-time.After(time.Second * 3): /* 抛弃WebSocket连接 */
-			ttsEdge.CloseConn()
-			ttsEdge = nil
+		i, err := strconv.ParseInt(v, 10, 8)
+		if err != nil || i < -100 || i > 100 {
+			return fmt.Errorf("%s 应为-100到100之间的整数: %s", p.name, params.Get(p.name))
+		}
+		*p.value = int8(i)
+	}
+	return nil
+}
+
+/*
+请求体以<speak开头或非文本类型时作为SSML, Content-Type 为 text/plain 或 text/markdown 时按请求参数中的发音人转为SSML,
+Markdown的代码块由参数 code=skip|spell|read 控制
+*/
+func (s *GracefulServer) bodyRequest(r *http.Request, engine, body string) (*tts.SpeakRequest, error) {
+	req := &tts.SpeakRequest{Format: r.Header.Get("Format")}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	trimmed := strings.TrimSpace(body)
+	isText := mediaType == "text/plain" || mediaType == "text/markdown" || mediaType == "text/x-markdown"
+	if !isText || strings.HasPrefix(trimmed, "<speak") || strings.HasPrefix(trimmed, "<?xml") {
+		req.Ssml = body
+		return req, nil
+	}
+
+	params := r.URL.Query()
+	if req.Format == "" {
+		req.Format = params.Get("format")
+	}
+	if err := s.queryVoice(params, engine, req); err != nil {
+		return nil, err
+	}
+
+	var nodes []ssml.Node
+	if mediaType == "text/plain" {
+		nodes = ssml.FromText(body)
+	} else {
+		code := params.Get("code")
+		if code != "" && code != ssml.CodeSkip && code != ssml.CodeSpell && code != ssml.CodeRead {
+			return nil, fmt.Errorf("不支持的代码块处理方式: %s", code)
 		}
+		nodes = ssml.FromMarkdown(body, &ssml.MarkdownOptions{Emphasis: engine == tts.EngineAzure, CodeBlocks: code})
 	}
-	log.Infof("耗时：%dms\n", time.Since(startTime).Milliseconds())
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("文本不能为空")
+	}
+	req.Ssml = speakSsml(req.Voice, s.textNodes(req.Voice, queryTextOptions(params), nodes...)...)
+	return req, nil
 }
 
-type LastAudioCache struct {
-	ssml      string
-	audioData []byte
+/* 合成结果 */
+type speakResult struct {
+	audio      []byte
+	boundaries []tts.Boundary
 }
 
-var ttsAzure *azure.TTS
-var audioCache *LastAudioCache
+/* 缓存内容: SSML或纯文本+发音人参数 */
+func cacheContent(req *tts.SpeakRequest) string {
+	if req.Ssml != "" {
+		return cache.NormalizeSsml(req.Ssml)
+	}
+	voice, _ := json.Marshal(req.Voice)
+	return string(voice) + "\n" + req.Text
+}
 
-// 微软Azure TTS接口
-func (s *GracefulServer) azureAPIHandler(w http.ResponseWriter, r *http.Request) {
-	s.azureLock.Lock()
-	defer s.azureLock.Unlock()
-	defer r.Body.Close()
-	pass := s.verifyToken(w, r)
-	if !pass {
+/* 使用指定引擎合成音频并写入客户端, 请求参数 subtitles=srt|vtt|json 时返回字幕 */
+func (s *GracefulServer) speak(w http.ResponseWriter, r *http.Request, name string, req *tts.SpeakRequest) {
+	engine, err := s.Engines.Get(name)
+	if err != nil {
+		writeErrorData(w, http.StatusNotFound, fmt.Sprintf("%s: %v", name, err))
 		return
 	}
 
-	startTime := time.Now()
-	format := r.Header.Get("Format")
-	body, _ := io.ReadAll(r.Body)
-	ssml := string(body)
-	log.Infoln("接收到SSML(Azure): ", ssml)
-
-	if audioCache != nil {
-		if audioCache.ssml == ssml {
-			log.Infoln("与上次超时断开时音频SSML一致, 使用缓存...\n")
-			err := writeAudioData(w, audioCache.audioData, format)
-			if err != nil {
-				log.Warnln(err)
-			} else {
-				audioCache = nil
-			}
+	if req.Ssml != "" { /* 在发送前拒绝格式错误的SSML, 不限制元素, 由上游校验 */
+		if err := ssml.WellFormed(req.Ssml); err != nil {
+			writeErrorData(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if profile := r.URL.Query().Get("profile"); profile != "" {
+		if err := s.applyProfile(profile, name, req); err != nil {
+			writeErrorData(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	subtitles := r.URL.Query().Get("subtitles")
+	stream := isStream(r)
+	if subtitles != "" {
+		if stream {
+			writeErrorData(w, http.StatusBadRequest, "流式传输不支持字幕")
 			return
-		} else { /* SSML不一致, 抛弃 */
-			audioCache = nil
 		}
+		if subtitle.ContentType(subtitles) == "" {
+			writeErrorData(w, http.StatusBadRequest, "不支持的字幕格式: "+subtitles)
+			return
+		}
+		req.WordBoundary = true
+		req.SentenceBoundary = true
 	}
 
-	if ttsAzure == nil {
-		ttsAzure = &azure.TTS{}
+	key := cache.Key(name, req.Format+"|"+subtitles, cacheContent(req))
+	contentType := formatContentType(req.Format)
+	if subtitles != "" {
+		contentType = subtitle.ContentType(subtitles)
 	}
+	if data, ok := s.Cache.Get(key); ok {
+		log.Infof("命中缓存: %s", key)
+		w.Header().Set("X-Cache", "HIT")
+		err := writeData(w, data, contentType)
+		if err != nil {
+			log.Warnln(err)
+		}
+		return
+	}
+	w.Header().Set("X-Cache", "MISS")
 
-	var succeed = make(chan []byte)
-	var failed = make(chan error)
+	if stream {
+		s.speakStream(w, r, name, engine, req, key)
+		return
+	}
+
+	startTime := time.Now()
+	/* 不直接使用r.Context(), 客户端断开后仍可等待一段时间保留结果 */
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var succeed = make(chan *speakResult, 1)
+	var failed = make(chan error, 1)
+	var served string
 	go func() {
-		for i := 0; i < 3; i++ { /* 循环3次, 成功则return */
-			data, err := ttsAzure.GetAudio(ssml, format)
-			if err != nil {
-				if websocket.IsCloseError(err, websocket.CloseAbnormalClosure) { /* 1006异常断开 */
-					log.Infoln("异常断开, 自动重连...")
-					time.Sleep(1000) /* 等待一秒 */
-				} else { /* 正常性错误，如SSML格式错误 */
-					failed <- err
-					return
-				}
-			} else { /* 成功 */
-				succeed <- data
-				return
-			}
+		result, engineName, err := s.synthesizeFailover(ctx, name, engine, req)
+		if err != nil {
+			failed <- err
+		} else {
+			served = engineName
+			succeed <- result
 		}
 	}()
 
 	select { /* 阻塞 等待结果 */
-	case data := <-succeed: /* 成功接收到音频 */
-		log.Infof("音频下载完成, 大小：%dKB", len(data)/1024)
-		err := writeAudioData(w, data, format)
+	case result := <-succeed: /* 成功接收到音频 */
+		log.Infof("音频下载完成, 大小：%dKB", len(result.audio)/1024)
+		w.Header().Set("X-TTS-Engine", served)
+		data, err := s.cacheSpeakResult(key, result, req.Format, subtitles)
+		if err == nil {
+			err = writeData(w, data, contentType)
+		}
 		if err != nil {
 			log.Warnln(err)
 		}
 	case reason := <-failed: /* 失败 */
-		ttsAzure.CloseConn()
-		ttsAzure = nil
-		writeErrorData(w, http.StatusInternalServerError, "获取音频失败(Azure): "+reason.Error())
-	case <-r.Context().Done(): /* 与阅读APP断开连接  超时15s */
+		writeErrorData(w, http.StatusInternalServerError, fmt.Sprintf("获取音频失败(%s): %v", name, reason))
+	case <-r.Context().Done(): /* 与阅读APP断开连接 超时15s */
 		log.Warnln("客户端(阅读APP)连接 超时关闭/意外断开")
-		select { /* 15s内如果成功下载, 就保留与微软服务器的连接 */
-		case data := <-succeed:
+		select { /* 15s内如果成功下载, 就缓存音频 */
+		case result := <-succeed:
 			log.Infoln("断开后15s内成功下载")
-			audioCache = &LastAudioCache{
-				ssml:      ssml,
-				audioData: data,
+			if _, err := s.cacheSpeakResult(key, result, req.Format, subtitles); err != nil {
+				log.Warnln(err)
 			}
-		case <-time.After(time.Second * 15): /* 抛弃WebSocket连接 */
-			ttsAzure.CloseConn()
-			ttsAzure = nil
+		case <-failed:
+		case <-time.After(time.Second * 15): /* 取消合成, 引擎会抛弃WebSocket连接 */
 		}
 	}
 	log.Infof("耗时: %dms\n", time.Since(startTime).Milliseconds())
 }
 
-var ttsCreation *creation.TTS
+/* 流式传输时客户端读取过慢 */
+var errSlowClient = errors.New("客户端读取过慢, 已取消合成")
 
-func (s *GracefulServer) creationAPIHandler(w http.ResponseWriter, r *http.Request) {
-	s.creationLock.Lock()
-	defer s.creationLock.Unlock()
-	defer r.Body.Close()
-	pass := s.verifyToken(w, r)
-	if !pass {
-		return
-	}
+/* 流式传输时等待写入客户端的最大数据量 */
+const streamMaxBuffer = 16 << 20
 
-	startTime := time.Now()
-	body, _ := io.ReadAll(r.Body)
-	text := string(body)
-	log.Infoln("接收到Json(Creation): ", text)
-
-	var reqData CreationJson
-	err := json.Unmarshal(body, &reqData)
-	if err != nil {
-		writeErrorData(w, http.StatusBadRequest, err.Error())
+/* 流式传输, 接收到音频数据后立即以chunked方式写入客户端 */
+func (s *GracefulServer) speakStream(w http.ResponseWriter, r *http.Request, name string, engine tts.Engine, req *tts.SpeakRequest, key string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeErrorData(w, http.StatusInternalServerError, "不支持流式传输")
 		return
 	}
+	/* 流式传输不受服务器的WriteTimeout限制, 改为每次写入时设置超时 */
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
 
-	if ttsCreation == nil {
-		ttsCreation = creation.New()
-	}
-
-	var succeed = make(chan []byte)
-	var failed = make(chan error)
+	startTime := time.Now()
+	/* 在单独的goroutine中写入客户端, 回调中不阻塞, 避免阻塞WebSocket连接上的其他请求。
+	客户端超过 StreamStallTimeout 未读取或待写入的数据过多时取消该请求 */
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	var (
+		lock      sync.Mutex
+		queue     [][]byte
+		queued    int
+		lastWrite time.Time /* 最近一次写入成功的时间 */
+		finished  bool
+		overflow  bool
+	)
+	notify := make(chan struct{}, 1)
+	var err error
+	var served string
 	go func() {
-		for i := 0; i < 3; i++ { /* 循环3次, 成功则return */
-			data, err := ttsCreation.GetAudioUseContext(r.Context(), reqData.Text, reqData.Format, reqData.VoiceProperty())
-			if err != nil {
-				if errors.Is(err, context.Canceled) {
+		defer func() {
+			lock.Lock()
+			finished = true
+			if overflow {
+				err = errSlowClient
+			}
+			lock.Unlock()
+			select {
+			case notify <- struct{}{}:
+			default:
+			}
+		}()
+		written := false
+		read := func(data []byte) {
+			written = true
+			lock.Lock()
+			defer lock.Unlock()
+			if overflow {
+				return
+			}
+			if queued+len(data) > streamMaxBuffer || (queued > 0 && time.Since(lastWrite) > s.StreamStallTimeout) {
+				overflow = true
+				cancel()
+				return
+			}
+			if queued == 0 { /* 从开始等待写入时计时 */
+				lastWrite = time.Now()
+			}
+			queue = append(queue, data)
+			queued += len(data)
+			select {
+			case notify <- struct{}{}:
+			default:
+			}
+		}
+		/* 未写入数据前可切换到备用引擎 */
+		for i, candidate := range append([]string{name}, s.failoverEngines(name)...) {
+			attempt, e := req, engine
+			if i > 0 {
+				if ctx.Err() != nil {
 					return
 				}
-				if i == 2 { //三次请求都失败
-					failed <- err
-					return
+				next, convErr := s.failoverRequest(ctx, name, candidate, req)
+				if convErr != nil {
+					log.Warnf("无法切换到%s: %v", candidate, convErr)
+					continue
 				}
-				log.Warnln(err)
-				log.Warnf("开始第%d次重试...", i+1)
-				time.Sleep(time.Second * 2)
-			} else { /* 成功 */
-				succeed <- data
+				log.Warnf("%s合成失败, 切换到%s: %v", name, candidate, err)
+				attempt = next
+				e, _ = s.Engines.Get(candidate)
+			}
+			served = candidate
+			if err = s.streamRetry(ctx, candidate, e, attempt, read); err == nil || written || badRequest(err) {
 				return
 			}
 		}
 	}()
 
-	select { /* 阻塞 等待结果 */
-	case data := <-succeed: /* 成功接收到音频 */
-		log.Infof("音频下载完成, 大小：%dKB", len(data)/1024)
-		err := writeAudioData(w, data, reqData.Format)
-		if err != nil {
-			log.Warnln(err)
+	var audio []byte
+	size := 0
+	for {
+		lock.Lock()
+		chunks, done := queue, finished
+		queue = nil
+		lock.Unlock()
+		if len(chunks) == 0 {
+			if done {
+				break
+			}
+			<-notify
+			continue
+		}
+
+		for _, data := range chunks {
+			audio = append(audio, data...)
+			if size == 0 {
+				w.Header().Set("Content-Type", formatContentType(req.Format))
+				w.Header().Set("X-TTS-Engine", served)
+				w.WriteHeader(http.StatusOK)
+			}
+			size += len(data)
+			_ = rc.SetWriteDeadline(time.Now().Add(s.StreamStallTimeout))
+			_, writeErr := w.Write(data)
+			if writeErr == nil {
+				flusher.Flush()
+			} else if ctx.Err() == nil {
+				log.Warnln(writeErr)
+				cancel() /* 客户端已断开, 读取剩余数据直到合成结束 */
+			}
+			lock.Lock()
+			queued -= len(data)
+			if writeErr == nil {
+				lastWrite = time.Now()
+			}
+			lock.Unlock()
 		}
-	case reason := <-failed: /* 失败 */
-		writeErrorData(w, http.StatusInternalServerError, "获取音频失败(Creation): "+reason.Error())
-		ttsCreation = nil
-	case <-r.Context().Done(): /* 与阅读APP断开连接  超时15s */
-		log.Warnln("客户端(阅读APP)连接 超时关闭/意外断开")
 	}
 
-	log.Infof("耗时: %dms\n", time.Since(startTime).Milliseconds())
+	if err != nil {
+		if size == 0 {
+			writeErrorData(w, http.StatusInternalServerError, fmt.Sprintf("获取音频失败(%s): %v", name, err))
+		} else { /* 已发送响应头, 只能中断传输 */
+			log.Warnf("流式传输中断(%s): %v", name, err)
+		}
+		return
+	}
+	log.Infof("流式传输完成, 大小：%dKB, 耗时: %dms", size/1024, time.Since(startTime).Milliseconds())
+	if err := s.Cache.Put(key, audio); err != nil {
+		log.Warnln("写入缓存失败:", err)
+	}
+}
+
+/* 重试策略 */
+func (s *GracefulServer) retryPolicy() retry.Policy {
+	return retry.Policy{Attempts: s.RetryAttempts, Backoff: retry.Backoff{Base: s.RetryDelay, Max: s.RetryMaxDelay}}
+}
+
+/* 流式合成, 未写入数据前失败按退避间隔重试, 熔断器打开时直接返回 */
+func (s *GracefulServer) streamRetry(ctx context.Context, name string, engine tts.Engine, req *tts.SpeakRequest, read func([]byte)) error {
+	written := false
+	return s.retryPolicy().Do(ctx, s.Breakers.Get(name), func(int) (bool, error) {
+		err := engine.SynthesizeStream(ctx, req, func(data []byte) {
+			written = true
+			read(data)
+		})
+		return !written, err
+	})
+}
+
+/* 失败按退避间隔重试, 如连接异常断开, 熔断器打开时直接返回 */
+func (s *GracefulServer) synthesizeRetry(ctx context.Context, name string, engine tts.Engine, req *tts.SpeakRequest) (result *speakResult, err error) {
+	err = s.retryPolicy().Do(ctx, s.Breakers.Get(name), func(int) (bool, error) {
+		result = &speakResult{}
+		attempt := *req /* 每次重试重新收集边界事件 */
+		if req.WordBoundary || req.SentenceBoundary {
+			attempt.OnBoundary = func(b tts.Boundary) {
+				result.boundaries = append(result.boundaries, b)
+				if req.OnBoundary != nil {
+					req.OnBoundary(b)
+				}
+			}
+		}
+		var err error
+		result.audio, err = engine.Synthesize(ctx, &attempt)
+		return true, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 /* 写入音频数据到客户端(阅读APP) */
 func writeAudioData(w http.ResponseWriter, data []byte, format string) error {
-	w.Header().Set("Content-Type", formatContentType(format))
+	return writeData(w, data, formatContentType(format))
+}
+
+func writeData(w http.ResponseWriter, data []byte, contentType string) error {
+	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Content-Length", strconv.FormatInt(int64(len(data)), 10))
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("Keep-Alive", "timeout=5")
@@ -362,6 +760,35 @@ func writeAudioData(w http.ResponseWriter, data []byte, format string) error {
 	return err
 }
 
+/* 编码合成结果并写入缓存, subtitles不为空时编码为字幕 */
+func (s *GracefulServer) cacheSpeakResult(key string, result *speakResult, format, subtitles string) ([]byte, error) {
+	var data []byte
+	switch subtitles {
+	case "":
+		data = result.audio
+	case subtitle.FormatJson:
+		subtitleJson := &SubtitleJson{Format: format, Audio: result.audio, Boundaries: make([]BoundaryJson, 0, len(result.boundaries))}
+		for _, b := range result.boundaries {
+			subtitleJson.Boundaries = append(subtitleJson.Boundaries, BoundaryJson{Type: b.Type,
+				Offset: b.Offset.Milliseconds(), Duration: b.Duration.Milliseconds(), Text: b.Text})
+		}
+		var err error
+		data, err = json.Marshal(subtitleJson)
+		if err != nil {
+			return nil, err
+		}
+	case subtitle.FormatSrt:
+		data = []byte(subtitle.Srt(subtitle.Cues(result.boundaries)))
+	case subtitle.FormatVtt:
+		data = []byte(subtitle.Vtt(subtitle.Cues(result.boundaries)))
+	}
+
+	if err := s.Cache.Put(key, data); err != nil {
+		log.Warnln("写入缓存失败:", err)
+	}
+	return data, nil
+}
+
 /* 写入错误信息到客户端 */
 func writeErrorData(w http.ResponseWriter, statusCode int, data string) {
 	log.Warnln(data)
@@ -408,29 +835,112 @@ func (s *GracefulServer) legadoAPIHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
-/* 发音人数据 */
-func (s *GracefulServer) creationVoicesAPIHandler(w http.ResponseWriter, _ *http.Request) {
-	token, err := creation.GetToken()
-	if err != nil {
-		writeErrorData(w, http.StatusInternalServerError, "获取Token失败: "+err.Error())
-		return
+/* 发音人数据, 返回引擎原始格式以兼容网页 */
+func (s *GracefulServer) voicesAPIHandler(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		engine, err := s.Engines.Get(name)
+		if err != nil {
+			writeErrorData(w, http.StatusNotFound, fmt.Sprintf("%s: %v", name, err))
+			return
+		}
+
+		var data []byte
+		if raw, ok := engine.(tts.RawVoicesEngine); ok {
+			data, err = raw.RawVoices(r.Context())
+		} else {
+			var voices []tts.Voice
+			if voices, err = engine.Voices(r.Context()); err == nil {
+				data, err = json.Marshal(voices)
+			}
+		}
+		if err != nil {
+			writeErrorData(w, http.StatusInternalServerError, "获取Voices失败: "+err.Error())
+			return
+		}
+
+		w.Header().Set("cache-control", "public, max-age=3600, s-maxage=3600")
+		_, _ = w.Write(data)
 	}
-	data, err := creation.GetVoices(token)
-	if err != nil {
-		writeErrorData(w, http.StatusInternalServerError, "获取Voices失败: "+err.Error())
+}
+
+/* 统一格式的发音人列表, 参数 engine(可用逗号分隔多个), locale, gender, style, q(搜索名称) 用于筛选 */
+func (s *GracefulServer) allVoicesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	names := s.Engines.Names()
+	if engine := params.Get("engine"); engine != "" {
+		names = tts.SplitList(engine)
+	}
+
+	voices, errs := s.voices.catalog(r.Context(), s.Engines, names)
+	if len(errs) > 0 && len(voices) == 0 {
+		writeErrorData(w, http.StatusInternalServerError, "获取Voices失败: "+strings.Join(errs, "; "))
 		return
 	}
+
+	filter := &voiceFilter{Locale: params.Get("locale"), Gender: params.Get("gender"), Style: params.Get("style"), Query: params.Get("q")}
+	result := make([]tts.Voice, 0, len(voices))
+	for i := range voices {
+		if filter.match(&voices[i]) {
+			result = append(result, voices[i])
+		}
+	}
+
+	data, _ := json.Marshal(result)
 	w.Header().Set("cache-control", "public, max-age=3600, s-maxage=3600")
-	_, _ = w.Write(data)
+	_ = writeData(w, data, "application/json; charset=utf-8")
 }
 
-func (s *GracefulServer) azureVoicesAPIHandler(w http.ResponseWriter, _ *http.Request) {
-	data, err := azure.GetVoices()
-	if err != nil {
-		writeErrorData(w, http.StatusInternalServerError, "获取Voices失败: "+err.Error())
+/* 缓存管理: GET 查看, DELETE 清空或按key删除 */
+func (s *GracefulServer) cacheAPIHandler(w http.ResponseWriter, r *http.Request) {
+	pass := s.verifyToken(w, r)
+	if !pass {
 		return
 	}
 
-	w.Header().Set("cache-control", "public, max-age=3600, s-maxage=3600")
-	_, _ = w.Write(data)
+	switch r.Method {
+	case http.MethodGet:
+		data, _ := json.Marshal(&CacheJson{Stats: s.Cache.Stats(), Entries: s.Cache.List()})
+		_ = writeData(w, data, "application/json; charset=utf-8")
+	case http.MethodDelete:
+		if key := r.URL.Query().Get("key"); key != "" {
+			if !s.Cache.Delete(key) {
+				writeErrorData(w, http.StatusNotFound, "缓存不存在: "+key)
+				return
+			}
+		} else {
+			s.Cache.Purge()
+		}
+		log.Infoln("已清理缓存")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeErrorData(w, http.StatusMethodNotAllowed, "不支持的请求方法: "+r.Method)
+	}
+}
+
+/* 使用预设补全请求中未指定的格式与发音人 */
+func (s *GracefulServer) applyProfile(name, engine string, req *tts.SpeakRequest) error {
+	profile, ok := s.Profiles[name]
+	if !ok {
+		return fmt.Errorf("预设不存在: %s", name)
+	}
+	if profile.Engine != "" && profile.Engine != engine {
+		return fmt.Errorf("预设 %s 仅适用于 %s", name, profile.Engine)
+	}
+	if req.Format == "" {
+		req.Format = profile.Format
+	}
+	if req.Voice == nil {
+		req.Voice = profile.VoiceProperty(engine)
+	}
+	return nil
+}
+
+/* 发音人预设列表 */
+func (s *GracefulServer) profilesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	profiles := s.Profiles
+	if profiles == nil {
+		profiles = map[string]*config.Profile{}
+	}
+	data, _ := json.Marshal(profiles)
+	_ = writeData(w, data, "application/json; charset=utf-8")
 }
@@ -1,8 +1,21 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/jing332/tts-server-go/config"
+	"github.com/jing332/tts-server-go/tts"
+	"github.com/jing332/tts-server-go/tts/creation"
+	"github.com/jing332/tts-server-go/tts/edge"
+	"github.com/jing332/tts-server-go/tts/normalize"
+	"github.com/jing332/tts-server-go/tts/retry"
 	log "github.com/sirupsen/logrus"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 )
@@ -27,3 +40,621 @@ func TestShutdown(t *testing.T) {
 		return
 	}
 }
+
+type fakeEngine struct {
+	errs   []error /* 依次返回的错误 */
+	calls  int
+	last   *tts.SpeakRequest
+	voices []tts.Voice
+}
+
+func (e *fakeEngine) Synthesize(_ context.Context, req *tts.SpeakRequest) ([]byte, error) {
+	e.calls++
+	e.last = req
+	if len(e.errs) > 0 {
+		err := e.errs[0]
+		e.errs = e.errs[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	if req.OnBoundary != nil && req.WordBoundary {
+		req.OnBoundary(tts.Boundary{Type: tts.WordBoundary, Text: "你好", Offset: time.Second, Duration: time.Second / 2})
+	}
+	return []byte(req.Ssml + req.Text), nil
+}
+
+func (e *fakeEngine) SynthesizeStream(ctx context.Context, req *tts.SpeakRequest, read func([]byte)) error {
+	data, err := e.Synthesize(ctx, req)
+	if err != nil {
+		return err
+	}
+	read(data)
+	return nil
+}
+
+func (e *fakeEngine) Voices(context.Context) ([]tts.Voice, error) {
+	return e.voices, nil
+}
+
+func (e *fakeEngine) Close() error {
+	return nil
+}
+
+func newTestServer(engines map[string]tts.Engine) *GracefulServer {
+	s := &GracefulServer{Engines: tts.NewRegistry()}
+	for name, e := range engines {
+		s.Engines.Register(name, e)
+	}
+	s.HandleFunc()
+	return s
+}
+
+func TestEdgeAPIRetry(t *testing.T) {
+	e := &fakeEngine{errs: []error{&websocket.CloseError{Code: websocket.CloseAbnormalClosure}}}
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: e})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/ra", strings.NewReader("<speak/>"))
+	req.Header.Set("Format", "audio-24khz-48kbitrate-mono-mp3")
+	w := httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "<speak/>" {
+		t.Fatalf("%d: %s", w.Code, w.Body.String())
+	}
+	if e.calls != 2 {
+		t.Fatalf("calls: %d", e.calls)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "audio/mpeg" {
+		t.Fatalf("content-type: %s", ct)
+	}
+}
+
+func TestEdgeAPINotRetryable(t *testing.T) {
+	e := &fakeEngine{errs: []error{&websocket.CloseError{Code: websocket.CloseInvalidFramePayloadData}}}
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: e})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/ra", strings.NewReader("<speak/>"))
+	w := httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError || e.calls != 1 {
+		t.Fatalf("%d, calls: %d", w.Code, e.calls)
+	}
+}
+
+func TestToken(t *testing.T) {
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: &fakeEngine{}})
+	s.Token = "abc"
+
+	req := httptest.NewRequest(http.MethodPost, "/api/ra", strings.NewReader("<speak/>"))
+	w := httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("code: %d", w.Code)
+	}
+}
+
+func TestSubtitles(t *testing.T) {
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: &fakeEngine{}})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/ra?subtitles=srt", strings.NewReader("<speak/>"))
+	w := httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "1\n00:00:01,000 --> 00:00:01,500\n你好\n\n" {
+		t.Fatalf("%d: %q", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/ra?subtitles=json", strings.NewReader("<speak/>"))
+	w = httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, req)
+	var data SubtitleJson
+	if err := json.Unmarshal(w.Body.Bytes(), &data); err != nil {
+		t.Fatal(err)
+	}
+	if string(data.Audio) != "<speak/>" || len(data.Boundaries) != 1 || data.Boundaries[0].Offset != 1000 {
+		t.Fatalf("%+v", data)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/ra?subtitles=ass", strings.NewReader("<speak/>"))
+	w = httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("code: %d", w.Code)
+	}
+}
+
+func TestStream(t *testing.T) {
+	e := &fakeEngine{errs: []error{&websocket.CloseError{Code: websocket.CloseAbnormalClosure}}}
+	s := newTestServer(map[string]tts.Engine{tts.EngineAzure: e})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/azure", strings.NewReader("<speak/>"))
+	req.Header.Set("Stream", "true")
+	req.Header.Set("Format", "webm-24khz-16bit-mono-opus")
+	w := httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "<speak/>" || !w.Flushed {
+		t.Fatalf("%d: %q, flushed: %v", w.Code, w.Body.String(), w.Flushed)
+	}
+	if w.Header().Get("Content-Length") != "" || w.Header().Get("Content-Type") != "audio/webm; codec=opus" {
+		t.Fatalf("header: %v", w.Header())
+	}
+	if e.calls != 2 {
+		t.Fatalf("calls: %d", e.calls)
+	}
+}
+
+/* 按块流式合成, 模拟共用的WebSocket连接: 回调阻塞时不返回 */
+type chunkEngine struct {
+	fakeEngine
+	interval time.Duration /* 每块的合成时间 */
+	done     chan error
+}
+
+func (e *chunkEngine) SynthesizeStream(ctx context.Context, _ *tts.SpeakRequest, read func([]byte)) error {
+	var err error
+	for i := 0; i < 1000 && err == nil; i++ {
+		read([]byte{byte(i)})
+		time.Sleep(e.interval)
+		err = ctx.Err()
+	}
+	e.done <- err
+	return err
+}
+
+/* 写入时阻塞, 直到release关闭; release为空时每次写入等待delay */
+type slowWriter struct {
+	*httptest.ResponseRecorder
+	release chan struct{}
+	delay   time.Duration
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	if w.release != nil {
+		<-w.release
+	}
+	time.Sleep(w.delay)
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestStreamSlowClient(t *testing.T) {
+	e := &chunkEngine{interval: time.Millisecond, done: make(chan error, 1)}
+	s := &GracefulServer{Engines: tts.NewRegistry(), StreamStallTimeout: 50 * time.Millisecond}
+	s.Engines.Register(tts.EngineAzure, e)
+	s.HandleFunc()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/azure?stream=true", strings.NewReader("<speak/>"))
+	w := &slowWriter{ResponseRecorder: httptest.NewRecorder(), release: make(chan struct{})}
+	served := make(chan struct{})
+	go func() {
+		s.serveMux.ServeHTTP(w, req)
+		close(served)
+	}()
+
+	select {
+	case err := <-e.done: /* 客户端停止读取时取消, 不阻塞合成 */
+		if !errors.Is(err, context.Canceled) {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("synthesis blocked by stalled client")
+	}
+	close(w.release)
+	<-served
+	if w.Code != http.StatusOK || w.Body.Len() == 0 || w.Body.Len() >= 1000 {
+		t.Fatalf("%d: %d", w.Code, w.Body.Len())
+	}
+	if s.Cache.Stats().Entries != 0 {
+		t.Fatal("incomplete audio should not be cached")
+	}
+}
+
+/* 客户端读取比合成慢但没有停止时, 缓存待写入的数据, 不取消 */
+func TestStreamSlowerThanSynthesis(t *testing.T) {
+	e := &chunkEngine{done: make(chan error, 1)}
+	s := &GracefulServer{Engines: tts.NewRegistry(), StreamStallTimeout: 50 * time.Millisecond}
+	s.Engines.Register(tts.EngineAzure, e)
+	s.HandleFunc()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/azure?stream=true", strings.NewReader("<speak/>"))
+	w := &slowWriter{ResponseRecorder: httptest.NewRecorder(), delay: 200 * time.Microsecond}
+	s.serveMux.ServeHTTP(w, req)
+	if err := <-e.done; err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || w.Body.Len() != 1000 || s.Cache.Stats().Entries != 1 {
+		t.Fatalf("%d: %d", w.Code, w.Body.Len())
+	}
+}
+
+func TestCache(t *testing.T) {
+	e := &fakeEngine{}
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: e})
+
+	for i, want := range []string{"MISS", "HIT"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/ra", strings.NewReader("<speak>  测试</speak>"))
+		w := httptest.NewRecorder()
+		s.serveMux.ServeHTTP(w, req)
+		if w.Header().Get("X-Cache") != want || w.Body.String() != "<speak>  测试</speak>" {
+			t.Fatalf("%d: %s, %q", i, w.Header().Get("X-Cache"), w.Body.String())
+		}
+	}
+	if e.calls != 1 {
+		t.Fatalf("calls: %d", e.calls)
+	}
+
+	w := httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/cache", nil))
+	var data CacheJson
+	if err := json.Unmarshal(w.Body.Bytes(), &data); err != nil || data.Stats.Entries != 1 {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/cache", nil))
+	if w.Code != http.StatusNoContent || s.Cache.Stats().Entries != 0 {
+		t.Fatalf("code: %d", w.Code)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	e := &fakeEngine{}
+	s := newTestServer(map[string]tts.Engine{tts.EngineCreation: e})
+	s.Profiles = map[string]*config.Profile{
+		"xiaoxiao": {Voice: "zh-CN-XiaoxiaoNeural", VoiceId: "5f55541d-c844-4e04-a7f8-1723ffbea4a9", Format: "audio-24khz-48kbitrate-mono-mp3"},
+		"edge":     {Engine: tts.EngineEdge, Voice: "zh-CN-YunxiNeural"},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/creation?profile=xiaoxiao", strings.NewReader(`{"text":"你好"}`))
+	w := httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || e.last.Format != "audio-24khz-48kbitrate-mono-mp3" ||
+		e.last.Voice.VoiceName != "zh-CN-XiaoxiaoNeural" || e.last.Voice.Api != tts.ApiCreation {
+		t.Fatalf("%d: %+v", w.Code, e.last)
+	}
+
+	for _, profile := range []string{"none", "edge"} {
+		req = httptest.NewRequest(http.MethodPost, "/api/creation?profile="+profile, strings.NewReader(`{"text":"你好"}`))
+		w = httptest.NewRecorder()
+		s.serveMux.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: %d", profile, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/profiles", nil))
+	var profiles map[string]*config.Profile
+	if err := json.Unmarshal(w.Body.Bytes(), &profiles); err != nil || len(profiles) != 2 {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+}
+
+func TestRetryAttempts(t *testing.T) {
+	closeErr := &websocket.CloseError{Code: websocket.CloseAbnormalClosure}
+	e := &fakeEngine{errs: []error{closeErr, closeErr}}
+	s := &GracefulServer{Engines: tts.NewRegistry(), RetryAttempts: 2, RetryDelay: -1}
+	s.Engines.Register(tts.EngineEdge, e)
+	s.HandleFunc()
+
+	w := httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/ra", strings.NewReader("<speak/>")))
+	if w.Code != http.StatusInternalServerError || e.calls != 2 {
+		t.Fatalf("%d, calls: %d", w.Code, e.calls)
+	}
+}
+
+func TestAllVoices(t *testing.T) {
+	edge := &fakeEngine{voices: []tts.Voice{
+		{ShortName: "zh-CN-XiaoxiaoNeural", Locale: "zh-CN", Gender: "Female", LocalName: "晓晓"},
+		{ShortName: "en-US-GuyNeural", Locale: "en-US", Gender: "Male"},
+	}}
+	azure := &fakeEngine{voices: []tts.Voice{
+		{ShortName: "zh-CN-YunxiNeural", Locale: "zh-CN", Gender: "Male", Styles: []string{"cheerful", "sad"}},
+		{ShortName: "en-US-JennyMultilingualNeural", Locale: "en-US", Gender: "Female", SecondaryLocales: []string{"zh-CN"}},
+		{ShortName: "zh-TW-HsiaoChenNeural", Locale: "zh-TW", Gender: "Female"},
+	}}
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: edge, tts.EngineAzure: azure})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"en-US-JennyMultilingualNeural", "zh-CN-YunxiNeural", "zh-TW-HsiaoChenNeural", "en-US-GuyNeural", "zh-CN-XiaoxiaoNeural"}},
+		{"engine=edge", []string{"en-US-GuyNeural", "zh-CN-XiaoxiaoNeural"}},
+		{"locale=zh-cn", []string{"en-US-JennyMultilingualNeural", "zh-CN-YunxiNeural", "zh-CN-XiaoxiaoNeural"}},
+		{"locale=zh&gender=female", []string{"en-US-JennyMultilingualNeural", "zh-TW-HsiaoChenNeural", "zh-CN-XiaoxiaoNeural"}},
+		{"style=Cheerful", []string{"zh-CN-YunxiNeural"}},
+		{"q=晓晓", []string{"zh-CN-XiaoxiaoNeural"}},
+		{"engine=azure&q=jenny", []string{"en-US-JennyMultilingualNeural"}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/voices?"+tt.query, nil))
+		var voices []tts.Voice
+		if err := json.Unmarshal(w.Body.Bytes(), &voices); err != nil {
+			t.Fatalf("%s: %v, %s", tt.query, err, w.Body.String())
+		}
+		var names []string
+		for _, v := range voices {
+			names = append(names, v.ShortName)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Fatalf("%s: %v", tt.query, names)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/voices?engine=google", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("code: %d", w.Code)
+	}
+
+	/* 不支持原始格式的引擎返回统一格式 */
+	w = httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/ra/voices", nil))
+	var voices []tts.Voice
+	if err := json.Unmarshal(w.Body.Bytes(), &voices); err != nil || len(voices) != 2 {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+}
+
+func TestTTSGet(t *testing.T) {
+	e := &fakeEngine{}
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: e, tts.EngineAzure: &fakeEngine{}})
+	s.Token = "abc"
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tts?"+query, nil))
+		return w
+	}
+
+	query := "token=abc&text=" + url.QueryEscape("a&b") + "&voice=zh-CN-YunxiNeural&rate=20&pitch=-10%25"
+	w := get(query)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "audio/mpeg" || e.last.Format != "audio-24khz-48kbitrate-mono-mp3" ||
+		!strings.Contains(e.last.Ssml, `<voice name="zh-CN-YunxiNeural"><prosody rate="20%" volume="0%" pitch="-10%">a&amp;b</prosody>`) {
+		t.Fatalf("%d: %+v", w.Code, e.last)
+	}
+	if w = get(query); w.Header().Get("X-Cache") != "HIT" || e.calls != 1 {
+		t.Fatalf("cache: %s, calls: %d", w.Header().Get("X-Cache"), e.calls)
+	}
+
+	for query, code := range map[string]int{
+		"text=hi":                        http.StatusUnauthorized,
+		"token=abc":                      http.StatusBadRequest,
+		"token=abc&text=hi&rate=200":     http.StatusBadRequest,
+		"token=abc&text=hi&engine=x":     http.StatusNotFound,
+		"token=abc&text=hi&profile=none": http.StatusBadRequest,
+	} {
+		if w := get(query); w.Code != code {
+			t.Fatalf("%s: %d", query, w.Code)
+		}
+	}
+}
+
+func TestInvalidSsml(t *testing.T) {
+	e := &fakeEngine{}
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: e})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/ra", strings.NewReader("<speak>\n</voice></speak>"))
+	w := httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "第2行第1列") || e.calls != 0 {
+		t.Fatalf("%d: %s", w.Code, w.Body.String())
+	}
+}
+
+/* 原样转发的SSML只校验格式, 元素由上游校验 */
+func TestPassThroughSsml(t *testing.T) {
+	e := &fakeEngine{}
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: e, tts.EngineAzure: e})
+
+	for _, content := range []string{
+		`<bookmark mark="a"/>你好`,
+		`<bookmark/>`,
+		`<audio src="https://example.com/a.wav">替代文本</audio>`,
+		`<mstts:silence type="Sentenceboundary-exact" value="200ms"/>`,
+		`<mstts:silence type="comma-exact" value="50ms"/>`,
+		`<mstts:viseme type="redlips_front"/>`,
+		`<mstts:backgroundaudio src="https://example.com/bg.wav" volume="0.7"/>`,
+		`<mark name="a"/>`,
+	} {
+		doc := `<speak version="1.0" xmlns="http://www.w3.org/2001/10/synthesis" xmlns:mstts="http://www.w3.org/2001/mstts" xml:lang="zh-CN">` +
+			`<voice name="zh-CN-XiaoxiaoNeural">` + content + `</voice></speak>`
+		for _, target := range []string{"/api/ra", "/api/azure"} {
+			w := httptest.NewRecorder()
+			s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, strings.NewReader(doc)))
+			if w.Code != http.StatusOK || e.last.Ssml != doc {
+				t.Fatalf("%s %s: %d %s", target, content, w.Code, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestGenLegadoJson(t *testing.T) {
+	data, err := genLegadoJson("http://localhost/api/azure", "晓晓", "zh-CN-XiaoxiaoNeural", "", "cheerful", "1.5", "Girl",
+		"audio-24khz-48kbitrate-mono-mp3", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var legado LegadoJson
+	if err := json.Unmarshal(data, &legado); err != nil {
+		t.Fatal(err)
+	}
+	want := `<voice name=\"zh-CN-XiaoxiaoNeural\"><mstts:express-as style=\"cheerful\" styledegree=\"1.5\" role=\"Girl\">` +
+		`<prosody rate=\"` + rateVar + `%\" pitch=\"+0Hz\">` + textVar2 + `</prosody></mstts:express-as></voice></speak>"}`
+	if !strings.HasSuffix(legado.URL, want) {
+		t.Fatal(legado.URL)
+	}
+}
+
+/* 合成时生成Creation的SSML, 记录在last.Ssml */
+type creationSsmlEngine struct{ fakeEngine }
+
+func (e *creationSsmlEngine) Synthesize(ctx context.Context, req *tts.SpeakRequest) ([]byte, error) {
+	req.Ssml = creation.ToSsml(req.Text, req.Voice)
+	return e.fakeEngine.Synthesize(ctx, req)
+}
+
+func TestLegadoCreationEscape(t *testing.T) {
+	e := &creationSsmlEngine{}
+	s := newTestServer(map[string]tts.Engine{tts.EngineCreation: e})
+
+	data, err := genLegadoCreationJson("http://localhost/api/creation", "晓晓", &CreationJson{VoiceName: "zh-CN-XiaoxiaoNeural",
+		VoiceId: "5f55541d-c844-4e04-a7f8-1723ffbea4a9", Format: "audio-24khz-48kbitrate-mono-mp3"}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var legado LegadoJson
+	if err = json.Unmarshal(data, &legado); err != nil {
+		t.Fatal(err)
+	}
+	/* 模拟阅读替换变量 */
+	text, _ := json.Marshal(`don't & "<me>" \`)
+	body := strings.TrimSuffix(strings.TrimSpace(legado.URL[strings.Index(legado.URL, `"body":`)+len(`"body":`):]), "}")
+	body = strings.Replace(strings.Replace(body, textVar, string(text), 1), rateVar, "0", 1)
+
+	w := httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/creation", strings.NewReader(body)))
+	if w.Code != http.StatusOK || e.last.Text != `don't & "<me>" \` {
+		t.Fatalf("%d: %s %+v", w.Code, body, e.last)
+	}
+	if want := `>don't &amp; \"&lt;me&gt;\" \\</prosody>`; !strings.Contains(e.last.Ssml, want) {
+		t.Fatal(e.last.Ssml)
+	}
+
+	/* 旧版阅读配置: 文本已在客户端转义 */
+	body = `{"text":"don&apos;t &amp; &quot;&lt;me&gt;&quot;","voiceName":"zh-CN-XiaoxiaoNeural","voiceId":"1","rate":"0","volume":"0"}`
+	w = httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/creation", strings.NewReader(body)))
+	if want := `>don't &amp; \"&lt;me&gt;\"</prosody>`; w.Code != http.StatusOK || !strings.Contains(e.last.Ssml, want) {
+		t.Fatalf("%d: %s", w.Code, e.last.Ssml)
+	}
+}
+
+func TestTextBody(t *testing.T) {
+	edge, azure := &fakeEngine{}, &fakeEngine{}
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: edge, tts.EngineAzure: azure})
+
+	post := func(target, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		s.serveMux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/api/ra?voice=zh-CN-YunxiNeural&rate=10", "text/plain; charset=utf-8", "a<b")
+	if w.Code != http.StatusOK || edge.last.Format != "audio-24khz-48kbitrate-mono-mp3" ||
+		!strings.Contains(edge.last.Ssml, `<voice name="zh-CN-YunxiNeural"><prosody rate="10%" volume="0%" pitch="0%">a&lt;b</prosody>`) {
+		t.Fatalf("%d: %+v", w.Code, edge.last)
+	}
+
+	w = post("/api/azure?style=cheerful&code=read", "text/markdown", "# 标题\n\n```\nx\n```")
+	if w.Code != http.StatusOK || !strings.Contains(azure.last.Ssml,
+		`<mstts:express-as style="cheerful" styledegree="0.0" role="default"><prosody rate="0%" volume="0%" pitch="0%"><emphasis level="strong">标题</emphasis><break time="700ms"/>x</prosody>`) {
+		t.Fatalf("%d: %+v", w.Code, azure.last)
+	}
+
+	/* 以<speak开头时仍作为SSML */
+	if w = post("/api/ra", "text/plain", "<speak/>"); w.Code != http.StatusOK || edge.last.Ssml != "<speak/>" {
+		t.Fatalf("%d: %+v", w.Code, edge.last)
+	}
+	for target, body := range map[string]string{"/api/ra": " \n", "/api/ra?rate=x": "你好", "/api/azure?code=x": "你好"} {
+		if w = post(target, "text/markdown", body); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: %d", target, w.Code)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	e := &fakeEngine{}
+	s := &GracefulServer{Engines: tts.NewRegistry(), Profiles: map[string]*config.Profile{
+		"en": {Voice: "en-US-JennyNeural", Normalize: normalize.ModeSayAs}}}
+	s.Engines.Register(tts.EngineEdge, e)
+	s.Engines.Register(tts.EngineCreation, e)
+	s.HandleFunc()
+	get := func(target string) int {
+		w := httptest.NewRecorder()
+		s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w.Code
+	}
+
+	if code := get("/api/tts?text=" + url.QueryEscape("第3章 50%") + "&normalize=expand"); code != http.StatusOK ||
+		!strings.Contains(e.last.Ssml, ">第三章 百分之五十<") {
+		t.Fatalf("%d: %+v", code, e.last)
+	}
+	if code := get("/api/tts?text=2nd&profile=en"); code != http.StatusOK ||
+		!strings.Contains(e.last.Ssml, `<say-as interpret-as="ordinal">2</say-as>`) {
+		t.Fatalf("%d: %+v", code, e.last)
+	}
+	if code := get("/api/tts?engine=creation&voiceId=1&text=5km&normalize=say-as"); code != http.StatusOK || e.last.Text != "五公里" {
+		t.Fatalf("%d: %+v", code, e.last)
+	}
+	if code := get("/api/tts?text=1&normalize=x"); code != http.StatusBadRequest {
+		t.Fatal(code)
+	}
+}
+
+func TestBreakerStatus(t *testing.T) {
+	closeErr := &websocket.CloseError{Code: websocket.CloseAbnormalClosure}
+	e := &fakeEngine{errs: []error{closeErr, closeErr, closeErr}}
+	s := &GracefulServer{Engines: tts.NewRegistry(), RetryAttempts: 3, RetryDelay: -1,
+		Breakers: &retry.Breakers{Threshold: 2, Cooldown: time.Minute}}
+	s.Engines.Register(tts.EngineEdge, e)
+	s.Engines.Register(tts.EngineAzure, &fakeEngine{})
+	s.HandleFunc()
+
+	/* 连续失败2次后熔断, 不再请求上游 */
+	w := httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/ra", strings.NewReader("<speak/>")))
+	if w.Code != http.StatusInternalServerError || e.calls != 2 || !strings.Contains(w.Body.String(), retry.ErrOpen.Error()) {
+		t.Fatalf("%d, calls: %d, %s", w.Code, e.calls, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	var status StatusJson
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil || len(status.Engines) != 2 {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+	for _, st := range status.Engines {
+		want := retry.StateClosed
+		if st.Name == tts.EngineEdge {
+			want = retry.StateOpen
+		}
+		if st.State != want {
+			t.Fatalf("%+v", st)
+		}
+	}
+}
+
+func TestEdgeEndpoints(t *testing.T) {
+	e := &edge.Engine{Endpoints: &edge.Endpoints{IpList: []string{"1.1.1.1", "2.2.2.2"},
+		Probe: func(_ context.Context, ip string) (time.Duration, error) {
+			if ip == "1.1.1.1" {
+				return 0, errors.New("connection refused")
+			}
+			return 10 * time.Millisecond, nil
+		}}}
+	defer e.Close()
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: e})
+
+	w := httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/edge/endpoints", nil))
+	var nodes []edge.NodeStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &nodes); err != nil || len(nodes) != 2 {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+	if nodes[0].IP != "2.2.2.2" || nodes[0].Rank != 1 || nodes[1].Rank != 0 || nodes[1].LastError == "" {
+		t.Fatalf("%+v", nodes)
+	}
+
+	w = httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/edge/endpoints", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"rank":1`) {
+		t.Fatalf("%d: %s", w.Code, w.Body.String())
+	}
+}
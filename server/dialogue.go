@@ -0,0 +1,272 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jing332/tts-server-go/config"
+	"github.com/jing332/tts-server-go/tts"
+	"github.com/jing332/tts-server-go/tts/audio"
+	"github.com/jing332/tts-server-go/tts/cache"
+	"github.com/jing332/tts-server-go/tts/dialogue"
+	"github.com/jing332/tts-server-go/tts/lexicon"
+	"github.com/jing332/tts-server-go/tts/normalize"
+	"github.com/jing332/tts-server-go/tts/segment"
+	"github.com/jing332/tts-server-go/tts/ssml"
+	log "github.com/sirupsen/logrus"
+)
+
+// 多发音人对话的合成方式
+const (
+	DialogueModeSsml     = "ssml"     // 一个SSML包含多个voice元素, Edge不支持
+	DialogueModeRequests = "requests" // 每个发音人的段落单独请求
+)
+
+const (
+	dialogueMaxRequestRunes = 1000 /* 单独请求时每段的最大字数 */
+	dialogueMaxSsmlRunes    = 2000 /* 多个voice元素时每个SSML的最大字数 */
+	dialogueDefaultVoice    = "zh-CN-XiaoxiaoNeural"
+	dialogueDefaultFormat   = "audio-24khz-48kbitrate-mono-mp3"
+)
+
+// DialogueJson 多发音人对话合成请求, 引号内的文本使用对话发音人, 其余为旁白
+type DialogueJson struct {
+	Engine   string                     `json:"engine"` // edge(默认), azure
+	Format   string                     `json:"format"`
+	Mode     string                     `json:"mode"` // ssml 或 requests, 默认Azure为ssml, Edge为requests
+	Text     string                     `json:"text"`
+	Narrator *config.Profile            `json:"narrator"` // 旁白
+	Dialogue *config.Profile            `json:"dialogue"` // 未识别说话人的对话, 默认同旁白
+	Speakers map[string]*config.Profile `json:"speakers"` // 说话人名称: 发音人, 按对话前后旁白中的名称识别
+	// Normalize 文本规范化: say-as, expand, 为空时使用各发音人的设置
+	Normalize string `json:"normalize"`
+}
+
+/* 发音人及其预设中的替换规则与规范化方式 */
+type dialogueVoice struct {
+	voice     *tts.VoiceProperty
+	lexicon   *lexicon.Lexicon
+	normalize string
+}
+
+/* 使用同一发音人朗读的连续文本 */
+type dialoguePart struct {
+	*dialogueVoice
+	text string
+}
+
+/* 多发音人对话合成接口, 返回拼接后的一个音频文件 */
+func (s *GracefulServer) dialogueAPIHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if r.Method != http.MethodPost {
+		writeErrorData(w, http.StatusMethodNotAllowed, "仅支持POST请求")
+		return
+	}
+	if !s.verifyToken(w, r) {
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	log.Infoln("接收到Json(对话):", string(body))
+	var reqData DialogueJson
+	if err := json.Unmarshal(body, &reqData); err != nil {
+		writeErrorData(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	name, docs, err := s.dialogueDocs(&reqData)
+	if err != nil {
+		writeErrorData(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	engine, err := s.Engines.Get(name)
+	if err != nil {
+		writeErrorData(w, http.StatusNotFound, fmt.Sprintf("%s: %v", name, err))
+		return
+	}
+
+	key := cache.Key(name, reqData.Format+"|dialogue", strings.Join(docs, "\n"))
+	contentType := formatContentType(reqData.Format)
+	if data, ok := s.Cache.Get(key); ok {
+		log.Infof("命中缓存: %s", key)
+		w.Header().Set("X-Cache", "HIT")
+		if err := writeData(w, data, contentType); err != nil {
+			log.Warnln(err)
+		}
+		return
+	}
+	w.Header().Set("X-Cache", "MISS")
+
+	startTime := time.Now()
+	ctx, cancel := context.WithTimeout(r.Context(), s.SynthesizeTimeout*time.Duration(len(docs)))
+	defer cancel()
+	chunks := make([][]byte, 0, len(docs))
+	for i, doc := range docs {
+		result, err := s.synthesizeRetry(ctx, name, engine, &tts.SpeakRequest{Ssml: doc, Format: reqData.Format})
+		if err != nil {
+			writeErrorData(w, http.StatusInternalServerError, fmt.Sprintf("获取音频失败(%s, 第%d段): %v", name, i+1, err))
+			return
+		}
+		chunks = append(chunks, result.audio)
+	}
+	data, err := audio.Join(reqData.Format, chunks)
+	if err != nil {
+		writeErrorData(w, http.StatusInternalServerError, "拼接音频失败: "+err.Error())
+		return
+	}
+	log.Infof("对话合成完成, 共%d段, 大小：%dKB, 耗时: %dms", len(docs), len(data)/1024, time.Since(startTime).Milliseconds())
+
+	if err := s.Cache.Put(key, data); err != nil {
+		log.Warnln("写入缓存失败:", err)
+	}
+	if err := writeData(w, data, contentType); err != nil {
+		log.Warnln(err)
+	}
+}
+
+/* 校验请求并补全默认值, 返回引擎名称与依次合成的SSML */
+func (s *GracefulServer) dialogueDocs(reqData *DialogueJson) (string, []string, error) {
+	engine := reqData.Engine
+	if engine == "" {
+		engine = tts.EngineEdge
+	}
+	if engine == tts.EngineCreation {
+		return "", nil, fmt.Errorf("Creation不支持对话合成")
+	}
+	if strings.TrimSpace(reqData.Text) == "" {
+		return "", nil, fmt.Errorf("text 不能为空")
+	}
+	mode := reqData.Mode
+	if mode == "" {
+		mode = DialogueModeRequests
+		if engine == tts.EngineAzure {
+			mode = DialogueModeSsml
+		}
+	}
+	if mode != DialogueModeSsml && mode != DialogueModeRequests {
+		return "", nil, fmt.Errorf("不支持的合成方式: %s", mode)
+	}
+	if !normalize.ValidMode(reqData.Normalize) {
+		return "", nil, fmt.Errorf("不支持的规范化方式: %s", reqData.Normalize)
+	}
+	if reqData.Format == "" {
+		reqData.Format = dialogueDefaultFormat
+		if reqData.Narrator != nil && reqData.Narrator.Format != "" {
+			reqData.Format = reqData.Narrator.Format
+		}
+	}
+
+	parts, err := dialogueParts(reqData, engine)
+	if err != nil {
+		return "", nil, err
+	}
+	docs := dialogueSsml(parts, mode, s.Lexicon)
+	for _, doc := range docs {
+		if err := ssml.Validate(doc); err != nil {
+			return "", nil, err
+		}
+	}
+	return engine, docs, nil
+}
+
+/* 切分旁白与对话, 合并相邻的同一发音人文本 */
+func dialogueParts(reqData *DialogueJson, engine string) ([]dialoguePart, error) {
+	voice := func(field string, p *config.Profile) (*dialogueVoice, error) {
+		if p == nil {
+			return &dialogueVoice{voice: tts.NewVoiceProperty(engine, dialogueDefaultVoice), normalize: reqData.Normalize}, nil
+		}
+		if !normalize.ValidMode(p.Normalize) {
+			return nil, fmt.Errorf("%s.normalize 不支持: %s", field, p.Normalize)
+		}
+		v := &dialogueVoice{voice: p.VoiceProperty(engine), normalize: p.Normalize}
+		if reqData.Normalize != "" {
+			v.normalize = reqData.Normalize
+		}
+		if v.voice.VoiceName == "" {
+			v.voice.VoiceName = dialogueDefaultVoice
+		}
+		if len(p.Lexicon) > 0 {
+			var err error
+			if v.lexicon, err = lexicon.New(p.Lexicon); err != nil {
+				return nil, fmt.Errorf("%s.lexicon: %w", field, err)
+			}
+		}
+		return v, nil
+	}
+	narrator, err := voice("narrator", reqData.Narrator)
+	if err != nil {
+		return nil, err
+	}
+	quoted := narrator
+	if reqData.Dialogue != nil {
+		if quoted, err = voice("dialogue", reqData.Dialogue); err != nil {
+			return nil, err
+		}
+	}
+	names := make([]string, 0, len(reqData.Speakers))
+	for name := range reqData.Speakers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	speakers := make(map[string]*dialogueVoice, len(names))
+	for _, name := range names {
+		if speakers[name], err = voice("speakers."+name, reqData.Speakers[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	var parts []dialoguePart
+	for _, seg := range dialogue.Split(reqData.Text, names) {
+		v := narrator
+		if seg.Quoted {
+			v = quoted
+			if sv, ok := speakers[seg.Speaker]; ok {
+				v = sv
+			}
+		}
+		text := strings.TrimSpace(seg.Text)
+		if n := len(parts); n > 0 && parts[n-1].dialogueVoice == v {
+			parts[n-1].text += "\n" + text
+		} else {
+			parts = append(parts, dialoguePart{dialogueVoice: v, text: text})
+		}
+	}
+	return parts, nil
+}
+
+/* 生成SSML: requests 每段一个voice元素, ssml 将多个voice元素合并到同一SSML中, 依次应用发音人预设与全局的替换规则及文本规范化 */
+func dialogueSsml(parts []dialoguePart, mode string, global *lexicon.Lexicon) []string {
+	maxRunes := dialogueMaxRequestRunes
+	if mode == DialogueModeSsml {
+		maxRunes = dialogueMaxSsmlRunes
+	}
+
+	var docs []string
+	var nodes []ssml.Node
+	size := 0
+	flush := func() {
+		if len(nodes) > 0 {
+			docs = append(docs, (&ssml.Speak{Children: nodes}).String())
+			nodes, size = nil, 0
+		}
+	}
+	for _, part := range parts {
+		for _, text := range segment.SplitText(part.text, maxRunes) {
+			n := utf8.RuneCountInString(text)
+			if mode == DialogueModeRequests || size+n > maxRunes {
+				flush()
+			}
+			content := global.Apply(part.lexicon.Apply(ssml.Text(text))...)
+			nodes = append(nodes, part.voice.Node(normalize.Apply(voiceLocale(part.voice), part.normalize, content...)...))
+			size += n
+		}
+	}
+	flush()
+	return docs
+}
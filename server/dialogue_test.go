@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jing332/tts-server-go/tts"
+)
+
+func TestDialogue(t *testing.T) {
+	edge, azure := &fakeEngine{}, &fakeEngine{}
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: edge, tts.EngineAzure: azure})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/dialogue", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.serveMux.ServeHTTP(w, req)
+		return w
+	}
+
+	text := `张三说：“你好。”李四说：“好久不见。”他们走了。`
+	w := post(`{"text":"` + strings.ReplaceAll(text, `"`, `\"`) + `","format":"raw-24khz-16bit-mono-pcm",
+		"narrator":{"voice":"zh-CN-YunxiNeural"},"speakers":{"张三":{"voice":"zh-CN-YunyangNeural"},"李四":{"voice":"zh-CN-XiaoyiNeural"}}}`)
+	if w.Code != http.StatusOK || edge.calls != 5 {
+		t.Fatalf("%d %d: %s", w.Code, edge.calls, w.Body)
+	}
+	body := w.Body.String()
+	for _, want := range []string{`<voice name="zh-CN-YunxiNeural"><prosody rate="0%" volume="0%" pitch="0%">张三说：</prosody></voice>`,
+		`<voice name="zh-CN-YunyangNeural"><prosody rate="0%" volume="0%" pitch="0%">你好。</prosody></voice>`,
+		`<voice name="zh-CN-XiaoyiNeural"><prosody rate="0%" volume="0%" pitch="0%">好久不见。</prosody></voice>`} {
+		if !strings.Contains(body, want) {
+			t.Fatal(body)
+		}
+	}
+
+	/* Azure默认将多个voice元素合并到同一SSML, 未识别说话人的对话使用 dialogue 发音人 */
+	w = post(`{"engine":"azure","text":"他说：“走吧。”","dialogue":{"voice":"zh-CN-XiaoyiNeural","style":"sad"}}`)
+	if w.Code != http.StatusOK || azure.calls != 1 || strings.Count(azure.last.Ssml, "<voice ") != 2 ||
+		!strings.Contains(azure.last.Ssml, `<voice name="zh-CN-XiaoyiNeural"><mstts:express-as style="sad"`) {
+		t.Fatalf("%d: %+v", w.Code, azure.last)
+	}
+	if w = post(`{"engine":"azure","text":"他说：“走吧。”","dialogue":{"voice":"zh-CN-XiaoyiNeural","style":"sad"}}`); w.Header().Get("X-Cache") != "HIT" {
+		t.Fatal(w.Header())
+	}
+
+	/* 规范化使用发音人的区域 */
+	if w = post(`{"engine":"azure","text":"共3章","normalize":"expand"}`); w.Code != http.StatusOK || !strings.Contains(azure.last.Ssml, ">共三章<") {
+		t.Fatalf("%d: %+v", w.Code, azure.last)
+	}
+
+	for _, body := range []string{`{"normalize":"x","text":"a"}`, `{"text":" "}`, `{"engine":"creation","text":"a"}`, `{"mode":"x","text":"a"}`, `{`} {
+		if w = post(body); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: %d", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jing332/tts-server-go/tts"
+	"github.com/jing332/tts-server-go/tts/retry"
+	"github.com/jing332/tts-server-go/tts/ssml"
+	log "github.com/sirupsen/logrus"
+)
+
+/* 主引擎的备用引擎, 只包含已注册的 */
+func (s *GracefulServer) failoverEngines(name string) []string {
+	policy := s.Failover[name]
+	if policy == nil {
+		return nil
+	}
+	var names []string
+	for _, next := range policy.Engines {
+		if _, err := s.Engines.Get(next); err == nil && next != name {
+			names = append(names, next)
+		}
+	}
+	return names
+}
+
+/* 主引擎重试后仍失败时, 按策略依次使用备用引擎合成, 返回实际使用的引擎 */
+func (s *GracefulServer) synthesizeFailover(ctx context.Context, name string, engine tts.Engine, req *tts.SpeakRequest) (*speakResult, string, error) {
+	result, err := s.synthesizeRetry(ctx, name, engine, req)
+	if err == nil {
+		return result, name, nil
+	}
+	if badRequest(err) {
+		return nil, "", err
+	}
+	for _, next := range s.failoverEngines(name) {
+		if ctx.Err() != nil {
+			break
+		}
+		nextReq, convErr := s.failoverRequest(ctx, name, next, req)
+		if convErr != nil {
+			log.Warnf("无法切换到%s: %v", next, convErr)
+			continue
+		}
+		log.Warnf("%s合成失败, 切换到%s: %v", name, next, err)
+		nextEngine, _ := s.Engines.Get(next)
+		if result, err = s.synthesizeRetry(ctx, next, nextEngine, nextReq); err == nil {
+			return result, next, nil
+		} else if badRequest(err) {
+			break
+		}
+	}
+	return nil, "", err
+}
+
+/* 请求本身有误(如SSML格式错误)时, 换用备用引擎结果相同, 不切换 */
+func badRequest(err error) bool {
+	return retry.Classify(err) == retry.KindSsml
+}
+
+/*
+转为备用引擎的请求, 发音人按策略映射, 未映射时使用同名发音人。
+SSML转为Edge时去除Edge不支持的express-as; 转为Creation时使用第一个发音人与纯文本, 发音人ID从发音人列表查找
+*/
+func (s *GracefulServer) failoverRequest(ctx context.Context, from, to string, req *tts.SpeakRequest) (*tts.SpeakRequest, error) {
+	mapVoice := func(name string) string {
+		if mapped := s.Failover[from].Voices[name][to]; mapped != "" {
+			return mapped
+		}
+		return name
+	}
+	next := &tts.SpeakRequest{Format: req.Format, WordBoundary: req.WordBoundary, SentenceBoundary: req.SentenceBoundary,
+		OnBoundary: req.OnBoundary}
+
+	if req.Ssml == "" { /* Creation的纯文本请求 */
+		if req.Voice == nil {
+			return nil, fmt.Errorf("缺少发音人")
+		}
+		voice := *req.Voice
+		voice.Api = tts.EngineApi(to)
+		voice.VoiceName = mapVoice(voice.VoiceName)
+		if to == tts.EngineCreation {
+			next.Text, next.Voice = req.Text, &voice
+		} else {
+			next.Ssml = speakSsml(&voice, ssml.Text(req.Text))
+		}
+		return next, nil
+	}
+
+	doc, err := ssml.Parse(req.Ssml)
+	if err != nil {
+		return nil, err
+	}
+	if to == tts.EngineCreation {
+		var name string
+		ssml.Map(doc.Children, func(n ssml.Node) ssml.Node {
+			if v, ok := n.(*ssml.Voice); ok && name == "" {
+				name = v.Name
+			}
+			return n
+		})
+		if name == "" {
+			return nil, fmt.Errorf("SSML中没有发音人")
+		}
+		id, err := s.creationVoiceId(ctx, mapVoice(name))
+		if err != nil {
+			return nil, err
+		}
+		next.Voice = tts.NewVoiceProperty(to, mapVoice(name))
+		next.Voice.VoiceId = id
+		next.Text = ssml.PlainText(doc)
+		return next, nil
+	}
+
+	doc.Children = ssml.Map(doc.Children, func(n ssml.Node) ssml.Node {
+		switch t := n.(type) {
+		case *ssml.Voice:
+			t.Name = mapVoice(t.Name)
+		case *ssml.ExpressAs:
+			if to == tts.EngineEdge {
+				return ssml.Fragment(t.Children)
+			}
+		}
+		return n
+	})
+	next.Ssml = doc.String()
+	return next, nil
+}
+
+/* 在Creation发音人列表中按名称或ID查找发音人ID */
+func (s *GracefulServer) creationVoiceId(ctx context.Context, name string) (string, error) {
+	voices, err := s.voices.get(ctx, s.Engines, tts.EngineCreation)
+	if err != nil {
+		return "", err
+	}
+	for _, v := range voices {
+		if v.ShortName == name || v.Id == name {
+			return v.Id, nil
+		}
+	}
+	return "", fmt.Errorf("Creation发音人不存在: %s", name)
+}
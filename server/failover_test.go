@@ -0,0 +1,69 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jing332/tts-server-go/config"
+	"github.com/jing332/tts-server-go/tts"
+	"github.com/jing332/tts-server-go/tts/retry"
+)
+
+func TestFailover(t *testing.T) {
+	down := errors.New("down")
+	edge := &fakeEngine{errs: []error{down, down, down}}
+	azure := &fakeEngine{errs: []error{down, down, down}}
+	creation := &fakeEngine{voices: []tts.Voice{{Engine: tts.EngineCreation, Id: "id-yunxi", ShortName: "zh-CN-YunxiNeural"}}}
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: edge, tts.EngineAzure: azure, tts.EngineCreation: creation})
+	s.RetryDelay = -1
+	s.Failover = map[string]*config.Failover{tts.EngineAzure: {Engines: []string{tts.EngineEdge, tts.EngineCreation},
+		Voices: map[string]map[string]string{"zh-CN-XiaoxiaoNeural": {tts.EngineCreation: "zh-CN-YunxiNeural"}}}}
+
+	post := func(target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(`<speak><voice name="zh-CN-XiaoxiaoNeural">`+
+			`<mstts:express-as style="sad"><prosody rate="10%">你好</prosody></mstts:express-as></voice></speak>`))
+		for k := range header {
+			req.Header.Set(k, header.Get(k))
+		}
+		w := httptest.NewRecorder()
+		s.serveMux.ServeHTTP(w, req)
+		return w
+	}
+
+	/* Azure与Edge均失败, 使用Creation */
+	w := post("/api/azure", nil)
+	if w.Code != http.StatusOK || w.Header().Get("X-TTS-Engine") != tts.EngineCreation || azure.calls != 3 || edge.calls != 3 {
+		t.Fatalf("%d %v: %d %d", w.Code, w.Header(), azure.calls, edge.calls)
+	}
+	if creation.last.Text != "你好" || creation.last.Voice.VoiceId != "id-yunxi" || creation.last.Voice.VoiceName != "zh-CN-YunxiNeural" {
+		t.Fatalf("%+v %+v", creation.last, creation.last.Voice)
+	}
+
+	/* 转为Edge时去除express-as */
+	azure.errs = []error{down, down, down}
+	w = post("/api/azure?stream=true", http.Header{"Format": {"webm-24khz-16bit-mono-opus"}})
+	if w.Code != http.StatusOK || w.Header().Get("X-TTS-Engine") != tts.EngineEdge || strings.Contains(edge.last.Ssml, "express-as") ||
+		!strings.Contains(edge.last.Ssml, `<voice name="zh-CN-XiaoxiaoNeural"><prosody rate="10%">你好</prosody></voice>`) {
+		t.Fatalf("%d %v: %+v", w.Code, w.Header(), edge.last)
+	}
+
+	/* 请求本身有误时不切换 */
+	s.Breakers = &retry.Breakers{} /* 前面的请求已使Azure熔断 */
+	edge.calls, creation.calls = 0, 0
+	bad := &tts.StatusError{Code: http.StatusBadRequest}
+	for _, target := range []string{"/api/azure", "/api/azure?stream=true"} {
+		azure.errs = []error{bad}
+		if w = post(target, http.Header{"Format": {"audio-16khz-32kbitrate-mono-mp3"}}); w.Code != http.StatusInternalServerError || edge.calls != 0 || creation.calls != 0 {
+			t.Fatalf("%s: %d %d %d", target, w.Code, edge.calls, creation.calls)
+		}
+	}
+
+	/* 没有策略时直接失败 */
+	edge.errs = []error{down, down, down}
+	if w = post("/api/ra", nil); w.Code != http.StatusInternalServerError {
+		t.Fatalf("%d", w.Code)
+	}
+}
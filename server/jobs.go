@@ -0,0 +1,412 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jing332/tts-server-go/config"
+	"github.com/jing332/tts-server-go/tts"
+	"github.com/jing332/tts-server-go/tts/audio"
+	"github.com/jing332/tts-server-go/tts/cache"
+	"github.com/jing332/tts-server-go/tts/lexicon"
+	"github.com/jing332/tts-server-go/tts/normalize"
+	"github.com/jing332/tts-server-go/tts/segment"
+	"github.com/jing332/tts-server-go/tts/ssml"
+	log "github.com/sirupsen/logrus"
+)
+
+// 任务状态
+const (
+	JobQueued   = "queued"
+	JobRunning  = "running"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+)
+
+// JobJson 长文本合成任务请求, 按段依次合成后拼接为一个音频文件
+type JobJson struct {
+	Engine    string          `json:"engine"` // edge(默认), azure, creation
+	Format    string          `json:"format"` // 为空时使用预设或 audio-24khz-48kbitrate-mono-mp3
+	Text      string          `json:"text"`
+	Profile   string          `json:"profile"` // 发音人预设, 同 /api/tts 的 profile 参数
+	Voice     *config.Profile `json:"voice"`   // 发音人设置, 优先于预设
+	Normalize string          `json:"normalize"`
+}
+
+// JobStatusJson 任务进度
+type JobStatusJson struct {
+	Id       string         `json:"id"`
+	State    string         `json:"state"` // queued, running, done, failed, canceled
+	Engine   string         `json:"engine"`
+	Format   string         `json:"format"`
+	Total    int            `json:"total"` // 总段数
+	Done     int            `json:"done"`  // 已完成段数
+	Errors   []JobErrorJson `json:"errors,omitempty"`
+	Size     int            `json:"size,omitempty"` // 完成后的音频大小
+	Created  time.Time      `json:"created"`
+	Started  *time.Time     `json:"started,omitempty"`
+	Finished *time.Time     `json:"finished,omitempty"`
+}
+
+// JobErrorJson 合成失败的段
+type JobErrorJson struct {
+	Segment int    `json:"segment"` // 从1开始
+	Error   string `json:"error"`
+}
+
+/* 合成任务, 由工作协程按段合成 */
+type job struct {
+	id     string
+	engine string
+	format string
+	reqs   []*tts.SpeakRequest
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	lock     sync.Mutex
+	state    string
+	done     int
+	errors   []JobErrorJson
+	audio    []byte
+	created  time.Time
+	started  time.Time
+	finished time.Time
+}
+
+func (j *job) status() *JobStatusJson {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	st := &JobStatusJson{Id: j.id, State: j.state, Engine: j.engine, Format: j.format, Total: len(j.reqs), Done: j.done,
+		Errors: j.errors, Size: len(j.audio), Created: j.created}
+	if !j.started.IsZero() {
+		started := j.started
+		st.Started = &started
+	}
+	if !j.finished.IsZero() {
+		finished := j.finished
+		st.Finished = &finished
+	}
+	return st
+}
+
+/* 结束任务, 已结束时不修改并返回false */
+func (j *job) finish(state string, data []byte) bool {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.state == JobDone || j.state == JobFailed || j.state == JobCanceled {
+		return false
+	}
+	j.state, j.audio, j.finished = state, data, time.Now()
+	j.cancel()
+	return true
+}
+
+/* 任务队列与工作协程, 首次提交任务时启动 */
+type jobQueue struct {
+	once  sync.Once
+	lock  sync.Mutex
+	jobs  map[string]*job
+	queue chan *job
+}
+
+func newJobId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+/* 提交任务, 队列已满时返回false */
+func (s *GracefulServer) submitJob(j *job) bool {
+	s.jobs.once.Do(func() {
+		s.jobs.jobs = make(map[string]*job)
+		s.jobs.queue = make(chan *job, s.JobQueueSize)
+		for i := 0; i < s.JobWorkers; i++ {
+			go s.jobWorker()
+		}
+	})
+
+	s.jobs.lock.Lock()
+	defer s.jobs.lock.Unlock()
+	select {
+	case s.jobs.queue <- j:
+		s.jobs.jobs[j.id] = j
+		return true
+	default:
+		return false
+	}
+}
+
+/* 结束任务, 保留 JobTTL 后删除, 释放音频占用的内存 */
+func (s *GracefulServer) finishJob(j *job, state string, data []byte) {
+	if !j.finish(state, data) {
+		return
+	}
+	time.AfterFunc(s.JobTTL, func() {
+		s.jobs.lock.Lock()
+		defer s.jobs.lock.Unlock()
+		if s.jobs.jobs[j.id] == j {
+			delete(s.jobs.jobs, j.id)
+		}
+	})
+}
+
+func (s *GracefulServer) getJob(id string) *job {
+	s.jobs.lock.Lock()
+	defer s.jobs.lock.Unlock()
+	return s.jobs.jobs[id]
+}
+
+func (s *GracefulServer) jobWorker() {
+	for j := range s.jobs.queue {
+		s.runJob(j)
+	}
+}
+
+/* 依次合成各段, 与 /api/tts 共用缓存, 失败时按重试与故障转移策略处理, 仍失败则结束任务 */
+func (s *GracefulServer) runJob(j *job) {
+	j.lock.Lock()
+	if j.state != JobQueued { /* 排队时已取消 */
+		j.lock.Unlock()
+		return
+	}
+	j.state, j.started = JobRunning, time.Now()
+	j.lock.Unlock()
+
+	engine, err := s.Engines.Get(j.engine)
+	if err != nil {
+		j.lock.Lock()
+		j.errors = append(j.errors, JobErrorJson{Segment: 1, Error: err.Error()})
+		j.lock.Unlock()
+		s.finishJob(j, JobFailed, nil)
+		return
+	}
+
+	chunks := make([][]byte, 0, len(j.reqs))
+	for i, req := range j.reqs {
+		if j.ctx.Err() != nil {
+			return
+		}
+		key := cache.Key(j.engine, req.Format+"|", cacheContent(req))
+		data, ok := s.Cache.Get(key)
+		if !ok {
+			ctx, cancel := context.WithTimeout(j.ctx, s.SynthesizeTimeout)
+			var result *speakResult
+			result, _, err = s.synthesizeFailover(ctx, j.engine, engine, req)
+			cancel()
+			if err != nil {
+				if j.ctx.Err() != nil {
+					return /* 已取消 */
+				}
+				log.Warnf("任务%s第%d段合成失败: %v", j.id, i+1, err)
+				j.lock.Lock()
+				j.errors = append(j.errors, JobErrorJson{Segment: i + 1, Error: err.Error()})
+				j.lock.Unlock()
+				s.finishJob(j, JobFailed, nil)
+				return
+			}
+			data = result.audio
+			if err := s.Cache.Put(key, data); err != nil {
+				log.Warnln("写入缓存失败:", err)
+			}
+		}
+		chunks = append(chunks, data)
+		j.lock.Lock()
+		j.done = i + 1
+		j.lock.Unlock()
+	}
+
+	data, err := audio.Join(j.format, chunks)
+	if err != nil {
+		j.lock.Lock()
+		j.errors = append(j.errors, JobErrorJson{Segment: len(j.reqs), Error: "拼接音频失败: " + err.Error()})
+		j.lock.Unlock()
+		s.finishJob(j, JobFailed, nil)
+		return
+	}
+	s.finishJob(j, JobDone, data)
+	log.Infof("任务%s完成, 共%d段, 大小：%dKB, 耗时: %dms", j.id, len(j.reqs), len(data)/1024,
+		time.Since(j.started).Milliseconds())
+}
+
+/* 取消所有未结束的任务 */
+func (s *GracefulServer) cancelJobs() {
+	s.jobs.lock.Lock()
+	defer s.jobs.lock.Unlock()
+	for _, j := range s.jobs.jobs {
+		s.finishJob(j, JobCanceled, nil)
+	}
+}
+
+/* 任务接口: POST 提交, GET 列表 */
+func (s *GracefulServer) jobsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if !s.verifyToken(w, r) {
+		return
+	}
+	if r.Method == http.MethodGet {
+		s.jobs.lock.Lock()
+		list := make([]*JobStatusJson, 0, len(s.jobs.jobs))
+		for _, j := range s.jobs.jobs {
+			list = append(list, j.status())
+		}
+		s.jobs.lock.Unlock()
+		sort.Slice(list, func(i, k int) bool { return list[i].Created.Before(list[k].Created) })
+		writeJson(w, http.StatusOK, list)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeErrorData(w, http.StatusMethodNotAllowed, "不支持的请求方法: "+r.Method)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	var reqData JobJson
+	if err := json.Unmarshal(body, &reqData); err != nil {
+		writeErrorData(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	j, err := s.newJob(&reqData)
+	if err != nil {
+		writeErrorData(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !s.submitJob(j) {
+		j.cancel()
+		writeErrorData(w, http.StatusServiceUnavailable, "任务队列已满")
+		return
+	}
+	log.Infof("已提交任务%s(%s), 共%d段", j.id, j.engine, len(j.reqs))
+	writeJson(w, http.StatusAccepted, j.status())
+}
+
+/* 单个任务: GET /api/jobs/{id} 进度, DELETE 取消(已结束时删除), GET /api/jobs/{id}/audio 下载音频 */
+func (s *GracefulServer) jobAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.verifyToken(w, r) {
+		return
+	}
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/")
+	j := s.getJob(id)
+	if j == nil || (action != "" && action != "audio") {
+		writeErrorData(w, http.StatusNotFound, "任务不存在: "+id)
+		return
+	}
+
+	switch {
+	case action == "audio" && r.Method == http.MethodGet:
+		j.lock.Lock()
+		state, data := j.state, j.audio
+		j.lock.Unlock()
+		if state != JobDone {
+			writeErrorData(w, http.StatusConflict, fmt.Sprintf("任务未完成: %s", state))
+			return
+		}
+		if err := writeAudioData(w, data, j.format); err != nil {
+			log.Warnln(err)
+		}
+	case action == "" && r.Method == http.MethodGet:
+		writeJson(w, http.StatusOK, j.status())
+	case action == "" && r.Method == http.MethodDelete:
+		if j.status().Finished != nil {
+			s.jobs.lock.Lock()
+			delete(s.jobs.jobs, id)
+			s.jobs.lock.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		s.finishJob(j, JobCanceled, nil)
+		log.Infof("已取消任务%s", id)
+		writeJson(w, http.StatusOK, j.status())
+	default:
+		writeErrorData(w, http.StatusMethodNotAllowed, "不支持的请求方法: "+r.Method)
+	}
+}
+
+/* 校验请求并切分文本, 每段生成一个合成请求 */
+func (s *GracefulServer) newJob(reqData *JobJson) (*job, error) {
+	engine := reqData.Engine
+	if engine == "" {
+		engine = tts.EngineEdge
+	}
+	if _, err := s.Engines.Get(engine); err != nil {
+		return nil, fmt.Errorf("%s: %w", engine, err)
+	}
+	if strings.TrimSpace(reqData.Text) == "" {
+		return nil, fmt.Errorf("text 不能为空")
+	}
+	if !normalize.ValidMode(reqData.Normalize) {
+		return nil, fmt.Errorf("不支持的规范化方式: %s", reqData.Normalize)
+	}
+
+	base := &tts.SpeakRequest{Format: reqData.Format}
+	v := &dialogueVoice{lexicon: s.profileLexicon(reqData.Profile), normalize: s.normalizeMode(textOptions{profile: reqData.Profile})}
+	if reqData.Profile != "" {
+		if err := s.applyProfile(reqData.Profile, engine, base); err != nil {
+			return nil, err
+		}
+	}
+	if p := reqData.Voice; p != nil {
+		if !normalize.ValidMode(p.Normalize) {
+			return nil, fmt.Errorf("voice.normalize 不支持: %s", p.Normalize)
+		}
+		base.Voice = p.VoiceProperty(engine)
+		if base.Format == "" {
+			base.Format = p.Format
+		}
+		if p.Normalize != "" {
+			v.normalize = p.Normalize
+		}
+		if len(p.Lexicon) > 0 {
+			var err error
+			if v.lexicon, err = lexicon.New(p.Lexicon); err != nil {
+				return nil, fmt.Errorf("voice.lexicon: %w", err)
+			}
+		}
+	}
+	if base.Voice == nil {
+		base.Voice = tts.NewVoiceProperty(engine, dialogueDefaultVoice)
+	} else if base.Voice.VoiceName == "" {
+		base.Voice.VoiceName = dialogueDefaultVoice
+	}
+	if base.Format == "" {
+		base.Format = dialogueDefaultFormat
+	}
+	if reqData.Normalize != "" {
+		v.normalize = reqData.Normalize
+	}
+	v.voice = base.Voice
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{id: newJobId(), engine: engine, format: base.Format, ctx: ctx, cancel: cancel, state: JobQueued, created: time.Now()}
+	if engine == tts.EngineCreation { /* 纯文本, 只执行文本替换与展开 */
+		for _, text := range segment.SplitText(reqData.Text, dialogueMaxRequestRunes) {
+			text = s.Lexicon.Replace(v.lexicon.Replace(text))
+			if v.normalize != "" {
+				text = normalize.ExpandText(voiceLocale(v.voice), text)
+			}
+			j.reqs = append(j.reqs, &tts.SpeakRequest{Text: text, Voice: v.voice, Format: base.Format})
+		}
+	} else {
+		for _, doc := range dialogueSsml([]dialoguePart{{dialogueVoice: v, text: reqData.Text}}, DialogueModeRequests, s.Lexicon) {
+			if err := ssml.Validate(doc); err != nil {
+				cancel()
+				return nil, err
+			}
+			j.reqs = append(j.reqs, &tts.SpeakRequest{Ssml: doc, Format: base.Format})
+		}
+	}
+	if len(j.reqs) == 0 {
+		cancel()
+		return nil, fmt.Errorf("text 不能为空")
+	}
+	return j, nil
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jing332/tts-server-go/tts"
+)
+
+/* 合成时阻塞直到取消 */
+type blockingEngine struct {
+	fakeEngine
+	started chan struct{}
+}
+
+func (e *blockingEngine) Synthesize(ctx context.Context, _ *tts.SpeakRequest) ([]byte, error) {
+	e.started <- struct{}{}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (e *blockingEngine) SynthesizeStream(ctx context.Context, req *tts.SpeakRequest, _ func([]byte)) error {
+	_, err := e.Synthesize(ctx, req)
+	return err
+}
+
+/* 约2500字, 每句不同, 避免段之间命中缓存 */
+func longText() string {
+	var b strings.Builder
+	for i := 0; i < 100; i++ {
+		b.WriteString("这是第" + strconv.Itoa(i) + "个很长的句子，用来测试长文本的分段合成。")
+	}
+	return b.String()
+}
+
+func serveJob(s *GracefulServer, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+/* 等待任务结束 */
+func waitJob(t *testing.T, s *GracefulServer, id string) *JobStatusJson {
+	for i := 0; i < 200; i++ {
+		var st JobStatusJson
+		w := serveJob(s, http.MethodGet, "/api/jobs/"+id, "")
+		if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil {
+			t.Fatalf("%v: %s", err, w.Body.String())
+		}
+		if st.Finished != nil {
+			return &st
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("job timeout")
+	return nil
+}
+
+func TestJobs(t *testing.T) {
+	e := &fakeEngine{}
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: e})
+
+	text := longText()
+	w := serveJob(s, http.MethodPost, "/api/jobs", `{"text":"`+text+`","format":"raw-24khz-16bit-mono-pcm",
+		"voice":{"voice":"zh-CN-YunxiNeural","rate":10}}`)
+	var st JobStatusJson
+	if err := json.Unmarshal(w.Body.Bytes(), &st); w.Code != http.StatusAccepted || err != nil || st.Total < 2 {
+		t.Fatalf("%d %v: %s", w.Code, err, w.Body.String())
+	}
+
+	done := waitJob(t, s, st.Id)
+	if done.State != JobDone || done.Done != done.Total || e.calls != done.Total {
+		t.Fatalf("%+v, calls: %d", done, e.calls)
+	}
+	w = serveJob(s, http.MethodGet, "/api/jobs/"+st.Id+"/audio", "")
+	if w.Code != http.StatusOK || strings.Count(w.Body.String(), "<speak") != done.Total ||
+		!strings.Contains(w.Body.String(), `<voice name="zh-CN-YunxiNeural"><prosody rate="10%"`) {
+		t.Fatalf("%d: %s", w.Code, w.Body.String())
+	}
+
+	/* 相同内容命中缓存 */
+	w = serveJob(s, http.MethodPost, "/api/jobs", `{"text":"`+text+`","format":"raw-24khz-16bit-mono-pcm",
+		"voice":{"voice":"zh-CN-YunxiNeural","rate":10}}`)
+	_ = json.Unmarshal(w.Body.Bytes(), &st)
+	if done = waitJob(t, s, st.Id); done.State != JobDone || e.calls != done.Total {
+		t.Fatalf("%+v, calls: %d", done, e.calls)
+	}
+
+	w = serveJob(s, http.MethodGet, "/api/jobs", "")
+	var list []JobStatusJson
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list) != 2 {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+	if w = serveJob(s, http.MethodDelete, "/api/jobs/"+st.Id, ""); w.Code != http.StatusNoContent {
+		t.Fatal(w.Code)
+	}
+	if w = serveJob(s, http.MethodGet, "/api/jobs/"+st.Id, ""); w.Code != http.StatusNotFound {
+		t.Fatal(w.Code)
+	}
+
+	for _, body := range []string{`{"text":" "}`, `{"engine":"google","text":"a"}`, `{"normalize":"x","text":"a"}`,
+		`{"profile":"missing","text":"a"}`, `{`} {
+		if w = serveJob(s, http.MethodPost, "/api/jobs", body); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: %d", body, w.Code)
+		}
+	}
+}
+
+func TestJobFailed(t *testing.T) {
+	e := &fakeEngine{errs: []error{nil, &tts.StatusError{Code: http.StatusBadRequest, Status: "400 Bad Request", Err: errors.New("bad ssml")}}}
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: e})
+
+	text := longText()
+	w := serveJob(s, http.MethodPost, "/api/jobs", `{"text":"`+text+`","format":"raw-24khz-16bit-mono-pcm"}`)
+	var st JobStatusJson
+	_ = json.Unmarshal(w.Body.Bytes(), &st)
+	done := waitJob(t, s, st.Id)
+	if done.State != JobFailed || done.Done != 1 || len(done.Errors) != 1 || done.Errors[0].Segment != 2 || e.calls != 2 {
+		t.Fatalf("%+v", done)
+	}
+	if w = serveJob(s, http.MethodGet, "/api/jobs/"+st.Id+"/audio", ""); w.Code != http.StatusConflict {
+		t.Fatal(w.Code)
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	e := &blockingEngine{started: make(chan struct{}, 1)}
+	s := &GracefulServer{Engines: tts.NewRegistry(), JobWorkers: 1}
+	s.Engines.Register(tts.EngineEdge, e)
+	s.HandleFunc()
+
+	var running, queued JobStatusJson
+	_ = json.Unmarshal(serveJob(s, http.MethodPost, "/api/jobs", `{"text":"第一个任务"}`).Body.Bytes(), &running)
+	_ = json.Unmarshal(serveJob(s, http.MethodPost, "/api/jobs", `{"text":"第二个任务"}`).Body.Bytes(), &queued)
+	<-e.started
+
+	/* 取消排队中的任务, 不会再合成 */
+	if w := serveJob(s, http.MethodDelete, "/api/jobs/"+queued.Id, ""); w.Code != http.StatusOK {
+		t.Fatal(w.Code)
+	}
+	if w := serveJob(s, http.MethodDelete, "/api/jobs/"+running.Id, ""); w.Code != http.StatusOK {
+		t.Fatal(w.Code)
+	}
+	for _, id := range []string{running.Id, queued.Id} {
+		if st := waitJob(t, s, id); st.State != JobCanceled {
+			t.Fatalf("%+v", st)
+		}
+	}
+	select {
+	case <-e.started:
+		t.Fatal("canceled job should not run")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestJobExpire(t *testing.T) {
+	s := &GracefulServer{Engines: tts.NewRegistry(), JobTTL: 50 * time.Millisecond}
+	s.Engines.Register(tts.EngineEdge, &fakeEngine{})
+	s.HandleFunc()
+
+	var st JobStatusJson
+	_ = json.Unmarshal(serveJob(s, http.MethodPost, "/api/jobs", `{"text":"你好"}`).Body.Bytes(), &st)
+	if done := waitJob(t, s, st.Id); done.State != JobDone {
+		t.Fatalf("%+v", done)
+	}
+	/* 无新任务提交时, 过期的任务也会被删除 */
+	time.Sleep(100 * time.Millisecond)
+	if w := serveJob(s, http.MethodGet, "/api/jobs/"+st.Id, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("%d: %s", w.Code, w.Body.String())
+	}
+}
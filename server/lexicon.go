@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/jing332/tts-server-go/tts"
+	"github.com/jing332/tts-server-go/tts/lexicon"
+	"github.com/jing332/tts-server-go/tts/ssml"
+	log "github.com/sirupsen/logrus"
+)
+
+/* 预设中的替换规则, 首次使用时创建 */
+func (s *GracefulServer) profileLexicon(name string) *lexicon.Lexicon {
+	p, ok := s.Profiles[name]
+	if !ok || len(p.Lexicon) == 0 {
+		return nil
+	}
+	if l, ok := s.profileLexicons.Load(name); ok {
+		return l.(*lexicon.Lexicon)
+	}
+	l, err := lexicon.New(p.Lexicon)
+	if err != nil {
+		log.Warnf("预设 %s 的替换规则无效: %v", name, err)
+		return nil
+	}
+	actual, _ := s.profileLexicons.LoadOrStore(name, l)
+	return actual.(*lexicon.Lexicon)
+}
+
+/* 依次应用预设与全局的替换规则 */
+func (s *GracefulServer) applyLexicon(profile string, nodes ...ssml.Node) []ssml.Node {
+	return s.Lexicon.Apply(s.profileLexicon(profile).Apply(nodes...)...)
+}
+
+/* 替换规则管理: GET 查看, POST 添加(PLS文件批量导入), PUT ?id= 修改, DELETE ?id= 删除(无id时清空) */
+func (s *GracefulServer) lexiconAPIHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if !s.verifyToken(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJson(w, http.StatusOK, s.Lexicon.Rules())
+	case http.MethodPost:
+		body, _ := io.ReadAll(r.Body)
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if strings.HasSuffix(mediaType, "xml") || strings.HasPrefix(strings.TrimSpace(string(body)), "<") {
+			s.importPls(w, body)
+			return
+		}
+		var rule lexicon.Rule
+		if err := json.Unmarshal(body, &rule); err != nil {
+			writeErrorData(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		rule, err := s.Lexicon.Add(rule)
+		if err != nil {
+			writeErrorData(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Infof("已添加替换规则: %+v", rule)
+		writeJson(w, http.StatusCreated, rule)
+	case http.MethodPut:
+		var rule lexicon.Rule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			writeErrorData(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if id := r.URL.Query().Get("id"); id != "" {
+			rule.Id = id
+		}
+		rule, err := s.Lexicon.Update(rule)
+		if errors.Is(err, lexicon.ErrNotFound) {
+			writeErrorData(w, http.StatusNotFound, "替换规则不存在: "+rule.Id)
+			return
+		} else if err != nil {
+			writeErrorData(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Infof("已修改替换规则: %+v", rule)
+		writeJson(w, http.StatusOK, rule)
+	case http.MethodDelete:
+		if id := r.URL.Query().Get("id"); id != "" {
+			if !s.Lexicon.Delete(id) {
+				writeErrorData(w, http.StatusNotFound, "替换规则不存在: "+id)
+				return
+			}
+		} else {
+			s.Lexicon.Clear()
+		}
+		log.Infoln("已删除替换规则")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeErrorData(w, http.StatusMethodNotAllowed, "不支持的请求方法: "+r.Method)
+	}
+}
+
+/* 导入PLS词典中的所有规则, 任一规则无效时都不导入, 返回添加的规则 */
+func (s *GracefulServer) importPls(w http.ResponseWriter, data []byte) {
+	rules, err := lexicon.ParsePls(data)
+	if err != nil {
+		writeErrorData(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	added, err := s.Lexicon.AddAll(rules)
+	if err != nil {
+		writeErrorData(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Infof("已导入%d条替换规则", len(added))
+	writeJson(w, http.StatusCreated, added)
+}
+
+/* 预览应用替换规则后发送给引擎的SSML(Creation为纯文本), 参数与 /api/tts 相同 */
+func (s *GracefulServer) lexiconPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.verifyToken(w, r) {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeErrorData(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	text := r.Form.Get("text")
+	if strings.TrimSpace(text) == "" {
+		writeErrorData(w, http.StatusBadRequest, "text 不能为空")
+		return
+	}
+	engine := r.Form.Get("engine")
+	if engine == "" {
+		engine = tts.EngineEdge
+	}
+
+	req := &tts.SpeakRequest{}
+	if err := s.queryVoice(r.Form, engine, req); err != nil {
+		writeErrorData(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.setText(req, engine, queryTextOptions(r.Form), text)
+	if engine == tts.EngineCreation {
+		_ = writeData(w, []byte(req.Text), "text/plain; charset=utf-8")
+	} else {
+		_ = writeData(w, []byte(req.Ssml), "application/ssml+xml; charset=utf-8")
+	}
+}
+
+func writeJson(w http.ResponseWriter, statusCode int, v any) {
+	data, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(data)
+}
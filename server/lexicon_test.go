@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jing332/tts-server-go/config"
+	"github.com/jing332/tts-server-go/tts"
+	"github.com/jing332/tts-server-go/tts/lexicon"
+)
+
+func TestLexiconAPI(t *testing.T) {
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: &fakeEngine{}})
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.serveMux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/lexicon", `{"pattern":"TTS","replacement":"语音合成"}`)
+	var rule lexicon.Rule
+	if err := json.Unmarshal(w.Body.Bytes(), &rule); err != nil || w.Code != http.StatusCreated || rule.Id != "1" {
+		t.Fatalf("%d: %s", w.Code, w.Body)
+	}
+	if w = do(http.MethodPost, "/api/lexicon", `{"type":"regex","pattern":"("}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("%d: %s", w.Code, w.Body)
+	}
+	if w = do(http.MethodPut, "/api/lexicon?id=1", `{"type":"sub","pattern":"TTS","replacement":"语音合成"}`); w.Code != http.StatusOK {
+		t.Fatalf("%d: %s", w.Code, w.Body)
+	}
+	if w = do(http.MethodPut, "/api/lexicon?id=9", `{"pattern":"a"}`); w.Code != http.StatusNotFound {
+		t.Fatalf("%d: %s", w.Code, w.Body)
+	}
+
+	w = do(http.MethodPost, "/api/lexicon", `<lexicon version="1.0" xmlns="http://www.w3.org/2005/01/pronunciation-lexicon" alphabet="sapi">
+		<lexeme><grapheme>重庆</grapheme><phoneme>chong 2 qing 4</phoneme></lexeme></lexicon>`)
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"id":"2"`) {
+		t.Fatalf("%d: %s", w.Code, w.Body)
+	}
+
+	w = do(http.MethodGet, "/api/lexicon/preview?text=TTS在重庆&voice=zh-CN-YunxiNeural", "")
+	want := `<voice name="zh-CN-YunxiNeural"><prosody rate="0%" volume="0%" pitch="0%"><sub alias="语音合成">TTS</sub>在` +
+		`<phoneme alphabet="sapi" ph="chong 2 qing 4">重庆</phoneme></prosody></voice>`
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+		t.Fatalf("%d: %s", w.Code, w.Body)
+	}
+
+	if w = do(http.MethodDelete, "/api/lexicon?id=1", ""); w.Code != http.StatusNoContent || len(s.Lexicon.Rules()) != 1 {
+		t.Fatalf("%d: %+v", w.Code, s.Lexicon.Rules())
+	}
+	if w = do(http.MethodDelete, "/api/lexicon", ""); w.Code != http.StatusNoContent || len(s.Lexicon.Rules()) != 0 {
+		t.Fatalf("%d: %+v", w.Code, s.Lexicon.Rules())
+	}
+}
+
+func TestProfileLexicon(t *testing.T) {
+	e := &fakeEngine{}
+	global, _ := lexicon.New([]lexicon.Rule{{Pattern: "km", Replacement: "公里"}, {Pattern: "甲", Replacement: "全局"}})
+	s := &GracefulServer{Engines: tts.NewRegistry(), Lexicon: global, Profiles: map[string]*config.Profile{
+		"a": {Voice: "zh-CN-YunxiNeural", Lexicon: []lexicon.Rule{{Pattern: "甲", Replacement: "预设"}}}}}
+	s.Engines.Register(tts.EngineEdge, e)
+	s.Engines.Register(tts.EngineCreation, e)
+	s.HandleFunc()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tts?text=甲5km&profile=a", nil)
+	w := httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(e.last.Ssml, ">预设5公里<") {
+		t.Fatalf("%d: %+v", w.Code, e.last)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/tts?engine=creation&voiceId=1&text=甲5km", nil)
+	s.serveMux.ServeHTTP(httptest.NewRecorder(), req)
+	if e.last.Text != "全局5公里" {
+		t.Fatalf("%+v", e.last)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/creation?profile=a", strings.NewReader(`{"text":"甲5km","voiceId":"1"}`))
+	w = httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || e.last.Text != "预设5公里" {
+		t.Fatalf("%d: %+v", w.Code, e.last)
+	}
+}
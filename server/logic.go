@@ -2,11 +2,19 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/jing332/tts-server-go/tts"
+	"github.com/jing332/tts-server-go/tts/cache"
+	"github.com/jing332/tts-server-go/tts/normalize"
+	"github.com/jing332/tts-server-go/tts/ssml"
 	log "github.com/sirupsen/logrus"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -37,6 +45,25 @@ type CreationJson struct {
 	Format          string `json:"format"`
 }
 
+// SubtitleJson 音频与边界事件, 时间单位为毫秒
+type SubtitleJson struct {
+	Format     string         `json:"format"`
+	Audio      []byte         `json:"audio"` /* base64 */
+	Boundaries []BoundaryJson `json:"boundaries"`
+}
+
+type BoundaryJson struct {
+	Type     string `json:"type"`
+	Offset   int64  `json:"offset"`
+	Duration int64  `json:"duration"`
+	Text     string `json:"text"`
+}
+
+type CacheJson struct {
+	Stats   cache.Stats   `json:"stats"`
+	Entries []cache.Entry `json:"entries"`
+}
+
 func (c *CreationJson) VoiceProperty() *tts.VoiceProperty {
 	rate, err := strconv.ParseInt(removePcmChar(c.Rate), 10, 8)
 	if err != nil {
@@ -69,29 +96,27 @@ func removePcmChar(s string) string {
 }
 
 const (
-	textVar  = "{{String(speakText).replace(/&/g, '&amp;').replace(/\"/g, '&quot;').replace(/'/g, '&apos;').replace(/</g, '&lt;').replace(/>/g, '&gt;').replace(/\\/g, '')}}"
+	textVar  = "{{JSON.stringify(String(speakText))}}" /* Creation的请求体为JSON, 文本由服务端转义为SSML */
 	textVar2 = `{{String(speakText).replace(/&/g, '&amp;').replace(/\"/g, '&quot;').replace(/'/g, '&apos;').replace(/</g, '&lt;').replace(/>/g, '&gt;').replace(/\\/g, '')}}`
 	rateVar  = "{{(speakSpeed -10) * 2}}"
+
+	textPlaceholder = "{{speakText}}"
 )
 
 /* 生成阅读APP朗读朗读引擎Json (Edge, Azure) */
 func genLegadoJson(api, name, voiceName, secondaryLocale, styleName, styleDegree, roleName, voiceFormat, token, concurrentRate string) ([]byte, error) {
 	t := time.Now().UnixNano() / 1e6 //毫秒时间戳
-	var url string
-	if styleName == "" { /* Edge大声朗读 */
-		url = api + ` ,{"method":"POST","body":"<speak xmlns=\"http://www.w3.org/2001/10/synthesis\" xmlns:mstts=\"http://www.w3.org/2001/mstts\" xmlns:emo=\"http://www.w3.org/2009/10/emotionml\" version=\"1.0\" xml:lang=\"en-US\"><voice name=\"` +
-			voiceName + `\"><prosody rate=\"` + rateVar + `%\" pitch=\"+0Hz\">` + textVar2 + `</prosody></voice></speak>"}`
-	} else { /* Azure TTS */
-		if secondaryLocale == "" {
-			url = api + ` ,{"method":"POST","body":"<speak xmlns=\"http://www.w3.org/2001/10/synthesis\" xmlns:mstts=\"http://www.w3.org/2001/mstts\" xmlns:emo=\"http://www.w3.org/2009/10/emotionml\" version=\"1.0\" xml:lang=\"en-US\"><voice name=\"` +
-				voiceName + `\"><mstts:express-as style=\"` + styleName + `\" styledegree=\"` + styleDegree + `\" role=\"` + roleName +
-				`\"><prosody rate=\"` + rateVar + `%\" pitch=\"+0Hz\">` + textVar2 + `</prosody> </mstts:express-as></voice></speak>"}`
-		} else {
-			url = api + ` ,{"method":"POST","body":"<speak xmlns=\"http://www.w3.org/2001/10/synthesis\" xmlns:mstts=\"http://www.w3.org/2001/mstts\" xmlns:emo=\"http://www.w3.org/2009/10/emotionml\" version=\"1.0\" xml:lang=\"en-US\"><voice name=\"` +
-				voiceName + `\"><lang xml:lang=\"` + secondaryLocale + `\"><mstts:express-as style=\"` + styleName + `\" styledegree=\"` + styleDegree + `\" role=\"` + roleName +
-				`\"><prosody rate=\"` + rateVar + `%\" pitch=\"+0Hz\">` + textVar2 + `</prosody> </mstts:express-as></lang></voice></speak>"}`
+	var content ssml.Node = &ssml.Prosody{Rate: rateVar + "%", Pitch: "+0Hz", Children: []ssml.Node{ssml.Raw(textPlaceholder)}}
+	if styleName != "" { /* Azure TTS */
+		content = &ssml.ExpressAs{Style: styleName, StyleDegree: styleDegree, Role: roleName, Children: []ssml.Node{content}}
+		if secondaryLocale != "" {
+			content = &ssml.Lang{Lang: secondaryLocale, Children: []ssml.Node{content}}
 		}
 	}
+	doc := &ssml.Speak{Children: []ssml.Node{&ssml.Voice{Name: voiceName, Children: []ssml.Node{content}}}}
+	/* 阅读的请求体为JS字符串, 转义引号后再插入文本变量 */
+	speakBody := strings.Replace(strings.ReplaceAll(doc.String(), `"`, `\"`), textPlaceholder, textVar2, 1)
+	url := api + ` ,{"method":"POST","body":"` + speakBody + `"}`
 
 	head := `{"Content-Type":"text/plain","Format":"` + voiceFormat + `", "Token":"` + token + `"}`
 	legadoJson := &LegadoJson{Name: name, URL: url, ID: t, LastUpdateTime: t, ContentType: formatContentType(voiceFormat),
@@ -107,7 +132,7 @@ func genLegadoJson(api, name, voiceName, secondaryLocale, styleName, styleDegree
 
 /* 生成阅读APP朗读引擎Json (Creation) */
 func genLegadoCreationJson(api, name string, creationJson *CreationJson, token, concurrentRate string) ([]byte, error) {
-	creationJson.Text = textVar
+	creationJson.Text = textPlaceholder
 	creationJson.Rate = rateVar
 	creationJson.Volume = "0"
 	var jsonBuf bytes.Buffer
@@ -119,7 +144,8 @@ func genLegadoCreationJson(api, name string, creationJson *CreationJson, token,
 	}
 
 	t := time.Now().UnixNano() / 1e6 //毫秒时间戳
-	url := api + `,{"method":"POST","body":` + string(jsonBuf.Bytes()) + `}`
+	reqBody := strings.Replace(jsonBuf.String(), `"`+textPlaceholder+`"`, textVar, 1)
+	url := api + `,{"method":"POST","body":` + reqBody + `}`
 	head := `{"Content-Type":"application/json", "Token":"` + token + `"}`
 
 	legadoJson := &LegadoJson{Name: name, URL: url, ID: t, LastUpdateTime: t, ContentType: formatContentType(creationJson.Format),
@@ -128,6 +154,62 @@ func genLegadoCreationJson(api, name string, creationJson *CreationJson, token,
 	return body, err
 }
 
+/* 由文本生成请求内容时的处理选项 */
+type textOptions struct {
+	profile   string // 预设名称, 使用其中的替换规则与规范化方式
+	normalize string // 文本规范化方式, 为空时使用预设中的设置
+}
+
+func queryTextOptions(params url.Values) textOptions {
+	return textOptions{profile: params.Get("profile"), normalize: params.Get("normalize")}
+}
+
+/* 依次应用替换规则与文本规范化, 规范化的区域由发音人名称确定 */
+func (s *GracefulServer) textNodes(voice *tts.VoiceProperty, opts textOptions, nodes ...ssml.Node) []ssml.Node {
+	nodes = s.applyLexicon(opts.profile, nodes...)
+	return normalize.Apply(voiceLocale(voice), s.normalizeMode(opts), nodes...)
+}
+
+/* 设置请求的朗读内容: Creation使用纯文本, 只执行文本替换与展开, 其他引擎生成SSML */
+func (s *GracefulServer) setText(req *tts.SpeakRequest, engine string, opts textOptions, text string) {
+	if engine == tts.EngineCreation {
+		text = s.Lexicon.Replace(s.profileLexicon(opts.profile).Replace(text))
+		if s.normalizeMode(opts) != "" {
+			text = normalize.ExpandText(voiceLocale(req.Voice), text)
+		}
+		req.Text = text
+	} else {
+		req.Ssml = speakSsml(req.Voice, s.textNodes(req.Voice, opts, ssml.Text(text))...)
+	}
+}
+
+func (s *GracefulServer) normalizeMode(opts textOptions) string {
+	if opts.normalize != "" {
+		return opts.normalize
+	}
+	if p, ok := s.Profiles[opts.profile]; ok {
+		return p.Normalize
+	}
+	return ""
+}
+
+/* 发音人名称中的区域, 如 zh-CN-XiaoxiaoNeural 为 zh-CN */
+func voiceLocale(voice *tts.VoiceProperty) string {
+	if voice == nil {
+		return ""
+	}
+	parts := strings.SplitN(voice.VoiceName, "-", 3)
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[0] + "-" + parts[1]
+}
+
+/* 使用发音人朗读节点的完整SSML */
+func speakSsml(voice *tts.VoiceProperty, nodes ...ssml.Node) string {
+	return (&ssml.Speak{Children: []ssml.Node{voice.Node(nodes...)}}).String()
+}
+
 /* 根据音频格式返回对应的Content-Type */
 func formatContentType(format string) string {
 	t := strings.Split(format, "-")[0]
@@ -149,3 +231,152 @@ func formatContentType(format string) string {
 	}
 	return ""
 }
+
+/* 发音人筛选条件, 为空的条件不筛选 */
+type voiceFilter struct {
+	Locale string /* zh 匹配 zh-CN, zh-TW 等, 包括支持该语言的多语言发音人 */
+	Gender string
+	Style  string
+	Query  string /* 在名称、区域中搜索, 不区分大小写 */
+}
+
+func (f *voiceFilter) match(v *tts.Voice) bool {
+	if f.Locale != "" && !matchLocale(v.Locale, f.Locale) {
+		found := false
+		for _, l := range v.SecondaryLocales {
+			if matchLocale(l, f.Locale) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Gender != "" && !strings.EqualFold(v.Gender, f.Gender) {
+		return false
+	}
+	if f.Style != "" && !containsFold(v.Styles, f.Style) {
+		return false
+	}
+	if f.Query != "" {
+		q := strings.ToLower(f.Query)
+		for _, s := range []string{v.ShortName, v.Name, v.DisplayName, v.LocalName, v.Locale, v.LocaleName} {
+			if strings.Contains(strings.ToLower(s), q) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchLocale(locale, prefix string) bool {
+	return strings.EqualFold(locale, prefix) ||
+		len(locale) > len(prefix) && strings.EqualFold(locale[:len(prefix)], prefix) && locale[len(prefix)] == '-'
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+/* 各引擎发音人列表的内存缓存 */
+type voicesCache struct {
+	lock    sync.Mutex
+	entries map[string]*voicesCacheEntry
+}
+
+type voicesCacheEntry struct {
+	voices []tts.Voice
+	expire time.Time
+}
+
+/* 获取多个引擎的发音人, 结果在内存中缓存1小时, 失败的引擎返回错误信息 */
+func (c *voicesCache) catalog(ctx context.Context, engines *tts.Registry, names []string) (voices []tts.Voice, errs []string) {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			list, err := c.get(ctx, engines, name)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				log.Warnf("获取发音人失败(%s): %v", name, err)
+				errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+				return
+			}
+			voices = append(voices, list...)
+		}(name)
+	}
+	wg.Wait()
+
+	sort.SliceStable(voices, func(i, j int) bool {
+		a, b := &voices[i], &voices[j]
+		if a.Engine != b.Engine {
+			return a.Engine < b.Engine
+		}
+		if a.Locale != b.Locale {
+			return a.Locale < b.Locale
+		}
+		return a.ShortName < b.ShortName
+	})
+	return voices, errs
+}
+
+func (c *voicesCache) get(ctx context.Context, engines *tts.Registry, name string) ([]tts.Voice, error) {
+	c.lock.Lock()
+	entry, ok := c.entries[name]
+	c.lock.Unlock()
+	if ok && time.Now().Before(entry.expire) {
+		return entry.voices, nil
+	}
+
+	engine, err := engines.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	voices, err := engine.Voices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range voices {
+		if voices[i].Engine == "" {
+			voices[i].Engine = name
+		}
+	}
+
+	c.lock.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]*voicesCacheEntry)
+	}
+	c.entries[name] = &voicesCacheEntry{voices: voices, expire: time.Now().Add(time.Hour)}
+	c.lock.Unlock()
+	return voices, nil
+}
+
+/* 按引擎顺序合并发音人, 同名发音人只保留靠前的引擎, 获取失败的引擎被跳过 */
+func (c *voicesCache) unique(ctx context.Context, engines *tts.Registry, names []string) []tts.Voice {
+	var voices []tts.Voice
+	seen := make(map[string]bool)
+	for _, name := range names {
+		list, err := c.get(ctx, engines, name)
+		if err != nil {
+			log.Warnf("获取发音人失败(%s): %v", name, err)
+			continue
+		}
+		for _, v := range list {
+			if !seen[v.ShortName] {
+				seen[v.ShortName] = true
+				voices = append(voices, v)
+			}
+		}
+	}
+	return voices
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/jing332/tts-server-go/tts"
+	log "github.com/sirupsen/logrus"
+)
+
+/* MaryTTS接口使用的引擎, 同名发音人使用靠前的引擎 */
+var maryEngines = []string{tts.EngineEdge, tts.EngineAzure}
+
+const maryFormat = "riff-24khz-16bit-mono-pcm"
+
+/* 已注册的MaryTTS引擎 */
+func (s *GracefulServer) maryEngineNames() []string {
+	var names []string
+	for _, name := range maryEngines {
+		if _, err := s.Engines.Get(name); err == nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+/* MaryTTS的区域使用下划线: zh_CN */
+func maryLocale(locale string) string {
+	return strings.ReplaceAll(locale, "-", "_")
+}
+
+/* MaryTTS发音人列表, 每行为: 名称 区域 性别 类型 */
+func (s *GracefulServer) maryVoicesHandler(w http.ResponseWriter, r *http.Request) {
+	var sb strings.Builder
+	for _, v := range s.voices.unique(r.Context(), s.Engines, s.maryEngineNames()) {
+		sb.WriteString(v.ShortName + " " + maryLocale(v.Locale) + " " + strings.ToLower(v.Gender) + " neural\n")
+	}
+	_ = writeData(w, []byte(sb.String()), "text/plain; charset=utf-8")
+}
+
+/* MaryTTS支持的区域, 每行一个 */
+func (s *GracefulServer) maryLocalesHandler(w http.ResponseWriter, r *http.Request) {
+	seen := make(map[string]bool)
+	var locales []string
+	for _, v := range s.voices.unique(r.Context(), s.Engines, s.maryEngineNames()) {
+		if locale := maryLocale(v.Locale); locale != "" && !seen[locale] {
+			seen[locale] = true
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales)
+	_ = writeData(w, []byte(strings.Join(locales, "\n")+"\n"), "text/plain; charset=utf-8")
+}
+
+/* MaryTTS合成接口, GET参数或POST表单: INPUT_TEXT, INPUT_TYPE, OUTPUT_TYPE, LOCALE, VOICE, AUDIO, 返回WAV */
+func (s *GracefulServer) maryProcessHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.verifyToken(w, r) {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeErrorData(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	text := r.Form.Get("INPUT_TEXT")
+	log.Infoln("接收到文本(MaryTTS):", text)
+	if strings.TrimSpace(text) == "" {
+		writeErrorData(w, http.StatusBadRequest, "INPUT_TEXT 不能为空")
+		return
+	}
+	if t := r.Form.Get("INPUT_TYPE"); t != "" && t != "TEXT" {
+		writeErrorData(w, http.StatusBadRequest, "不支持的INPUT_TYPE: "+t)
+		return
+	}
+	if t := r.Form.Get("OUTPUT_TYPE"); t != "" && t != "AUDIO" {
+		writeErrorData(w, http.StatusBadRequest, "不支持的OUTPUT_TYPE: "+t)
+		return
+	}
+	if t := r.Form.Get("AUDIO"); t != "" && t != "WAVE_FILE" {
+		writeErrorData(w, http.StatusBadRequest, "不支持的AUDIO: "+t)
+		return
+	}
+
+	names := s.maryEngineNames()
+	if len(names) == 0 {
+		writeErrorData(w, http.StatusNotFound, "没有可用的引擎")
+		return
+	}
+	voice, engine := s.maryVoice(r, names, r.Form.Get("VOICE"), r.Form.Get("LOCALE"))
+	if voice == "" {
+		writeErrorData(w, http.StatusBadRequest, "没有该区域的发音人: "+r.Form.Get("LOCALE"))
+		return
+	}
+
+	req := &tts.SpeakRequest{Voice: tts.NewVoiceProperty(engine, voice), Format: maryFormat}
+	s.setText(req, engine, textOptions{}, text)
+	s.speak(w, r, engine, req)
+}
+
+/* 按发音人名称选择, 不存在时(如MaryTTS自带的cmu-slt-hsmm)使用该区域的第一个发音人 */
+func (s *GracefulServer) maryVoice(r *http.Request, names []string, name, locale string) (voice, engine string) {
+	voices := s.voices.unique(r.Context(), s.Engines, names)
+	for _, v := range voices {
+		if v.ShortName == name {
+			return v.ShortName, v.Engine
+		}
+	}
+	if len(voices) == 0 && strings.Contains(name, "-") { /* 无法获取发音人列表 */
+		return name, names[0]
+	}
+	if locale == "" {
+		locale = "zh-CN"
+	}
+
+	locale = strings.ReplaceAll(locale, "_", "-")
+	for _, v := range voices {
+		if matchLocale(v.Locale, locale) {
+			return v.ShortName, v.Engine
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jing332/tts-server-go/tts"
+)
+
+func TestMaryTTS(t *testing.T) {
+	edge := &fakeEngine{voices: []tts.Voice{
+		{ShortName: "zh-CN-XiaoxiaoNeural", Locale: "zh-CN", Gender: "Female"},
+		{ShortName: "en-US-GuyNeural", Locale: "en-US", Gender: "Male"},
+	}}
+	azure := &fakeEngine{voices: []tts.Voice{
+		{ShortName: "zh-CN-XiaoxiaoNeural", Locale: "zh-CN", Gender: "Female"},
+		{ShortName: "de-DE-KatjaNeural", Locale: "de-DE", Gender: "Female"},
+	}}
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: edge, tts.EngineAzure: azure})
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	want := "zh-CN-XiaoxiaoNeural zh_CN female neural\nen-US-GuyNeural en_US male neural\nde-DE-KatjaNeural de_DE female neural\n"
+	if w := get("/voices"); w.Body.String() != want {
+		t.Fatalf("%s", w.Body.String())
+	}
+	if w := get("/locales"); w.Body.String() != "de_DE\nen_US\nzh_CN\n" {
+		t.Fatalf("%s", w.Body.String())
+	}
+
+	/* HA默认的MaryTTS发音人不存在时按区域选择 */
+	w := get("/process?INPUT_TEXT=hi&INPUT_TYPE=TEXT&OUTPUT_TYPE=AUDIO&AUDIO=WAVE_FILE&LOCALE=en_US&VOICE=cmu-slt-hsmm")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "audio/x-wav" ||
+		edge.last.Format != maryFormat || !strings.Contains(edge.last.Ssml, `<voice name="en-US-GuyNeural">`) {
+		t.Fatalf("%d: %+v", w.Code, edge.last)
+	}
+
+	form := url.Values{"INPUT_TEXT": {"Hallo"}, "VOICE": {"de-DE-KatjaNeural"}}
+	req := httptest.NewRequest(http.MethodPost, "/process", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || azure.last == nil || !strings.Contains(azure.last.Ssml, "de-DE-KatjaNeural") {
+		t.Fatalf("%d: %+v", w.Code, azure.last)
+	}
+
+	for _, target := range []string{"/process?INPUT_TEXT=", "/process?INPUT_TEXT=hi&AUDIO=AU_FILE", "/process?INPUT_TEXT=hi&LOCALE=fr_FR"} {
+		if w := get(target); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: %d", target, w.Code)
+		}
+	}
+}
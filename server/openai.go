@@ -0,0 +1,215 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jing332/tts-server-go/tts"
+	log "github.com/sirupsen/logrus"
+)
+
+/* OpenAI模型名对应的引擎, 引擎名本身也可作为模型名 */
+var openAIModels = map[string]string{
+	"tts-1":    tts.EngineEdge,
+	"tts-1-hd": tts.EngineAzure,
+}
+
+/* OpenAI发音人别名对应的发音人 */
+var openAIVoices = map[string]string{
+	"alloy":   "zh-CN-XiaoxiaoNeural",
+	"echo":    "zh-CN-YunxiNeural",
+	"fable":   "zh-CN-YunxiaNeural",
+	"onyx":    "zh-CN-YunyangNeural",
+	"nova":    "zh-CN-XiaoyiNeural",
+	"shimmer": "zh-CN-liaoning-XiaobeiNeural",
+}
+
+/* response_format 对应的音频格式 */
+var openAIFormats = map[string]string{
+	"mp3":  "audio-24khz-48kbitrate-mono-mp3",
+	"opus": "ogg-24khz-16bit-mono-opus",
+	"wav":  "riff-24khz-16bit-mono-pcm",
+	"pcm":  "raw-24khz-16bit-mono-pcm",
+}
+
+const openAIMaxInput = 4096 /* 与OpenAI一致的最大输入长度 */
+
+// OpenAISpeechJson OpenAI /v1/audio/speech 请求
+type OpenAISpeechJson struct {
+	Model          string   `json:"model"`
+	Input          string   `json:"input"`
+	Voice          string   `json:"voice"` // 别名(alloy等)、发音人(zh-CN-XiaoxiaoNeural)或预设名称
+	ResponseFormat string   `json:"response_format"`
+	Speed          *float64 `json:"speed"`
+}
+
+type OpenAIModelJson struct {
+	Id      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type openAIErrorJson struct {
+	Error struct {
+		Message string  `json:"message"`
+		Type    string  `json:"type"`
+		Param   *string `json:"param"`
+		Code    *string `json:"code"`
+	} `json:"error"`
+}
+
+/* 以OpenAI的格式返回错误 */
+func writeOpenAIError(w http.ResponseWriter, statusCode int, param, message string) {
+	log.Warnln(message)
+	var e openAIErrorJson
+	e.Error.Message = message
+	e.Error.Type = "invalid_request_error"
+	if param != "" {
+		e.Error.Param = &param
+	}
+	data, _ := json.Marshal(&e)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(data)
+}
+
+/* Authorization: Bearer <Token> */
+func (s *GracefulServer) verifyBearer(w http.ResponseWriter, r *http.Request) bool {
+	if s.Token == "" {
+		return true
+	}
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != s.Token {
+		log.Warnf("无效的Token: %s, 远程地址: %s", token, r.RemoteAddr)
+		writeOpenAIError(w, http.StatusUnauthorized, "", "无效的API Key")
+		return false
+	}
+	return true
+}
+
+/* 兼容OpenAI的语音合成接口 */
+func (s *GracefulServer) openAISpeechHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if r.Method != http.MethodPost {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "", "不支持的请求方法: "+r.Method)
+		return
+	}
+	if !s.verifyBearer(w, r) {
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	log.Infoln("接收到Json(OpenAI):", string(body))
+	var reqData OpenAISpeechJson
+	if err := json.Unmarshal(body, &reqData); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+
+	engine, req, param, err := s.openAISpeakRequest(&reqData)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, param, err.Error())
+		return
+	}
+	s.speak(w, r, engine, req)
+}
+
+/* 转为合成请求, 失败时返回出错的参数名 */
+func (s *GracefulServer) openAISpeakRequest(reqData *OpenAISpeechJson) (engine string, req *tts.SpeakRequest, param string, err error) {
+	engine, ok := openAIModels[reqData.Model]
+	if !ok {
+		engine = reqData.Model
+	}
+	if _, err := s.Engines.Get(engine); err != nil {
+		return "", nil, "model", fmt.Errorf("不支持的模型: %s", reqData.Model)
+	}
+
+	if strings.TrimSpace(reqData.Input) == "" {
+		return "", nil, "input", fmt.Errorf("input 不能为空")
+	}
+	if utf8.RuneCountInString(reqData.Input) > openAIMaxInput {
+		return "", nil, "input", fmt.Errorf("input 不能超过%d个字符", openAIMaxInput)
+	}
+
+	req = &tts.SpeakRequest{}
+	profileName := ""
+	if profile, ok := s.Profiles[reqData.Voice]; ok { /* 预设 */
+		profileName = reqData.Voice
+		if profile.Engine != "" && profile.Engine != engine {
+			return "", nil, "voice", fmt.Errorf("预设 %s 仅适用于 %s", reqData.Voice, profile.Engine)
+		}
+		req.Voice = profile.VoiceProperty(engine)
+		req.Format = profile.Format
+	} else {
+		name := reqData.Voice
+		if alias, ok := openAIVoices[strings.ToLower(name)]; ok {
+			name = alias
+		} else if !strings.Contains(name, "-") {
+			return "", nil, "voice", fmt.Errorf("不支持的发音人: %s", reqData.Voice)
+		}
+		if engine == tts.EngineCreation {
+			return "", nil, "voice", fmt.Errorf("Creation需使用包含发音人ID的预设")
+		}
+		req.Voice = tts.NewVoiceProperty(engine, name)
+	}
+
+	if reqData.Speed != nil {
+		speed := *reqData.Speed
+		if speed < 0.25 || speed > 4 {
+			return "", nil, "speed", fmt.Errorf("speed 应在0.25-4.0之间: %v", speed)
+		}
+		req.Voice.Prosody.Rate = speedToRate(speed)
+	}
+
+	if reqData.ResponseFormat != "" || req.Format == "" {
+		responseFormat := reqData.ResponseFormat
+		if responseFormat == "" {
+			responseFormat = "mp3"
+		}
+		format, ok := openAIFormats[responseFormat]
+		if !ok {
+			return "", nil, "response_format", fmt.Errorf("不支持的格式: %s", responseFormat)
+		}
+		req.Format = format
+	}
+
+	s.setText(req, engine, textOptions{profile: profileName}, reqData.Input)
+	return engine, req, "", nil
+}
+
+/* 语速倍数转为百分比, 受int8限制最大为127% */
+func speedToRate(speed float64) int8 {
+	rate := math.Round((speed - 1) * 100)
+	if rate > math.MaxInt8 {
+		rate = math.MaxInt8
+	}
+	return int8(rate)
+}
+
+/* 可用的模型 */
+func (s *GracefulServer) openAIModelsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.verifyBearer(w, r) {
+		return
+	}
+
+	ids := s.Engines.Names()
+	for model, engine := range openAIModels {
+		if _, err := s.Engines.Get(engine); err == nil {
+			ids = append(ids, model)
+		}
+	}
+	sort.Strings(ids)
+
+	models := make([]OpenAIModelJson, 0, len(ids))
+	for _, id := range ids {
+		models = append(models, OpenAIModelJson{Id: id, Object: "model", OwnedBy: "tts-server-go"})
+	}
+	data, _ := json.Marshal(map[string]any{"object": "list", "data": models})
+	_ = writeData(w, data, "application/json; charset=utf-8")
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jing332/tts-server-go/tts"
+)
+
+func TestOpenAISpeech(t *testing.T) {
+	edge, azure := &fakeEngine{}, &fakeEngine{}
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: edge, tts.EngineAzure: azure})
+	s.Token = "abc"
+
+	post := func(body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/audio/speech", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.serveMux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post(`{"model":"tts-1","input":"a<b","voice":"alloy","speed":1.5}`, "abc")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "audio/mpeg" {
+		t.Fatalf("%d: %s", w.Code, w.Body.String())
+	}
+	if edge.last.Format != "audio-24khz-48kbitrate-mono-mp3" || edge.last.Voice.Prosody.Rate != 50 ||
+		!strings.Contains(edge.last.Ssml, `<voice name="zh-CN-XiaoxiaoNeural"><prosody rate="50%"`) ||
+		!strings.Contains(edge.last.Ssml, "a&lt;b") {
+		t.Fatalf("%+v", edge.last)
+	}
+
+	w = post(`{"model":"tts-1-hd","input":"你好","voice":"en-US-JennyNeural","response_format":"wav"}`, "abc")
+	if w.Code != http.StatusOK || azure.last.Format != "riff-24khz-16bit-mono-pcm" || azure.last.Voice.Api != tts.ApiAzure {
+		t.Fatalf("%d: %+v", w.Code, azure.last)
+	}
+
+	tests := []struct {
+		body, param string
+	}{
+		{`{"model":"tts-2","input":"你好","voice":"alloy"}`, "model"},
+		{`{"model":"tts-1","input":"","voice":"alloy"}`, "input"},
+		{`{"model":"tts-1","input":"你好","voice":"bob"}`, "voice"},
+		{`{"model":"tts-1","input":"你好","voice":"alloy","speed":5}`, "speed"},
+		{`{"model":"tts-1","input":"你好","voice":"alloy","response_format":"flac"}`, "response_format"},
+	}
+	for _, tt := range tests {
+		w = post(tt.body, "abc")
+		var e openAIErrorJson
+		if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || w.Code != http.StatusBadRequest ||
+			e.Error.Param == nil || *e.Error.Param != tt.param {
+			t.Fatalf("%s: %d %s", tt.body, w.Code, w.Body.String())
+		}
+	}
+
+	if w = post(`{"model":"tts-1","input":"你好","voice":"alloy"}`, "x"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("code: %d", w.Code)
+	}
+}
+
+func TestOpenAIModels(t *testing.T) {
+	s := newTestServer(map[string]tts.Engine{tts.EngineEdge: &fakeEngine{}})
+
+	w := httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	var models struct {
+		Data []OpenAIModelJson `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &models); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, m := range models.Data {
+		ids = append(ids, m.Id)
+	}
+	if strings.Join(ids, ",") != "edge,tts-1" {
+		t.Fatalf("%v", ids)
+	}
+}
+
+func TestSpeedToRate(t *testing.T) {
+	for speed, want := range map[float64]int8{0.25: -75, 1: 0, 1.234: 23, 2: 100, 4: 127} {
+		if rate := speedToRate(speed); rate != want {
+			t.Fatalf("%v: %d", speed, rate)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/jing332/tts-server-go/tts"
+	"github.com/jing332/tts-server-go/tts/edge"
+	"github.com/jing332/tts-server-go/tts/retry"
+)
+
+// StatusJson 服务状态
+type StatusJson struct {
+	Engines []retry.Status `json:"engines"` // 各引擎熔断器状态
+}
+
+/* 服务状态: GET 查看各已注册引擎的熔断器状态 */
+func (s *GracefulServer) statusAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.verifyToken(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeErrorData(w, http.StatusMethodNotAllowed, "不支持的请求方法: "+r.Method)
+		return
+	}
+	for _, name := range s.Engines.Names() { /* 未请求过的引擎也显示为关闭 */
+		s.Breakers.Get(name)
+	}
+	writeJson(w, http.StatusOK, &StatusJson{Engines: s.Breakers.Status()})
+}
+
+/* Edge节点排名: GET 查看, POST 立即重新探测 */
+func (s *GracefulServer) edgeEndpointsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.verifyToken(w, r) {
+		return
+	}
+	engine, err := s.Engines.Get(tts.EngineEdge)
+	if err != nil {
+		writeErrorData(w, http.StatusNotFound, fmt.Sprintf("%s: %v", tts.EngineEdge, err))
+		return
+	}
+	e, ok := engine.(*edge.Engine)
+	if !ok {
+		writeErrorData(w, http.StatusNotFound, "Edge引擎不支持节点管理")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJson(w, http.StatusOK, e.Nodes())
+	case http.MethodPost:
+		writeJson(w, http.StatusOK, e.ProbeNodes(r.Context()))
+	default:
+		writeErrorData(w, http.StatusMethodNotAllowed, "不支持的请求方法: "+r.Method)
+	}
+}
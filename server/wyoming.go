@@ -0,0 +1,461 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jing332/tts-server-go/tts"
+	"github.com/jing332/tts-server-go/tts/audio"
+	"github.com/jing332/tts-server-go/tts/azure"
+	"github.com/jing332/tts-server-go/tts/edge"
+	"github.com/jing332/tts-server-go/tts/lexicon"
+	"github.com/jing332/tts-server-go/tts/retry"
+	"github.com/jing332/tts-server-go/tts/ssml"
+	log "github.com/sirupsen/logrus"
+)
+
+const wyomingVersion = "1.5.3"
+
+// WyomingServer Home Assistant 的 Wyoming 协议TTS服务, 通过TCP提供发音人列表与PCM音频
+type WyomingServer struct {
+	// Engines 已注册的TTS引擎, 为空时使用内置的 Edge, Azure
+	Engines *tts.Registry
+	// EngineNames 提供发音人的引擎, 默认 edge, azure, 同名发音人使用靠前的引擎
+	EngineNames []string
+
+	Voice         string        // 未指定发音人时使用, 默认 zh-CN-XiaoxiaoNeural
+	Format        string        // PCM音频格式, 默认 raw-24khz-16bit-mono-pcm
+	Timeout       time.Duration // 单次合成超时, 默认60s
+	VoicesTimeout time.Duration // 获取发音人列表超时, 默认30s
+	RetryAttempts int           // 未输出音频前失败最多尝试次数, 默认3
+	RetryDelay    time.Duration // 首次重试间隔, 之后按指数退避加倍, 默认1s, 负数为不等待
+
+	// Breakers 各引擎的熔断器, 可与 GracefulServer 共用, 为空时不熔断
+	Breakers *retry.Breakers
+
+	// Lexicon 读音与文本替换规则, 可与 GracefulServer 共用
+	Lexicon *lexicon.Lexicon
+
+	lock     sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	voices   voicesCache
+}
+
+/* Wyoming事件, 每个事件为一行JSON头, 后接 data_length 字节的JSON数据与 payload_length 字节的负载 */
+type wyomingEvent struct {
+	Type    string
+	Data    json.RawMessage
+	Payload []byte
+}
+
+type wyomingHeader struct {
+	Type          string          `json:"type"`
+	Version       string          `json:"version,omitempty"`
+	Data          json.RawMessage `json:"data,omitempty"`
+	DataLength    int             `json:"data_length,omitempty"`
+	PayloadLength int             `json:"payload_length,omitempty"`
+}
+
+type wyomingAttribution struct {
+	Name string `json:"name"`
+	Url  string `json:"url"`
+}
+
+type wyomingVoice struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Attribution wyomingAttribution `json:"attribution"`
+	Installed   bool               `json:"installed"`
+	Version     *string            `json:"version"`
+	Languages   []string           `json:"languages"`
+
+	engine string
+	locale string
+}
+
+type wyomingProgram struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Attribution wyomingAttribution `json:"attribution"`
+	Installed   bool               `json:"installed"`
+	Version     string             `json:"version"`
+	Voices      []wyomingVoice     `json:"voices"`
+}
+
+type wyomingSynthesize struct {
+	Text  string `json:"text"`
+	Voice *struct {
+		Name     string `json:"name"`
+		Language string `json:"language"`
+	} `json:"voice"`
+}
+
+type wyomingAudio struct {
+	Rate      int   `json:"rate"`
+	Width     int   `json:"width"`
+	Channels  int   `json:"channels"`
+	Timestamp int64 `json:"timestamp"`
+}
+
+var microsoftAttribution = wyomingAttribution{Name: "Microsoft", Url: "https://speech.microsoft.com"}
+
+func (s *WyomingServer) init() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.Engines == nil {
+		s.Engines = tts.NewRegistry()
+		s.Engines.Register(tts.EngineEdge, &edge.Engine{})
+		s.Engines.Register(tts.EngineAzure, &azure.Engine{})
+	}
+	if len(s.EngineNames) == 0 {
+		s.EngineNames = []string{tts.EngineEdge, tts.EngineAzure}
+	}
+	if s.Voice == "" {
+		s.Voice = "zh-CN-XiaoxiaoNeural"
+	}
+	if s.Format == "" {
+		s.Format = "raw-24khz-16bit-mono-pcm"
+	}
+	if s.Timeout <= 0 {
+		s.Timeout = time.Minute
+	}
+	if s.VoicesTimeout <= 0 {
+		s.VoicesTimeout = 30 * time.Second
+	}
+	if s.RetryAttempts <= 0 {
+		s.RetryAttempts = 3
+	}
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+	}
+}
+
+// ListenAndServe 监听TCP端口
+func (s *WyomingServer) ListenAndServe(port int64) error {
+	l, err := net.Listen("tcp", ":"+strconv.FormatInt(port, 10))
+	if err != nil {
+		return err
+	}
+	log.Infof("Wyoming服务已启动, 监听端口: %d", port)
+	return s.Serve(l)
+}
+
+// Serve 在指定的Listener上接受连接, 调用Close后返回nil
+func (s *WyomingServer) Serve(l net.Listener) error {
+	s.init()
+	if _, _, _, ok := audio.PcmParams(s.Format); !ok || !strings.HasPrefix(s.Format, "raw-") {
+		_ = l.Close()
+		return fmt.Errorf("Wyoming仅支持raw PCM格式: %s", s.Format)
+	}
+
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		_ = l.Close()
+		return nil
+	}
+	s.listener = l
+	s.lock.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.lock.Lock()
+			closed := s.closed
+			s.lock.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.lock.Lock()
+		s.conns[conn] = struct{}{}
+		s.lock.Unlock()
+		go func() {
+			defer func() {
+				s.lock.Lock()
+				delete(s.conns, conn)
+				s.lock.Unlock()
+				_ = conn.Close()
+			}()
+			s.handle(conn)
+		}()
+	}
+}
+
+// Close 关闭监听并断开所有连接
+func (s *WyomingServer) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+func (s *WyomingServer) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		e, err := readWyomingEvent(r)
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				log.Warnln("读取Wyoming事件失败:", err)
+			}
+			return
+		}
+
+		switch e.Type {
+		case "describe":
+			err = s.describe(w)
+		case "synthesize":
+			err = s.synthesize(w, e)
+		case "ping":
+			err = writeWyomingEvent(w, "pong", e.Data, nil)
+		default:
+			log.Debugln("忽略Wyoming事件:", e.Type)
+		}
+		if err != nil {
+			log.Warnln("Wyoming:", err)
+			return
+		}
+	}
+}
+
+func (s *WyomingServer) describe(w *bufio.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.VoicesTimeout)
+	defer cancel()
+
+	voices := s.catalog(ctx)
+	program := wyomingProgram{Name: "tts-server-go", Description: "Microsoft Edge/Azure TTS", Attribution: microsoftAttribution,
+		Installed: true, Version: wyomingVersion, Voices: voices}
+	if program.Voices == nil {
+		program.Voices = []wyomingVoice{}
+	}
+	return writeWyomingEvent(w, "info", map[string]any{"tts": []wyomingProgram{program},
+		"asr": []any{}, "handle": []any{}, "intent": []any{}, "wake": []any{}}, nil)
+}
+
+/* 所有引擎的发音人, 同名发音人只保留靠前的引擎 */
+func (s *WyomingServer) catalog(ctx context.Context) []wyomingVoice {
+	var voices []wyomingVoice
+	for _, v := range s.voices.unique(ctx, s.Engines, s.EngineNames) {
+		description := v.LocalName
+		if description == "" {
+			description = v.DisplayName
+		}
+		voices = append(voices, wyomingVoice{Name: v.ShortName, Description: fmt.Sprintf("%s (%s)", description, v.Engine),
+			Attribution: microsoftAttribution, Installed: true, Languages: append([]string{v.Locale}, v.SecondaryLocales...),
+			engine: v.Engine, locale: v.Locale})
+	}
+	return voices
+}
+
+/* 根据发音人名称或语言选择发音人与引擎 */
+func (s *WyomingServer) selectVoice(ctx context.Context, name, language string) (voice, engine string) {
+	voices := s.catalog(ctx)
+	if name == "" && language != "" {
+		language = strings.ReplaceAll(language, "_", "-") /* zh_CN */
+		for _, v := range voices {
+			if matchLocale(v.locale, language) {
+				return v.Name, v.engine
+			}
+		}
+	}
+	if name == "" {
+		name = s.Voice
+	}
+	for _, v := range voices {
+		if v.Name == name {
+			return v.Name, v.engine
+		}
+	}
+	return name, s.EngineNames[0]
+}
+
+func (s *WyomingServer) synthesize(w *bufio.Writer, e *wyomingEvent) error {
+	var data wyomingSynthesize
+	if err := json.Unmarshal(e.Data, &data); err != nil {
+		return writeWyomingError(w, "invalid-data", err.Error())
+	}
+	if strings.TrimSpace(data.Text) == "" {
+		return writeWyomingError(w, "invalid-data", "text 不能为空")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	var name, language string
+	if data.Voice != nil {
+		name, language = data.Voice.Name, data.Voice.Language
+	}
+	voiceName, engineName := s.selectVoice(ctx, name, language)
+	engine, err := s.Engines.Get(engineName)
+	if err != nil {
+		return writeWyomingError(w, "engine", err.Error())
+	}
+	log.Infof("Wyoming合成(%s, %s): %s", engineName, voiceName, data.Text)
+
+	req := &tts.SpeakRequest{Ssml: speakSsml(tts.NewVoiceProperty(engineName, voiceName), s.Lexicon.Apply(ssml.Text(data.Text))...),
+		Format: s.Format}
+
+	rate, width, channels, _ := audio.PcmParams(s.Format)
+	params := wyomingAudio{Rate: rate, Width: width, Channels: channels}
+	if err := writeWyomingEvent(w, "audio-start", &params, nil); err != nil {
+		return err
+	}
+
+	frame := width * channels
+	var written int64
+	var buf []byte
+	var writeErr error
+	policy := retry.Policy{Attempts: s.RetryAttempts, Backoff: retry.Backoff{Base: s.RetryDelay}}
+	err = policy.Do(ctx, s.Breakers.Get(engineName), func(int) (bool, error) {
+		buf = buf[:0]
+		err := engine.SynthesizeStream(ctx, req, func(data []byte) {
+			if writeErr != nil {
+				return
+			}
+			buf = append(buf, data...)
+			n := len(buf) - len(buf)%frame /* 只发送完整的采样帧 */
+			if n == 0 {
+				return
+			}
+			params.Timestamp = written * 1000 / int64(rate*frame)
+			writeErr = writeWyomingEvent(w, "audio-chunk", &params, buf[:n])
+			written += int64(n)
+			buf = append(buf[:0], buf[n:]...)
+			if writeErr != nil {
+				cancel()
+			}
+		})
+		return written == 0 && writeErr == nil, err
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+	if err != nil {
+		_ = writeWyomingError(w, "synthesize", err.Error())
+		return fmt.Errorf("合成失败: %w", err)
+	}
+
+	params.Timestamp = written * 1000 / int64(rate*frame)
+	return writeWyomingEvent(w, "audio-stop", map[string]int64{"timestamp": params.Timestamp}, nil)
+}
+
+func writeWyomingError(w *bufio.Writer, code, text string) error {
+	log.Warnln("Wyoming错误:", text)
+	return writeWyomingEvent(w, "error", map[string]string{"text": text, "code": code}, nil)
+}
+
+/* 事件头、data与payload的最大长度, 客户端未经认证, 避免按其声明的长度分配过多内存 */
+const wyomingMaxLength = 1 << 20
+
+var errWyomingTooLarge = errors.New("事件过大")
+
+/* 读取一行事件头, 超过 wyomingMaxLength 时返回错误 */
+func readWyomingLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > wyomingMaxLength {
+			return nil, errWyomingTooLarge
+		}
+		switch err {
+		case nil:
+			return line, nil
+		case bufio.ErrBufferFull:
+			continue
+		case io.EOF:
+			if len(line) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+		}
+		return nil, err
+	}
+}
+
+func readWyomingEvent(r *bufio.Reader) (*wyomingEvent, error) {
+	line, err := readWyomingLine(r)
+	if err != nil {
+		return nil, err
+	}
+	var header wyomingHeader
+	if err := json.Unmarshal(line, &header); err != nil {
+		return nil, fmt.Errorf("无效的事件头: %w", err)
+	}
+
+	if header.DataLength > wyomingMaxLength || header.PayloadLength > wyomingMaxLength {
+		return nil, errWyomingTooLarge
+	}
+	e := &wyomingEvent{Type: header.Type, Data: header.Data}
+	if header.DataLength > 0 {
+		data := make([]byte, header.DataLength)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		if e.Data, err = mergeJson(header.Data, data); err != nil {
+			return nil, fmt.Errorf("无效的事件数据: %w", err)
+		}
+	}
+	if header.PayloadLength > 0 {
+		e.Payload = make([]byte, header.PayloadLength)
+		if _, err := io.ReadFull(r, e.Payload); err != nil {
+			return nil, err
+		}
+	}
+	if len(e.Data) == 0 {
+		e.Data = json.RawMessage("{}")
+	}
+	return e, nil
+}
+
+/* 合并事件头中的data与单独发送的data, 后者优先 */
+func mergeJson(a, b []byte) ([]byte, error) {
+	if len(a) == 0 {
+		return b, nil
+	}
+	m := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(a, &m); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+func writeWyomingEvent(w *bufio.Writer, typ string, data any, payload []byte) error {
+	var body []byte
+	if data != nil {
+		var err error
+		if body, err = json.Marshal(data); err != nil {
+			return err
+		}
+	}
+	header, err := json.Marshal(&wyomingHeader{Type: typ, Version: wyomingVersion, DataLength: len(body), PayloadLength: len(payload)})
+	if err != nil {
+		return err
+	}
+	_, _ = w.Write(header)
+	_ = w.WriteByte('\n')
+	_, _ = w.Write(body)
+	_, _ = w.Write(payload)
+	return w.Flush()
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jing332/tts-server-go/tts"
+)
+
+func TestWyoming(t *testing.T) {
+	edge := &fakeEngine{voices: []tts.Voice{{ShortName: "zh-CN-XiaoxiaoNeural", Locale: "zh-CN", LocalName: "晓晓"}}}
+	azure := &fakeEngine{voices: []tts.Voice{
+		{ShortName: "zh-CN-XiaoxiaoNeural", Locale: "zh-CN"},
+		{ShortName: "en-US-JennyNeural", Locale: "en-US", DisplayName: "Jenny"},
+	}}
+	s := &WyomingServer{Engines: tts.NewRegistry()}
+	s.Engines.Register(tts.EngineEdge, edge)
+	s.Engines.Register(tts.EngineAzure, azure)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- s.Serve(l) }()
+	defer func() {
+		s.Close()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	read := func(typ string) *wyomingEvent {
+		e, err := readWyomingEvent(r)
+		if err != nil || e.Type != typ {
+			t.Fatalf("want %s, got %+v: %v", typ, e, err)
+		}
+		return e
+	}
+
+	if err := writeWyomingEvent(w, "describe", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	var info struct {
+		Tts []wyomingProgram `json:"tts"`
+	}
+	if err := json.Unmarshal(read("info").Data, &info); err != nil || len(info.Tts) != 1 {
+		t.Fatalf("%v: %+v", err, info)
+	}
+	voices := info.Tts[0].Voices
+	if len(voices) != 2 || voices[0].Description != "晓晓 (edge)" || voices[1].Name != "en-US-JennyNeural" || voices[1].Languages[0] != "en-US" {
+		t.Fatalf("%+v", voices)
+	}
+
+	/* 旧版客户端在事件头中直接发送data */
+	_, _ = conn.Write([]byte(`{"type":"synthesize","data":{"text":"a<b","voice":{"language":"en_US"}}}` + "\n"))
+	var start wyomingAudio
+	if err := json.Unmarshal(read("audio-start").Data, &start); err != nil || start.Rate != 24000 || start.Width != 2 || start.Channels != 1 {
+		t.Fatalf("%v: %+v", err, start)
+	}
+	payload := read("audio-chunk").Payload
+	read("audio-stop")
+	if !strings.Contains(azure.last.Ssml, `<voice name="en-US-JennyNeural">`) || azure.last.Format != "raw-24khz-16bit-mono-pcm" {
+		t.Fatalf("%+v", azure.last)
+	}
+	want := []byte(azure.last.Ssml)
+	if len(payload)%2 != 0 || string(payload) != string(want[:len(want)-len(want)%2]) {
+		t.Fatalf("payload: %d", len(payload))
+	}
+
+	/* 未指定发音人时使用默认发音人, 由靠前的引擎合成 */
+	if err := writeWyomingEvent(w, "synthesize", map[string]string{"text": "你好"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	read("audio-start")
+	read("audio-chunk")
+	read("audio-stop")
+	if edge.calls != 1 || !strings.Contains(edge.last.Ssml, "zh-CN-XiaoxiaoNeural") {
+		t.Fatalf("%+v", edge.last)
+	}
+}
+
+func TestWyomingEventLimit(t *testing.T) {
+	for _, in := range []string{
+		`{"type":"synthesize","data_length":1073741824}` + "\n",
+		`{"type":"synthesize","payload_length":1073741824}` + "\n",
+		`{"type":"` + strings.Repeat("a", wyomingMaxLength) + `"}` + "\n",
+	} {
+		if _, err := readWyomingEvent(bufio.NewReader(strings.NewReader(in))); err != errWyomingTooLarge {
+			t.Fatalf("%.60s: %v", in, err)
+		}
+	}
+
+	data := `{"text":"你好"}`
+	in := `{"type":"synthesize","data_length":` + strconv.Itoa(len(data)) + "}\n" + data
+	e, err := readWyomingEvent(bufio.NewReader(strings.NewReader(in)))
+	if err != nil || e.Type != "synthesize" || string(e.Data) != data {
+		t.Fatalf("%+v: %v", e, err)
+	}
+}
@@ -17,6 +17,8 @@ func GetISOTime() string {
 }
 
 // ChunkString 根据长度分割string
+//
+// Deprecated: 会在词语与句子中间切断, 请使用 segment.SplitText
 func ChunkString(s string, chunkSize int) []string {
 	if len(s) == 0 {
 		return nil
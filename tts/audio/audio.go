@@ -0,0 +1,123 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// 音频格式族
+const (
+	FamilyMp3  = "mp3"
+	FamilyWav  = "wav"
+	FamilyPcm  = "pcm"
+	FamilyOgg  = "ogg"
+	FamilyWebm = "webm"
+)
+
+var (
+	ErrInvalidData    = errors.New("audio: 无效的音频数据")
+	ErrFormatMismatch = errors.New("audio: 音频参数不一致")
+)
+
+// Family 根据微软音频格式名(如 audio-24khz-48kbitrate-mono-mp3)判断格式族, 无法判断时返回空
+func Family(format string) string {
+	switch strings.Split(format, "-")[0] {
+	case "audio":
+		if strings.HasSuffix(format, "mp3") {
+			return FamilyMp3
+		}
+	case "riff":
+		return FamilyWav
+	case "raw":
+		return FamilyPcm
+	case "ogg":
+		return FamilyOgg
+	case "webm":
+		return FamilyWebm
+	}
+	return ""
+}
+
+// PcmParams 解析PCM格式(如 raw-24khz-16bit-mono-pcm)的采样率、每个采样的字节数与声道数
+func PcmParams(format string) (rate, width, channels int, ok bool) {
+	parts := strings.Split(format, "-")
+	if len(parts) != 5 || (parts[0] != "raw" && parts[0] != "riff") || parts[4] != "pcm" {
+		return 0, 0, 0, false
+	}
+
+	var err error
+	if khz := strings.TrimSuffix(parts[1], "khz"); khz != parts[1] {
+		rate, err = strconv.Atoi(khz)
+		rate *= 1000
+	} else {
+		rate, err = strconv.Atoi(strings.TrimSuffix(parts[1], "hz"))
+	}
+	if err != nil || rate <= 0 {
+		return 0, 0, 0, false
+	}
+
+	bits, err := strconv.Atoi(strings.TrimSuffix(parts[2], "bit"))
+	if err != nil || bits <= 0 || bits%8 != 0 {
+		return 0, 0, 0, false
+	}
+
+	switch parts[3] {
+	case "mono":
+		channels = 1
+	case "stereo":
+		channels = 2
+	default:
+		return 0, 0, 0, false
+	}
+	return rate, bits / 8, channels, true
+}
+
+/* 根据文件头判断格式族 */
+func sniff(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("RIFF")):
+		return FamilyWav
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return FamilyOgg
+	case bytes.HasPrefix(data, []byte{0x1a, 0x45, 0xdf, 0xa3}):
+		return FamilyWebm
+	case bytes.HasPrefix(data, []byte("ID3")) || mp3FrameLen(data) > 0:
+		return FamilyMp3
+	}
+	return ""
+}
+
+// Join 将同一格式的多段音频拼接为一个完整的文件, 并修正文件头中的长度与时间戳。
+// 无法识别的格式直接按字节拼接
+func Join(format string, chunks [][]byte) ([]byte, error) {
+	var nonEmpty [][]byte
+	for _, c := range chunks {
+		if len(c) > 0 {
+			nonEmpty = append(nonEmpty, c)
+		}
+	}
+	if len(nonEmpty) == 0 {
+		return nil, nil
+	}
+	if len(nonEmpty) == 1 {
+		return nonEmpty[0], nil
+	}
+
+	family := Family(format)
+	if family == "" {
+		family = sniff(nonEmpty[0])
+	}
+	switch family {
+	case FamilyMp3:
+		return joinMp3(nonEmpty), nil
+	case FamilyWav:
+		return joinWav(nonEmpty)
+	case FamilyOgg:
+		return joinOgg(nonEmpty)
+	case FamilyWebm:
+		return joinWebm(nonEmpty)
+	}
+	return bytes.Join(nonEmpty, nil), nil
+}
@@ -0,0 +1,229 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func wavFile(format, pcm []byte) []byte {
+	out := []byte("RIFF")
+	out = binary.LittleEndian.AppendUint32(out, uint32(4+8+len(format)+8+len(pcm)))
+	out = append(out, "WAVEfmt "...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(format)))
+	out = append(out, format...)
+	out = append(out, "data"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(pcm)))
+	return append(out, pcm...)
+}
+
+func TestJoinWav(t *testing.T) {
+	format := make([]byte, 16)
+	data, err := Join("riff-24khz-16bit-mono-pcm", [][]byte{wavFile(format, []byte{1, 2}), wavFile(format, []byte{3, 4, 5, 6})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, wavFile(format, []byte{1, 2, 3, 4, 5, 6})) {
+		t.Fatalf("%v", data)
+	}
+
+	/* 流式输出的data块长度为0 */
+	streamed := wavFile(format, []byte{7, 8})
+	binary.LittleEndian.PutUint32(streamed[40:], 0)
+	data, err = Join("riff-24khz-16bit-mono-pcm", [][]byte{data, streamed})
+	if err != nil || !bytes.Equal(data, wavFile(format, []byte{1, 2, 3, 4, 5, 6, 7, 8})) {
+		t.Fatalf("%v, %v", data, err)
+	}
+
+	other := make([]byte, 16)
+	other[0] = 1
+	if _, err = Join("riff-24khz-16bit-mono-pcm", [][]byte{wavFile(format, nil), wavFile(other, nil)}); !errors.Is(err, ErrFormatMismatch) {
+		t.Fatalf("want ErrFormatMismatch, got %v", err)
+	}
+	if _, err = Join("riff-24khz-16bit-mono-pcm", [][]byte{[]byte("RIFF"), []byte("RIFF")}); !errors.Is(err, ErrInvalidData) {
+		t.Fatalf("want ErrInvalidData, got %v", err)
+	}
+}
+
+/* MPEG1 Layer III, 128kbps, 44100Hz, 帧长417 */
+func mp3Frame(fill byte, tag string) []byte {
+	frame := bytes.Repeat([]byte{fill}, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x64})
+	copy(frame[36:], tag)
+	return frame
+}
+
+func TestJoinMp3(t *testing.T) {
+	id3 := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x02"), 0, 0)
+	chunk := func(fill byte) []byte {
+		c := append([]byte{}, id3...)
+		c = append(c, mp3Frame(0, "Xing")...)
+		return append(c, mp3Frame(fill, "")...)
+	}
+
+	data, err := Join("audio-24khz-48kbitrate-mono-mp3", [][]byte{chunk(1), chunk(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append(append([]byte{}, id3...), mp3Frame(1, "")...), mp3Frame(2, "")...)
+	if !bytes.Equal(data, want) {
+		t.Fatalf("len: %d, want: %d", len(data), len(want))
+	}
+	if mp3FrameLen([]byte{0xff, 0xf3, 0x64, 0xc4}) != 144 { /* MPEG2, 48kbps, 24000Hz */
+		t.Fatal("mpeg2 frame length")
+	}
+}
+
+/* 两个头部页, 之后为音频页 */
+func oggFile(serial uint32, granules ...int64) []byte {
+	var out []byte
+	granules = append([]int64{0, 0}, granules...)
+	for i, g := range granules {
+		body := []byte{byte(i)}
+		switch i {
+		case 0:
+			body = []byte("OpusHead")
+		case 1:
+			body = []byte("OpusTags")
+		}
+		p := &oggPage{granule: g, serial: serial, seq: uint32(i), segments: []byte{byte(len(body))}, body: body}
+		if i == 0 {
+			p.headerType = oggBos
+		}
+		if i == len(granules)-1 {
+			p.headerType |= oggEos
+		}
+		out = p.appendTo(out)
+	}
+	return out
+}
+
+func TestJoinOgg(t *testing.T) {
+	data, err := Join("ogg-24khz-16bit-mono-opus", [][]byte{oggFile(1, 1000, 2000), oggFile(2, -1, 1500)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := parseOggPages(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantGranules := []int64{0, 0, 1000, 2000, -1, 3500}
+	if len(pages) != len(wantGranules) {
+		t.Fatalf("pages: %d", len(pages))
+	}
+	for i, p := range pages {
+		if p.granule != wantGranules[i] || p.seq != uint32(i) || p.serial != 1 {
+			t.Fatalf("page %d: %+v", i, p)
+		}
+		if (p.headerType&oggBos != 0) != (i == 0) || (p.headerType&oggEos != 0) != (i == len(pages)-1) {
+			t.Fatalf("page %d flags: %x", i, p.headerType)
+		}
+	}
+
+	/* 校验CRC */
+	for p := data; len(p) > 0; {
+		n := 27 + int(p[26]) + int(p[27])
+		page := append([]byte{}, p[:n]...)
+		crc := binary.LittleEndian.Uint32(page[22:])
+		binary.LittleEndian.PutUint32(page[22:], 0)
+		if oggCrc(page) != crc {
+			t.Fatal("invalid crc")
+		}
+		p = p[n:]
+	}
+}
+
+func webmFile(blocks ...int16) []byte {
+	header := appendEbmlElement(nil, idEbml, appendEbmlUint(nil, 0x4286, 1))
+	info := appendEbmlUint(nil, 0x2ad7b1, 1000000)
+	info = appendEbmlElement(info, idDuration, []byte{0x40, 0x8f, 0x40, 0, 0, 0, 0, 0})
+	cluster := appendEbmlUint(nil, idTimecode, 0)
+	for _, b := range blocks {
+		cluster = appendEbmlElement(cluster, idSimpleBlock, []byte{0x81, byte(b >> 8), byte(b), 0x80, 0xfc})
+	}
+
+	out := appendEbmlId(header, idSegment)
+	out = append(out, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	out = appendEbmlElement(out, idInfo, info)
+	out = appendEbmlElement(out, idTracks, appendEbmlElement(nil, 0xae, appendEbmlUint(nil, 0xd7, 1)))
+	/* 未知长度的Cluster */
+	out = appendEbmlId(out, idCluster)
+	out = append(out, 0xff)
+	return append(out, cluster...)
+}
+
+func TestJoinWebm(t *testing.T) {
+	data, err := Join("webm-24khz-16bit-mono-opus", [][]byte{webmFile(0, 20, 40), webmFile(0, 20)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, elements, err := parseWebm(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(header, appendEbmlElement(nil, idEbml, appendEbmlUint(nil, 0x4286, 1))) {
+		t.Fatalf("header: %x", header)
+	}
+
+	var ids []uint32
+	var timecodes []int64
+	for _, el := range elements {
+		ids = append(ids, el.id)
+		if el.id == idInfo && bytes.Contains(el.data, []byte{0x44, 0x89}) {
+			t.Fatal("duration should be removed")
+		}
+		if el.id == idCluster {
+			timecode, blocks := clusterTimecodes(el)
+			if len(blocks) == 0 {
+				t.Fatal("cluster without blocks")
+			}
+			timecodes = append(timecodes, timecode)
+		}
+	}
+	if len(ids) != 4 || ids[0] != idInfo || ids[1] != idTracks {
+		t.Fatalf("elements: %x", ids)
+	}
+	if len(timecodes) != 2 || timecodes[0] != 0 || timecodes[1] != 60 {
+		t.Fatalf("timecodes: %v", timecodes)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	data, err := Join("raw-24khz-16bit-mono-pcm", [][]byte{{1, 2}, nil, {3}})
+	if err != nil || !bytes.Equal(data, []byte{1, 2, 3}) {
+		t.Fatalf("%v, %v", data, err)
+	}
+
+	/* 根据文件头识别格式 */
+	format := make([]byte, 16)
+	data, err = Join("", [][]byte{wavFile(format, []byte{1}), wavFile(format, []byte{2})})
+	if err != nil || !bytes.Equal(data, wavFile(format, []byte{1, 2})) {
+		t.Fatalf("%v, %v", data, err)
+	}
+
+	if data, err = Join("", nil); data != nil || err != nil {
+		t.Fatal("empty input")
+	}
+}
+
+func TestPcmParams(t *testing.T) {
+	tests := []struct {
+		format                string
+		rate, width, channels int
+		ok                    bool
+	}{
+		{"raw-24khz-16bit-mono-pcm", 24000, 2, 1, true},
+		{"riff-22050hz-16bit-mono-pcm", 22050, 2, 1, true},
+		{"raw-48khz-16bit-stereo-pcm", 48000, 2, 2, true},
+		{"raw-8khz-8bit-mono-mulaw", 0, 0, 0, false},
+		{"audio-24khz-48kbitrate-mono-mp3", 0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		rate, width, channels, ok := PcmParams(tt.format)
+		if rate != tt.rate || width != tt.width || channels != tt.channels || ok != tt.ok {
+			t.Fatalf("%s: %d %d %d %v", tt.format, rate, width, channels, ok)
+		}
+	}
+}
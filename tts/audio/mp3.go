@@ -0,0 +1,93 @@
+package audio
+
+import "bytes"
+
+/* Layer III 比特率(kbps), [0]为MPEG1, [1]为MPEG2/2.5 */
+var mp3Bitrates = [2][16]int{
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+}
+
+/* 采样率, 按版本位索引: 0为MPEG2.5, 2为MPEG2, 3为MPEG1 */
+var mp3SampleRates = [4][3]int{
+	{11025, 12000, 8000},
+	{},
+	{22050, 24000, 16000},
+	{44100, 48000, 32000},
+}
+
+/* 解析Layer III帧头, 返回帧长度, 无效时返回0 */
+func mp3FrameLen(h []byte) int {
+	if len(h) < 4 || h[0] != 0xff || h[1]&0xe0 != 0xe0 {
+		return 0
+	}
+	version := h[1] >> 3 & 3
+	layer := h[1] >> 1 & 3
+	bitrateIndex := h[2] >> 4
+	sampleRateIndex := h[2] >> 2 & 3
+	padding := int(h[2] >> 1 & 1)
+	if version == 1 || layer != 1 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return 0
+	}
+
+	sampleRate := mp3SampleRates[version][sampleRateIndex]
+	if version == 3 {
+		return 144000*mp3Bitrates[0][bitrateIndex]/sampleRate + padding
+	}
+	return 72000*mp3Bitrates[1][bitrateIndex]/sampleRate + padding
+}
+
+/* 跳过开头的ID3v2标签 */
+func skipId3v2(data []byte) []byte {
+	if len(data) < 10 || !bytes.HasPrefix(data, []byte("ID3")) {
+		return data
+	}
+	size := int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 | int(data[8]&0x7f)<<7 | int(data[9]&0x7f)
+	size += 10
+	if data[5]&0x10 != 0 { /* 带footer */
+		size += 10
+	}
+	if size > len(data) {
+		return nil
+	}
+	return data[size:]
+}
+
+/* 去除末尾的ID3v1标签 */
+func trimId3v1(data []byte) []byte {
+	if len(data) >= 128 && bytes.HasPrefix(data[len(data)-128:], []byte("TAG")) {
+		return data[:len(data)-128]
+	}
+	return data
+}
+
+/* 去除开头的Xing/Info/VBRI帧, 拼接后其中记录的帧数已不正确 */
+func trimVbrHeader(data []byte) []byte {
+	n := mp3FrameLen(data)
+	if n == 0 || n > len(data) {
+		return data
+	}
+	frame := data[4:n]
+	if len(frame) > 60 {
+		frame = frame[:60]
+	}
+	for _, tag := range []string{"Xing", "Info", "VBRI"} {
+		if bytes.Contains(frame, []byte(tag)) {
+			return data[n:]
+		}
+	}
+	return data
+}
+
+/* MP3帧相互独立, 仅保留第一段的ID3v2标签, 去除其余标签与VBR头 */
+func joinMp3(chunks [][]byte) []byte {
+	var out []byte
+	for i, c := range chunks {
+		body := skipId3v2(c)
+		if i == 0 {
+			out = append(out, c[:len(c)-len(body)]...)
+		}
+		out = append(out, trimVbrHeader(trimId3v1(body))...)
+	}
+	return out
+}
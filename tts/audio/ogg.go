@@ -0,0 +1,149 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	oggContinued = 0x01 /* 本页以上一页未完成的包开始 */
+	oggBos       = 0x02 /* 流的第一页 */
+	oggEos       = 0x04 /* 流的最后一页 */
+)
+
+type oggPage struct {
+	headerType byte
+	granule    int64
+	serial     uint32
+	seq        uint32
+	segments   []byte
+	body       []byte
+}
+
+func parseOggPages(data []byte) ([]*oggPage, error) {
+	var pages []*oggPage
+	for len(data) > 0 {
+		if len(data) < 27 || !bytes.HasPrefix(data, []byte("OggS")) {
+			return nil, ErrInvalidData
+		}
+		n := int(data[26])
+		if len(data) < 27+n {
+			return nil, ErrInvalidData
+		}
+		segments := data[27 : 27+n]
+		bodyLen := 0
+		for _, s := range segments {
+			bodyLen += int(s)
+		}
+		if len(data) < 27+n+bodyLen {
+			return nil, ErrInvalidData
+		}
+
+		pages = append(pages, &oggPage{
+			headerType: data[5],
+			granule:    int64(binary.LittleEndian.Uint64(data[6:14])),
+			serial:     binary.LittleEndian.Uint32(data[14:18]),
+			seq:        binary.LittleEndian.Uint32(data[18:22]),
+			segments:   segments,
+			body:       data[27+n : 27+n+bodyLen],
+		})
+		data = data[27+n+bodyLen:]
+	}
+	return pages, nil
+}
+
+func (p *oggPage) appendTo(out []byte) []byte {
+	start := len(out)
+	out = append(out, "OggS"...)
+	out = append(out, 0, p.headerType)
+	out = binary.LittleEndian.AppendUint64(out, uint64(p.granule))
+	out = binary.LittleEndian.AppendUint32(out, p.serial)
+	out = binary.LittleEndian.AppendUint32(out, p.seq)
+	out = append(out, 0, 0, 0, 0) /* CRC */
+	out = append(out, byte(len(p.segments)))
+	out = append(out, p.segments...)
+	out = append(out, p.body...)
+	binary.LittleEndian.PutUint32(out[start+22:], oggCrc(out[start:]))
+	return out
+}
+
+var oggCrcTable = func() (table [256]uint32) {
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+func oggCrc(p []byte) uint32 {
+	var crc uint32
+	for _, b := range p {
+		crc = crc<<8 ^ oggCrcTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+/* Opus与Vorbis的头部包 */
+func isOggHeader(body []byte) bool {
+	for _, prefix := range []string{"OpusHead", "OpusTags", "\x01vorbis", "\x03vorbis", "\x05vorbis"} {
+		if bytes.HasPrefix(body, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+/* 去除后续段的头部页(OpusHead/OpusTags), 统一流序列号, 重新编号页序号并累加granule */
+func joinOgg(chunks [][]byte) ([]byte, error) {
+	var pages []*oggPage
+	var serial uint32
+	var offset int64
+	for i, c := range chunks {
+		chunkPages, err := parseOggPages(c)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 && len(chunkPages) > 0 {
+			serial = chunkPages[0].serial
+		}
+
+		var end int64
+		skipping := false
+		for _, p := range chunkPages {
+			if i > 0 && (isOggHeader(p.body) || skipping && p.headerType&oggContinued != 0) {
+				skipping = true
+				continue
+			}
+			skipping = false
+			if p.granule != -1 { /* -1表示本页没有完整的包 */
+				end = p.granule
+				p.granule += offset
+			}
+			p.serial = serial
+			p.seq = uint32(len(pages))
+			p.headerType &^= oggEos
+			if len(pages) > 0 {
+				p.headerType &^= oggBos
+			}
+			pages = append(pages, p)
+		}
+		offset += end
+	}
+	if len(pages) == 0 {
+		return nil, ErrInvalidData
+	}
+	pages[len(pages)-1].headerType |= oggEos
+
+	var out []byte
+	for _, p := range pages {
+		out = p.appendTo(out)
+	}
+	return out, nil
+}
@@ -0,0 +1,81 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+/* 解析RIFF WAV, 返回fmt块与音频数据 */
+func parseWav(data []byte) (format, pcm []byte, err error) {
+	if len(data) < 12 || !bytes.HasPrefix(data, []byte("RIFF")) || string(data[8:12]) != "WAVE" {
+		return nil, nil, ErrInvalidData
+	}
+
+	p := data[12:]
+	for len(p) >= 8 {
+		id := string(p[:4])
+		size := binary.LittleEndian.Uint32(p[4:8])
+		p = p[8:]
+		if id == "data" {
+			/* 流式输出时长度可能为0或0xFFFFFFFF */
+			if size == 0 || uint64(size) > uint64(len(p)) {
+				size = uint32(len(p))
+			}
+			pcm = p[:size]
+			break
+		}
+
+		if uint64(size) > uint64(len(p)) {
+			return nil, nil, ErrInvalidData
+		}
+		if id == "fmt " {
+			format = p[:size]
+		}
+		if size%2 == 1 && size < uint32(len(p)) { /* 奇数长度的块有一字节填充 */
+			size++
+		}
+		p = p[size:]
+	}
+
+	if format == nil || pcm == nil {
+		return nil, nil, ErrInvalidData
+	}
+	return format, pcm, nil
+}
+
+/* 合并所有data块, 重新生成RIFF头 */
+func joinWav(chunks [][]byte) ([]byte, error) {
+	var format []byte
+	var pcm [][]byte
+	size := 0
+	for i, c := range chunks {
+		f, data, err := parseWav(c)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			format = f
+		} else if !bytes.Equal(f, format) {
+			return nil, ErrFormatMismatch
+		}
+		pcm = append(pcm, data)
+		size += len(data)
+	}
+
+	out := make([]byte, 0, 20+len(format)+8+size+1)
+	out = append(out, "RIFF"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(4+8+len(format)+8+size+size%2))
+	out = append(out, "WAVE"...)
+	out = append(out, "fmt "...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(format)))
+	out = append(out, format...)
+	out = append(out, "data"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(size))
+	for _, data := range pcm {
+		out = append(out, data...)
+	}
+	if size%2 == 1 {
+		out = append(out, 0)
+	}
+	return out, nil
+}
@@ -0,0 +1,299 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+/* Matroska/WebM 元素ID */
+const (
+	idEbml        = 0x1a45dfa3
+	idSegment     = 0x18538067
+	idSeekHead    = 0x114d9b74
+	idInfo        = 0x1549a966
+	idDuration    = 0x4489
+	idTracks      = 0x1654ae6b
+	idCluster     = 0x1f43b675
+	idCues        = 0x1c53bb6b
+	idTags        = 0x1254c367
+	idChapters    = 0x1043a770
+	idAttachments = 0x1941a469
+	idTimecode    = 0xe7
+	idSimpleBlock = 0xa3
+	idBlockGroup  = 0xa0
+	idBlock       = 0xa1
+)
+
+/* 无法推算帧长时, 假定一帧20ms(TimecodeScale为默认的1ms) */
+const defaultFrameDuration = 20
+
+/* Segment的直接子元素, 用于确定未知长度Cluster的结束位置 */
+var segmentLevelIds = map[uint32]bool{
+	idSeekHead: true, idInfo: true, idTracks: true, idCluster: true,
+	idCues: true, idTags: true, idChapters: true, idAttachments: true,
+}
+
+type ebmlElement struct {
+	id       uint32
+	data     []byte
+	raw      []byte /* 包括ID与长度 */
+	children []*ebmlElement
+}
+
+/* 读取元素ID, 保留长度标记位 */
+func readEbmlId(p []byte) (id uint32, n int, ok bool) {
+	if len(p) == 0 || p[0] == 0 {
+		return 0, 0, false
+	}
+	n = bits.LeadingZeros8(p[0]) + 1
+	if n > 4 || len(p) < n {
+		return 0, 0, false
+	}
+	for _, b := range p[:n] {
+		id = id<<8 | uint32(b)
+	}
+	return id, n, true
+}
+
+/* 读取变长整数并去除长度标记位, 数值位全为1表示未知长度 */
+func readEbmlSize(p []byte) (size uint64, n int, unknown, ok bool) {
+	if len(p) == 0 || p[0] == 0 {
+		return 0, 0, false, false
+	}
+	n = bits.LeadingZeros8(p[0]) + 1
+	if len(p) < n {
+		return 0, 0, false, false
+	}
+	mask := byte(0xff) >> n
+	size = uint64(p[0] & mask)
+	unknown = p[0]&mask == mask
+	for _, b := range p[1:n] {
+		size = size<<8 | uint64(b)
+		unknown = unknown && b == 0xff
+	}
+	return size, n, unknown, true
+}
+
+/* 读取一个元素; 长度未知或超出数据时取剩余全部数据, 由调用者确定实际结束位置 */
+func readEbmlElement(p []byte) (el *ebmlElement, unknown bool, err error) {
+	id, n1, ok := readEbmlId(p)
+	if !ok {
+		return nil, false, ErrInvalidData
+	}
+	size, n2, unknown, ok := readEbmlSize(p[n1:])
+	if !ok {
+		return nil, false, ErrInvalidData
+	}
+	body := p[n1+n2:]
+	if unknown || size > uint64(len(body)) {
+		unknown = true
+	} else {
+		body = body[:size]
+	}
+	return &ebmlElement{id: id, data: body, raw: p[:n1+n2+len(body)]}, unknown, nil
+}
+
+/* 解析子元素, untilSegmentLevel为true时遇到Segment级元素即停止, 返回已读取的长度 */
+func readEbmlChildren(p []byte, untilSegmentLevel bool) ([]*ebmlElement, int, error) {
+	var children []*ebmlElement
+	read := 0
+	for read < len(p) {
+		if id, _, ok := readEbmlId(p[read:]); ok && untilSegmentLevel && segmentLevelIds[id] {
+			break
+		}
+		el, _, err := readEbmlElement(p[read:])
+		if err != nil {
+			return nil, 0, err
+		}
+		children = append(children, el)
+		read += len(el.raw)
+	}
+	return children, read, nil
+}
+
+/* 解析WebM, 返回EBML头与Segment子元素, Cluster的子元素一并解析 */
+func parseWebm(data []byte) (header []byte, elements []*ebmlElement, err error) {
+	el, _, err := readEbmlElement(data)
+	if err != nil || el.id != idEbml {
+		return nil, nil, ErrInvalidData
+	}
+	header = el.raw
+
+	segment, _, err := readEbmlElement(data[len(header):])
+	if err != nil || segment.id != idSegment {
+		return nil, nil, ErrInvalidData
+	}
+
+	p := segment.data
+	for len(p) > 0 {
+		el, unknown, err := readEbmlElement(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		if el.id == idCluster {
+			children, n, err := readEbmlChildren(el.data, unknown)
+			if err != nil {
+				return nil, nil, err
+			}
+			el.children = children
+			el.raw = el.raw[:len(el.raw)-len(el.data)+n]
+			el.data = el.data[:n]
+		}
+		elements = append(elements, el)
+		p = p[len(el.raw):]
+	}
+	return header, elements, nil
+}
+
+func ebmlUint(p []byte) uint64 {
+	var v uint64
+	for _, b := range p {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+/* Block数据: 轨道号(变长整数) + 相对时间码(int16) + ... */
+func blockTimecode(p []byte) (int64, bool) {
+	_, n, _, ok := readEbmlSize(p)
+	if !ok || len(p) < n+2 {
+		return 0, false
+	}
+	return int64(int16(binary.BigEndian.Uint16(p[n:]))), true
+}
+
+/* Cluster的时间码与其中所有Block的绝对时间码 */
+func clusterTimecodes(cluster *ebmlElement) (timecode int64, blocks []int64) {
+	var relative []int64
+	for _, child := range cluster.children {
+		switch child.id {
+		case idTimecode:
+			timecode = int64(ebmlUint(child.data))
+		case idSimpleBlock:
+			if t, ok := blockTimecode(child.data); ok {
+				relative = append(relative, t)
+			}
+		case idBlockGroup:
+			children, _, _ := readEbmlChildren(child.data, false)
+			for _, c := range children {
+				if c.id == idBlock {
+					if t, ok := blockTimecode(c.data); ok {
+						relative = append(relative, t)
+					}
+				}
+			}
+		}
+	}
+	for _, t := range relative {
+		blocks = append(blocks, timecode+t)
+	}
+	return timecode, blocks
+}
+
+func appendEbmlId(out []byte, id uint32) []byte {
+	n := 4
+	for n > 1 && id>>(8*(n-1)) == 0 {
+		n--
+	}
+	for i := n - 1; i >= 0; i-- {
+		out = append(out, byte(id>>(8*i)))
+	}
+	return out
+}
+
+func appendEbmlSize(out []byte, size uint64) []byte {
+	n := 1
+	for n < 8 && size >= 1<<(7*n)-1 {
+		n++
+	}
+	v := size | 1<<(7*n)
+	for i := n - 1; i >= 0; i-- {
+		out = append(out, byte(v>>(8*i)))
+	}
+	return out
+}
+
+func appendEbmlElement(out []byte, id uint32, data []byte) []byte {
+	out = appendEbmlId(out, id)
+	out = appendEbmlSize(out, uint64(len(data)))
+	return append(out, data...)
+}
+
+func appendEbmlUint(out []byte, id uint32, v uint64) []byte {
+	n := 1
+	for n < 8 && v>>(8*n) != 0 {
+		n++
+	}
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(v >> (8 * (n - 1 - i)))
+	}
+	return appendEbmlElement(out, id, data)
+}
+
+/*
+使用第一段的EBML头、Info与Tracks, Segment长度设为未知;
+去除SeekHead、Cues与Info中的Duration(拼接后位置与时长均已失效);
+后续段的Cluster时间码加上之前所有段的时长
+*/
+func joinWebm(chunks [][]byte) ([]byte, error) {
+	var out []byte
+	var offset int64
+	for i, c := range chunks {
+		header, elements, err := parseWebm(c)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			out = append(out, header...)
+			out = appendEbmlId(out, idSegment)
+			out = append(out, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+		}
+
+		var blocks []int64
+		for _, el := range elements {
+			switch {
+			case el.id == idCluster:
+				timecode, clusterBlocks := clusterTimecodes(el)
+				blocks = append(blocks, clusterBlocks...)
+				data := appendEbmlUint(nil, idTimecode, uint64(offset+timecode))
+				for _, child := range el.children {
+					if child.id != idTimecode {
+						data = append(data, child.raw...)
+					}
+				}
+				out = appendEbmlElement(out, idCluster, data)
+			case i > 0 || el.id == idSeekHead || el.id == idCues:
+			case el.id == idInfo:
+				children, _, err := readEbmlChildren(el.data, false)
+				if err != nil {
+					return nil, err
+				}
+				var data []byte
+				for _, child := range children {
+					if child.id != idDuration {
+						data = append(data, child.raw...)
+					}
+				}
+				out = appendEbmlElement(out, idInfo, data)
+			default:
+				out = append(out, el.raw...)
+			}
+		}
+		offset += webmDuration(blocks)
+	}
+	return out, nil
+}
+
+/* 最后一个Block的时间码加上帧长, 帧长取最后两个Block的间隔 */
+func webmDuration(blocks []int64) int64 {
+	if len(blocks) == 0 {
+		return 0
+	}
+	last := blocks[len(blocks)-1]
+	frame := int64(defaultFrameDuration)
+	if len(blocks) > 1 && last > blocks[len(blocks)-2] {
+		frame = last - blocks[len(blocks)-2]
+	}
+	return last + frame
+}
@@ -4,28 +4,37 @@ import (
 	"context"
 	"fmt"
 	"github.com/gorilla/websocket"
-	tsg "github.com/jing332/tts-server-go"
+	"github.com/jing332/tts-server-go/tts"
+	"github.com/jing332/tts-server-go/tts/protocol"
+	"github.com/jing332/tts-server-go/tts/proxy"
 	log "github.com/sirupsen/logrus"
 	"io"
 	"net/http"
-	"strings"
+	"strconv"
+	"sync"
 	"time"
 )
 
 const (
+	maxAudioSize = 2000000 /* 单个请求的音频大于2MB时失败 */
+
 	wssUrl    = `wss://eastus.api.speech.microsoft.com/cognitiveservices/websocket/v1?TricType=AzureDemo&Authorization=bearer%20undefined&X-ConnectionId=`
 	voicesUrl = `https://eastus.api.speech.microsoft.com/cognitiveservices/voices/list`
 )
 
+// TTS 单个WebSocket连接，可同时处理多个请求，按 X-RequestId 区分
 type TTS struct {
 	DialTimeout  time.Duration
 	WriteTimeout time.Duration
+	Proxy        *proxy.Proxy // 出站代理, 为空时按环境变量选择
 
 	dialContextCancel context.CancelFunc
 
-	uuid          string
-	conn          *websocket.Conn
-	onReadMessage func(messageType int, p []byte, errMessage error) (finished bool)
+	conn      *websocket.Conn
+	dialLock  sync.Mutex
+	writeLock sync.Mutex /* 保证config与ssml消息连续发送 */
+	lock      sync.Mutex
+	mux       protocol.Mux
 }
 
 func (t *TTS) NewConn() error {
@@ -39,6 +48,7 @@ func (t *TTS) NewConn() error {
 
 	dl := websocket.Dialer{
 		EnableCompression: true,
+		NetDialContext:    t.Proxy.DialContext,
 	}
 
 	header := http.Header{}
@@ -53,48 +63,97 @@ func (t *TTS) NewConn() error {
 		t.dialContextCancel = nil
 	}()
 
-	var err error
-	var resp *http.Response
-	t.conn, resp, err = dl.DialContext(ctx, wssUrl+t.uuid, header)
+	conn, resp, err := dl.DialContext(ctx, wssUrl+protocol.NewRequestId(), header)
 	if err != nil {
 		if resp == nil {
 			return err
 		}
-		return fmt.Errorf("%w: %s", err, resp.Status)
+		return &tts.StatusError{Code: resp.StatusCode, Status: resp.Status, Err: err}
 	}
 
-	var size = 0
-	go func() {
-		for {
-			if t.conn == nil {
-				return
-			}
-			messageType, p, err := t.conn.ReadMessage()
-			size += len(p)
-			if size >= 2000000 { //大于2MB主动断开
-				t.onReadMessage(-1, nil, &websocket.CloseError{Code: websocket.CloseAbnormalClosure})
-				t.conn = nil
-				return
-			} else {
-				closed := t.onReadMessage(messageType, p, err)
-				if closed {
-					t.conn = nil
-					return
-				}
-			}
+	t.lock.Lock()
+	t.conn = conn
+	t.lock.Unlock()
+	go t.readLoop(conn)
+
+	return nil
+}
+
+/* 连接已断开时重新连接 */
+func (t *TTS) ensureConn() error {
+	t.dialLock.Lock()
+	defer t.dialLock.Unlock()
+	if t.Alive() {
+		return nil
+	}
+	return t.NewConn()
+}
+
+func (t *TTS) readLoop(conn *websocket.Conn) {
+	for {
+		messageType, p, err := conn.ReadMessage()
+		if err != nil { /* 已经断开链接, 通知所有请求 */
+			t.closeWithError(conn, err)
+			return
 		}
-	}()
 
+		msg, err := protocol.Parse(messageType, p)
+		if err != nil {
+			log.Warnln("解析消息失败(Azure):", err)
+			continue
+		}
+		t.mux.Dispatch(msg)
+	}
+}
+
+/* 关闭连接并使所有进行中的请求失败 */
+func (t *TTS) closeWithError(conn *websocket.Conn, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.conn != conn {
+		return
+	}
+	_ = conn.Close()
+	t.conn = nil
+	t.mux.Fail(err)
+}
+
+// Alive 连接是否可用
+func (t *TTS) Alive() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.conn != nil
+}
+
+// Ping 发送Ping控制帧，失败则断开连接
+func (t *TTS) Ping() error {
+	t.lock.Lock()
+	conn := t.conn
+	t.lock.Unlock()
+	if conn == nil {
+		return websocket.ErrCloseSent
+	}
+	err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(t.WriteTimeout))
+	if err != nil {
+		t.closeWithError(conn, err)
+	}
+	return err
+}
+
+func (t *TTS) Close() error {
+	t.CloseConn()
 	return nil
 }
 
 func (t *TTS) CloseConn() {
-	if t.conn != nil {
-		if t.dialContextCancel != nil {
-			t.dialContextCancel()
-		}
-		_ = t.conn.Close()
-		t.conn = nil
+	if t.dialContextCancel != nil {
+		t.dialContextCancel()
+	}
+	t.lock.Lock()
+	conn := t.conn
+	t.lock.Unlock()
+	if conn != nil {
+		t.closeWithError(conn, &websocket.CloseError{Code: websocket.CloseNormalClosure})
 	}
 }
 
@@ -106,69 +165,75 @@ func (t *TTS) GetAudio(ssml, format string) (audioData []byte, err error) {
 }
 
 func (t *TTS) GetAudioStream(ssml, format string, read func([]byte)) error {
-	t.uuid = tsg.GetUUID()
-	if t.conn == nil {
-		err := t.NewConn()
-		if err != nil {
-			return err
-		}
-	}
+	return t.GetAudioStreamUseContext(context.Background(), ssml, format, read)
+}
 
-	running := true
-	defer func() {
-		running = false
-	}()
+// GetAudioStreamUseContext 可与其他请求并发调用。ctx取消时仅丢弃该请求的后续数据，不影响连接
+func (t *TTS) GetAudioStreamUseContext(ctx context.Context, ssml, format string, read func([]byte)) error {
+	return t.speak(ctx, &tts.SpeakRequest{Ssml: ssml, Format: format}, read)
+}
 
-	var finished = make(chan bool)
-	var failed = make(chan error)
-	t.onReadMessage = func(messageType int, p []byte, errMessage error) bool {
-		if messageType == -1 && p == nil && errMessage != nil { //已经断开链接
-			if running {
-				failed <- errMessage
-			}
-			return true
-		}
+func (t *TTS) speak(ctx context.Context, req *tts.SpeakRequest, read func([]byte)) error {
+	err := t.ensureConn()
+	if err != nil {
+		return err
+	}
 
-		if messageType == 2 {
-			index := strings.Index(string(p), "Path:audio")
-			data := []byte(string(p)[index+12:])
-			read(data)
-		} else if messageType == 1 && string(p)[len(string(p))-14:len(string(p))-6] == "turn.end" {
-			finished <- true
-			return false
+	id := protocol.NewRequestId()
+	t.lock.Lock()
+	conn := t.conn
+	t.lock.Unlock()
+	if conn == nil {
+		return &websocket.CloseError{Code: websocket.CloseAbnormalClosure}
+	}
+	s := protocol.NewStream(read)
+	s.MaxSize = maxAudioSize
+	if req.OnBoundary != nil {
+		s.OnMetadata = func(msg *protocol.Message) {
+			boundaries, err := protocol.ParseMetadata(msg.Body)
+			if err != nil {
+				log.Warnln("解析边界事件失败:", err)
+			}
+			for _, b := range boundaries {
+				req.OnBoundary(b)
+			}
 		}
-		return false
 	}
-	err := t.sendConfigMessage(format)
+	t.mux.Add(id, s)
+	defer t.mux.Remove(id)
+
+	err = t.send(conn, id, req)
 	if err != nil {
+		t.closeWithError(conn, err)
 		return err
 	}
-	err = t.sendSsmlMessage(ssml)
+
+	return s.Wait(ctx)
+}
+
+func (t *TTS) send(conn *websocket.Conn, id string, req *tts.SpeakRequest) error {
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+	err := t.sendConfigMessage(conn, id, req)
 	if err != nil {
 		return err
 	}
-
-	select {
-	case <-finished:
-		return nil
-	case errMessage := <-failed:
-		return errMessage
-	}
+	return t.sendSsmlMessage(conn, id, req.Ssml)
 }
 
-func (t *TTS) sendConfigMessage(format string) error {
-	timestamp := tsg.GetISOTime()
-	m1 := "Path: speech.config\r\nX-RequestId: " + t.uuid + "\r\nX-Timestamp: " + timestamp +
-		"\r\nContent-Type: application/json\r\n\r\n{\"context\":{\"system\":{\"name\":\"SpeechSDK\",\"version\":\"1.19.0\",\"build\":\"JavaScript\",\"lang\":\"JavaScript\",\"os\":{\"platform\":\"Browser/Linux x86_64\",\"name\":\"Mozilla/5.0 (X11; Linux x86_64; rv:78.0) Gecko/20100101 Firefox/78.0\",\"version\":\"5.0 (X11)\"}}}}"
-	m2 := "Path: synthesis.context\r\nX-RequestId: " + t.uuid + "\r\nX-Timestamp: " + timestamp +
-		"\r\nContent-Type: application/json\r\n\r\n{\"synthesis\":{\"audio\":{\"metadataOptions\":{\"sentenceBoundaryEnabled\":false,\"wordBoundaryEnabled\":false},\"outputFormat\":\"" + format + "\"}}}"
-	_ = t.conn.SetWriteDeadline(time.Now().Add(t.WriteTimeout))
-	err := t.conn.WriteMessage(websocket.TextMessage, []byte(m1))
+func (t *TTS) sendConfigMessage(conn *websocket.Conn, id string, req *tts.SpeakRequest) error {
+	m1 := protocol.TextMessage(protocol.PathSpeechConfig, id, "application/json",
+		"{\"context\":{\"system\":{\"name\":\"SpeechSDK\",\"version\":\"1.19.0\",\"build\":\"JavaScript\",\"lang\":\"JavaScript\",\"os\":{\"platform\":\"Browser/Linux x86_64\",\"name\":\"Mozilla/5.0 (X11; Linux x86_64; rv:78.0) Gecko/20100101 Firefox/78.0\",\"version\":\"5.0 (X11)\"}}}}")
+	m2 := protocol.TextMessage(protocol.PathSynthesisContext, id, "application/json",
+		"{\"synthesis\":{\"audio\":{\"metadataOptions\":{\"sentenceBoundaryEnabled\":"+strconv.FormatBool(req.SentenceBoundary)+
+			",\"wordBoundaryEnabled\":"+strconv.FormatBool(req.WordBoundary)+"},\"outputFormat\":\""+req.Format+"\"}}}")
+	_ = conn.SetWriteDeadline(time.Now().Add(t.WriteTimeout))
+	err := conn.WriteMessage(websocket.TextMessage, m1)
 	if err != nil {
 		return fmt.Errorf("发送Config1失败: %s", err)
 	}
-	_ = t.conn.SetWriteDeadline(time.Now().Add(t.WriteTimeout))
-	err = t.conn.WriteMessage(websocket.TextMessage, []byte(m2))
+	_ = conn.SetWriteDeadline(time.Now().Add(t.WriteTimeout))
+	err = conn.WriteMessage(websocket.TextMessage, m2)
 	if err != nil {
 		return fmt.Errorf("发送Config2失败: %s", err)
 	}
@@ -176,10 +241,10 @@ func (t *TTS) sendConfigMessage(format string) error {
 	return nil
 }
 
-func (t *TTS) sendSsmlMessage(ssml string) error {
-	msg := "Path: ssml\r\nX-RequestId: " + t.uuid + "\r\nX-Timestamp: " + tsg.GetISOTime() + "\r\nContent-Type: application/ssml+xml\r\n\r\n" + ssml
-	_ = t.conn.SetWriteDeadline(time.Now().Add(t.WriteTimeout))
-	err := t.conn.WriteMessage(websocket.TextMessage, []byte(msg))
+func (t *TTS) sendSsmlMessage(conn *websocket.Conn, id, ssml string) error {
+	msg := protocol.TextMessage(protocol.PathSsml, id, "application/ssml+xml", ssml)
+	_ = conn.SetWriteDeadline(time.Now().Add(t.WriteTimeout))
+	err := conn.WriteMessage(websocket.TextMessage, msg)
 	if err != nil {
 		return fmt.Errorf("发送SSML失败: %s", err)
 	}
@@ -187,6 +252,10 @@ func (t *TTS) sendSsmlMessage(ssml string) error {
 }
 
 func GetVoices() ([]byte, error) {
+	return getVoices(http.DefaultClient)
+}
+
+func getVoices(client *http.Client) ([]byte, error) {
 	req, err := http.NewRequest(http.MethodGet, voicesUrl, nil)
 	if err != nil {
 		return nil, err
@@ -197,14 +266,14 @@ func GetVoices() ([]byte, error) {
 	req.Header.Set("Origin", "https://azure.microsoft.com")
 	req.Header.Set("Referer", "https://azure.microsoft.com")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, err
+		return nil, fmt.Errorf("获取发音人列表失败: %s", resp.Status)
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -0,0 +1,80 @@
+package azure
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jing332/tts-server-go/tts"
+	"github.com/jing332/tts-server-go/tts/pool"
+	"github.com/jing332/tts-server-go/tts/proxy"
+)
+
+// Engine 微软Azure TTS引擎，实现 tts.Engine
+type Engine struct {
+	PoolSize    int           // 最大连接数, 默认4
+	MaxStreams  int           // 单个连接最大并发请求数, 默认1
+	IdleTimeout time.Duration // 空闲连接超时关闭, 默认60s
+	Proxy       *proxy.Proxy  // 出站代理, 为空时按环境变量选择
+
+	once sync.Once
+	pool *pool.Pool
+}
+
+func (e *Engine) getPool() *pool.Pool {
+	e.once.Do(func() {
+		e.pool = &pool.Pool{
+			MaxConns:    e.PoolSize,
+			MaxStreams:  e.MaxStreams,
+			IdleTimeout: e.IdleTimeout,
+			Dial: func(context.Context) (pool.Conn, error) {
+				t := &TTS{Proxy: e.Proxy}
+				if err := t.NewConn(); err != nil {
+					return nil, err
+				}
+				return t, nil
+			},
+		}
+	})
+	return e.pool
+}
+
+func (e *Engine) Synthesize(ctx context.Context, req *tts.SpeakRequest) (audio []byte, err error) {
+	err = e.SynthesizeStream(ctx, req, func(data []byte) {
+		audio = append(audio, data...)
+	})
+	return audio, err
+}
+
+func (e *Engine) SynthesizeStream(ctx context.Context, req *tts.SpeakRequest, read func([]byte)) error {
+	p := e.getPool()
+	conn, err := p.Get(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.Put(conn) /* 已断开的连接会被连接池移除 */
+
+	return conn.(*TTS).speak(ctx, req, read)
+}
+
+func (e *Engine) Voices(context.Context) ([]tts.Voice, error) {
+	data, err := getVoices(e.Proxy.Client())
+	if err != nil {
+		return nil, err
+	}
+	return ParseVoices(data)
+}
+
+// RawVoices Azure原始发音人列表
+func (e *Engine) RawVoices(context.Context) ([]byte, error) {
+	return getVoices(e.Proxy.Client())
+}
+
+// Stats 连接池状态
+func (e *Engine) Stats() pool.Stats {
+	return e.getPool().Stats()
+}
+
+func (e *Engine) Close() error {
+	return e.getPool().Close()
+}
@@ -0,0 +1,36 @@
+package azure
+
+import (
+	"encoding/json"
+
+	"github.com/jing332/tts-server-go/tts"
+)
+
+/* Azure发音人列表中的一项 */
+type azureVoice struct {
+	Name                string   `json:"Name"`
+	DisplayName         string   `json:"DisplayName"`
+	LocalName           string   `json:"LocalName"`
+	ShortName           string   `json:"ShortName"`
+	Gender              string   `json:"Gender"`
+	Locale              string   `json:"Locale"`
+	LocaleName          string   `json:"LocaleName"`
+	StyleList           []string `json:"StyleList"`
+	RolePlayList        []string `json:"RolePlayList"`
+	SecondaryLocaleList []string `json:"SecondaryLocaleList"`
+}
+
+// ParseVoices 将 GetVoices 返回的JSON转为统一格式
+func ParseVoices(data []byte) ([]tts.Voice, error) {
+	var list []azureVoice
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	voices := make([]tts.Voice, 0, len(list))
+	for _, v := range list {
+		voices = append(voices, tts.Voice{Engine: tts.EngineAzure, Id: v.ShortName, Name: v.Name, ShortName: v.ShortName,
+			DisplayName: v.DisplayName, LocalName: v.LocalName, Locale: v.Locale, LocaleName: v.LocaleName, Gender: v.Gender,
+			Styles: v.StyleList, Roles: v.RolePlayList, SecondaryLocales: v.SecondaryLocaleList})
+	}
+	return voices, nil
+}
@@ -0,0 +1,30 @@
+package azure
+
+import (
+	"testing"
+
+	"github.com/jing332/tts-server-go/tts"
+)
+
+func TestParseVoices(t *testing.T) {
+	data := []byte(`[{"Name":"Microsoft Server Speech Text to Speech Voice (en-US, JennyMultilingualNeural)","DisplayName":"Jenny Multilingual",
+		"LocalName":"Jenny Multilingual","ShortName":"en-US-JennyMultilingualNeural","Gender":"Female","Locale":"en-US","LocaleName":"English (United States)",
+		"SecondaryLocaleList":["de-DE","zh-CN"],"SampleRateHertz":"24000","VoiceType":"Neural","Status":"GA"},
+		{"Name":"Microsoft Server Speech Text to Speech Voice (zh-CN, XiaomoNeural)","DisplayName":"Xiaomo","LocalName":"晓墨",
+		"ShortName":"zh-CN-XiaomoNeural","Gender":"Female","Locale":"zh-CN","LocaleName":"Chinese (Mandarin, Simplified)",
+		"StyleList":["embarrassed","calm"],"RolePlayList":["YoungAdultMale","Girl"],"VoiceType":"Neural","Status":"GA"}]`)
+	voices, err := ParseVoices(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(voices) != 2 {
+		t.Fatalf("%+v", voices)
+	}
+	v := voices[1]
+	if v.Engine != tts.EngineAzure || v.Id != "zh-CN-XiaomoNeural" || v.LocalName != "晓墨" || len(v.Styles) != 2 || v.Roles[1] != "Girl" {
+		t.Fatalf("%+v", v)
+	}
+	if len(voices[0].SecondaryLocales) != 2 {
+		t.Fatalf("%+v", voices[0])
+	}
+}
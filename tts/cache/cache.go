@@ -0,0 +1,300 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Cache 按内容寻址的音频缓存，LRU淘汰，并发安全。Dir为空时仅缓存在内存, 重启后丢失。
+// 缓存文件的修改时间为写入时间, 用于重启后计算过期; 访问时间只记录在内存中
+type Cache struct {
+	Dir     string        // 缓存目录, 为空时仅缓存在内存
+	MaxSize int64         // 最大总大小(字节), 默认256MB
+	TTL     time.Duration // 过期时间, 0为不过期
+
+	lock    sync.Mutex
+	once    sync.Once
+	lru     *list.List /* 头部为最近使用 */
+	entries map[string]*list.Element
+	size    int64
+	hits    int64
+	misses  int64
+}
+
+// Entry 缓存条目
+type Entry struct {
+	Key        string    `json:"key"`
+	Size       int64     `json:"size"`
+	Created    time.Time `json:"created"`
+	LastAccess time.Time `json:"lastAccess"`
+	Hits       int64     `json:"hits"`
+
+	data []byte /* 仅内存模式 */
+}
+
+// Stats 缓存状态
+type Stats struct {
+	Dir     string `json:"dir"`
+	Entries int    `json:"entries"`
+	Size    int64  `json:"size"`
+	MaxSize int64  `json:"maxSize"`
+	Hits    int64  `json:"hits"`
+	Misses  int64  `json:"misses"`
+}
+
+var keyRegexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Key 根据引擎、格式与内容生成缓存键(sha256)
+func Key(engine, format, content string) string {
+	sum := sha256.Sum256([]byte(engine + "\n" + format + "\n" + content))
+	return hex.EncodeToString(sum[:])
+}
+
+var (
+	spaceRegexp    = regexp.MustCompile(`\s+`)
+	tagSpaceRegexp = regexp.MustCompile(`>\s+<`)
+)
+
+// NormalizeSsml 去除多余空白, 使仅格式不同的SSML命中同一缓存
+func NormalizeSsml(ssml string) string {
+	ssml = spaceRegexp.ReplaceAllString(strings.TrimSpace(ssml), " ")
+	return tagSpaceRegexp.ReplaceAllString(ssml, "><")
+}
+
+func (c *Cache) init() {
+	c.once.Do(func() {
+		if c.MaxSize <= 0 {
+			c.MaxSize = 256 << 20
+		}
+		c.lru = list.New()
+		c.entries = make(map[string]*list.Element)
+		if c.Dir != "" {
+			if err := c.load(); err != nil {
+				log.Warnln("加载缓存目录失败:", err)
+			}
+		}
+	})
+}
+
+/* 扫描缓存目录, 修改时间即写入时间, 重启前的访问顺序不保留, 按写入时间排序。上次退出时未写完的临时文件直接删除 */
+func (c *Cache) load() error {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+
+	var entries []*Entry
+	err := filepath.WalkDir(c.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), "tmp-") {
+			if err := os.Remove(path); err != nil {
+				log.Warnln("删除临时文件失败:", err)
+			}
+			return nil
+		}
+		if !keyRegexp.MatchString(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &Entry{Key: d.Name(), Size: info.Size(), Created: info.ModTime(), LastAccess: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].LastAccess.After(entries[j].LastAccess) })
+	for _, e := range entries {
+		c.entries[e.Key] = c.lru.PushBack(e)
+		c.size += e.Size
+	}
+	c.evict()
+	log.Infof("已加载缓存: %d个, %dKB", len(c.entries), c.size/1024)
+	return nil
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key)
+}
+
+// Get 获取缓存, 已过期的条目会被删除
+func (c *Cache) Get(key string) ([]byte, bool) {
+	c.init()
+	c.lock.Lock()
+	el, ok := c.entries[key]
+	if ok && c.expired(el.Value.(*Entry)) {
+		c.remove(el)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		c.lock.Unlock()
+		return nil, false
+	}
+	data := el.Value.(*Entry).data
+	c.lock.Unlock()
+
+	/* 读取文件时不持有锁, 文件以重命名方式写入, 不会读到不完整的内容 */
+	var err error
+	if c.Dir != "" {
+		data, err = os.ReadFile(c.path(key))
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err != nil {
+		log.Warnln("读取缓存失败:", err)
+		if c.entries[key] == el {
+			c.remove(el)
+		}
+		c.misses++
+		return nil, false
+	}
+	if c.entries[key] == el { /* 读取期间可能已被删除或替换 */
+		e := el.Value.(*Entry)
+		e.LastAccess = time.Now()
+		e.Hits++
+		c.lru.MoveToFront(el)
+	}
+	c.hits++
+	return data, true
+}
+
+// Put 写入缓存, 超过最大大小时淘汰最久未使用的条目
+func (c *Cache) Put(key string, data []byte) error {
+	c.init()
+	if int64(len(data)) > c.MaxSize || !keyRegexp.MatchString(key) {
+		return nil
+	}
+
+	e := &Entry{Key: key, Size: int64(len(data)), Created: time.Now(), LastAccess: time.Now()}
+	if c.Dir == "" {
+		e.data = data
+	} else if err := c.writeFile(key, data); err != nil { /* 写入文件时不持有锁 */
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.unlink(el) /* 文件已被新内容替换, 不删除 */
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	c.size += e.Size
+	c.evict()
+	return nil
+}
+
+/* 先写入临时文件再重命名, 避免读到不完整的文件 */
+func (c *Cache) writeFile(key string, data []byte) error {
+	dir := filepath.Dir(c.path(key))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.path(key))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// Delete 删除单个条目
+func (c *Cache) Delete(key string) bool {
+	c.init()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	el, ok := c.entries[key]
+	if ok {
+		c.remove(el)
+	}
+	return ok
+}
+
+// Purge 清空缓存
+func (c *Cache) Purge() {
+	c.init()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+// List 所有条目, 按最近使用排序
+func (c *Cache) List() []Entry {
+	c.init()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entries := make([]Entry, 0, c.lru.Len())
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		e := *el.Value.(*Entry)
+		e.data = nil
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func (c *Cache) Stats() Stats {
+	c.init()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return Stats{Dir: c.Dir, Entries: len(c.entries), Size: c.size, MaxSize: c.MaxSize, Hits: c.hits, Misses: c.misses}
+}
+
+func (c *Cache) expired(e *Entry) bool {
+	return c.TTL > 0 && time.Since(e.Created) > c.TTL
+}
+
+/* 淘汰过期及超出大小的条目, 调用前需持有锁 */
+func (c *Cache) evict() {
+	for el := c.lru.Back(); el != nil; {
+		prev := el.Prev()
+		if c.size > c.MaxSize || c.expired(el.Value.(*Entry)) {
+			c.remove(el)
+		}
+		el = prev
+	}
+}
+
+/* 移除条目及其文件, 调用前需持有锁 */
+func (c *Cache) remove(el *list.Element) {
+	e := c.unlink(el)
+	if c.Dir != "" {
+		if err := os.Remove(c.path(e.Key)); err != nil && !os.IsNotExist(err) {
+			log.Warnln("删除缓存失败:", err)
+		}
+	}
+}
+
+/* 仅从LRU中移除条目, 调用前需持有锁 */
+func (c *Cache) unlink(el *list.Element) *Entry {
+	e := c.lru.Remove(el).(*Entry)
+	delete(c.entries, e.Key)
+	c.size -= e.Size
+	return e
+}
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKey(t *testing.T) {
+	k1 := Key("edge", "mp3", NormalizeSsml("<speak>\n  <voice name=\"a\">  测试</voice>\n</speak>"))
+	k2 := Key("edge", "mp3", NormalizeSsml("<speak><voice name=\"a\"> 测试</voice></speak>"))
+	if k1 != k2 {
+		t.Fatal("normalized ssml should have same key")
+	}
+	if k1 == Key("azure", "mp3", NormalizeSsml("<speak><voice name=\"a\"> 测试</voice></speak>")) {
+		t.Fatal("different engine should have different key")
+	}
+	if !keyRegexp.MatchString(k1) {
+		t.Fatalf("invalid key: %s", k1)
+	}
+}
+
+func TestMemoryLRU(t *testing.T) {
+	c := &Cache{MaxSize: 10}
+	a, b, d := Key("", "", "a"), Key("", "", "b"), Key("", "", "d")
+	_ = c.Put(a, []byte("aaaa"))
+	_ = c.Put(b, []byte("bbbb"))
+	if _, ok := c.Get(a); !ok { /* a 变为最近使用 */
+		t.Fatal("a should be cached")
+	}
+	_ = c.Put(d, []byte("dddd"))
+
+	if _, ok := c.Get(b); ok {
+		t.Fatal("b should be evicted")
+	}
+	if data, ok := c.Get(a); !ok || string(data) != "aaaa" {
+		t.Fatal("a should be cached")
+	}
+	stats := c.Stats()
+	if stats.Entries != 2 || stats.Size != 8 || stats.Hits != 2 || stats.Misses != 1 {
+		t.Fatalf("stats: %+v", stats)
+	}
+
+	_ = c.Put(Key("", "", "big"), make([]byte, 11))
+	if c.Stats().Entries != 2 {
+		t.Fatal("entry larger than MaxSize should be ignored")
+	}
+}
+
+func TestTTL(t *testing.T) {
+	c := &Cache{TTL: time.Millisecond * 10}
+	key := Key("", "", "a")
+	_ = c.Put(key, []byte("a"))
+	time.Sleep(time.Millisecond * 20)
+	if _, ok := c.Get(key); ok {
+		t.Fatal("entry should be expired")
+	}
+}
+
+func TestDisk(t *testing.T) {
+	dir := t.TempDir()
+	c := &Cache{Dir: dir}
+	key := Key("edge", "mp3", "a")
+	if err := c.Put(key, []byte("audio")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, key[:2], key)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Put(key, []byte("audio2")); err != nil { /* 替换时保留新文件 */
+		t.Fatal(err)
+	}
+	if data, ok := c.Get(key); !ok || string(data) != "audio2" {
+		t.Fatalf("%q", data)
+	}
+	_ = c.Put(key, []byte("audio"))
+
+	tmp := filepath.Join(dir, key[:2], "tmp-123") /* 上次退出时未写完的文件 */
+	if err := os.WriteFile(tmp, []byte("aud"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c2 := &Cache{Dir: dir} /* 重新加载 */
+	data, ok := c2.Get(key)
+	if !ok || string(data) != "audio" {
+		t.Fatal("cache should be loaded from disk")
+	}
+	if entries := c2.List(); len(entries) != 1 || entries[0].Hits != 1 {
+		t.Fatalf("entries: %+v", entries)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Fatal("temp file should be removed")
+	}
+
+	c2.Purge()
+	if _, err := os.Stat(filepath.Join(dir, key[:2], key)); !os.IsNotExist(err) {
+		t.Fatal("file should be removed")
+	}
+}
+
+func TestDiskTTLAfterReload(t *testing.T) {
+	dir := t.TempDir()
+	key := Key("edge", "mp3", "a")
+	if err := (&Cache{Dir: dir}).Put(key, []byte("audio")); err != nil {
+		t.Fatal(err)
+	}
+	created := time.Now().Add(-time.Hour).Truncate(time.Second) /* 一小时前写入 */
+	if err := os.Chtimes(filepath.Join(dir, key[:2], key), created, created); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Cache{Dir: dir, TTL: 2 * time.Hour}
+	if _, ok := c.Get(key); !ok {
+		t.Fatal("entry should not be expired")
+	}
+	if entries := c.List(); len(entries) != 1 || !entries[0].Created.Equal(created) {
+		t.Fatalf("entries: %+v", entries)
+	}
+	/* 命中不延长过期时间 */
+	if _, ok := (&Cache{Dir: dir, TTL: 30 * time.Minute}).Get(key); ok {
+		t.Fatal("entry should be expired after reload")
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	tts_server_go "github.com/jing332/tts-server-go"
 	"github.com/jing332/tts-server-go/tts"
+	"github.com/jing332/tts-server-go/tts/audio"
+	"github.com/jing332/tts-server-go/tts/segment"
+	"github.com/jing332/tts-server-go/tts/ssml"
 	"io"
 	"net/http"
 	"strings"
@@ -19,6 +21,9 @@ const (
 	speakUrl  = "https://southeastasia.customvoice.api.speech.microsoft.com/api/texttospeech/v3.0-beta1/accdemopage/speak"
 )
 
+// MaxTextLength 单次请求的最大文本长度
+const MaxTextLength = 290
+
 var (
 	// TokenErr Token已失效
 	TokenErr          = errors.New("unauthorized")
@@ -34,14 +39,17 @@ func New() *TTS {
 	return &TTS{Client: &http.Client{}}
 }
 
-// ToSsml 转为完整的SSML
+/* SSML嵌入在请求体的JSON字符串中 */
+var jsonEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// ToSsml 转为完整的SSML, text为纯文本, 在此转义
 func ToSsml(text string, pro *tts.VoiceProperty) string {
 	pro.Api = tts.ApiCreation
 	ssml := `<!--ID=B7267351-473F-409D-9765-754A8EBCDE05;Version=1|{\"VoiceNameToIdMapItems\":[{\"Id\":\"` +
 		pro.VoiceId + `\",\"Name\":\"Microsoft Server Speech Text to Speech Voice (zh-CN, XiaoxiaoNeural)\",\"ShortName\":\"` +
 		pro.VoiceName + `\",\"Locale\":\"zh-CN\",\"VoiceType\":\"StandardVoice\"}]}-->\n<!--ID=5B95B1CC-2C7B-494F-B746-CF22A0E779B7;Version=1|{\"Locales\":{\"zh-CN\":{\"AutoApplyCustomLexiconFiles\":[{}]}}}-->\n` +
 		`<speak version=\"1.0\" xmlns=\"http://www.w3.org/2001/10/synthesis\" xmlns:mstts=\"http://www.w3.org/2001/mstts\" xmlns:emo=\"http://www.w3.org/2009/10/emotionml\" xml:lang=\"zh-CN\">` +
-		strings.ReplaceAll(pro.ElementString(text), `"`, `\"`) + `</speak>`
+		jsonEscaper.Replace(ssml.String(pro.Node(ssml.Text(text)))) + `</speak>`
 
 	return ssml
 }
@@ -50,40 +58,39 @@ func (t *TTS) GetAudio(text, format string, pro *tts.VoiceProperty) (audio []byt
 	return t.GetAudioUseContext(nil, text, format, pro)
 }
 
-func (t *TTS) GetAudioUseContext(ctx context.Context, text, format string, pro *tts.VoiceProperty) (audio []byte, err error) {
+func (t *TTS) GetAudioUseContext(ctx context.Context, text, format string, pro *tts.VoiceProperty) (data []byte, err error) {
 	if t.token == "" {
-		s, err := GetToken()
+		s, err := getToken(t.Client)
 		if err != nil {
 			return nil, fmt.Errorf("获取token失败：%v", err)
 		}
 		t.token = s
 	}
 
-	/* 接口限制 文本长度不能超300 */
-	if utf8.RuneCountInString(text) > 295 {
-		chunks := tts_server_go.ChunkString(text, 290)
-		for _, v := range chunks {
-			data, err := t.GetAudioUseContext(ctx, v, format, pro)
+	/* 接口限制 文本长度不能超300, 按句子切分 */
+	if utf8.RuneCountInString(text) > MaxTextLength {
+		var chunks [][]byte
+		for _, v := range segment.SplitText(text, MaxTextLength) {
+			chunk, err := t.GetAudioUseContext(ctx, v, format, pro)
 			if err != nil {
 				return nil, err
 			}
-			audio = append(audio, data...)
+			chunks = append(chunks, chunk)
 		}
-		return audio, nil
+		return audio.Join(format, chunks)
 	}
 
 	ssml := ToSsml(text, pro)
-	audio, err = t.speakBySsml(ctx, ssml, format)
+	data, err = t.speakBySsml(ctx, ssml, format)
 	if err != nil {
 		if errors.Is(err, TokenErr) { /* Token已失效 */
 			t.token = ""
-			audio, err = t.GetAudioUseContext(ctx, text, format, pro)
-		} else {
-			return nil, err
+			return t.GetAudioUseContext(ctx, text, format, pro)
 		}
+		return nil, err
 	}
 
-	return audio, nil
+	return data, nil
 }
 
 func (t *TTS) speakBySsml(ctx context.Context, ssml, format string) ([]byte, error) {
@@ -113,7 +120,7 @@ func (t *TTS) speakBySsml(ctx context.Context, ssml, format string) ([]byte, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusUnauthorized {
-		return nil, TokenErr
+		return nil, &tts.StatusError{Code: resp.StatusCode, Status: resp.Status, Err: TokenErr}
 	}
 
 	data, err := io.ReadAll(resp.Body)
@@ -122,13 +129,17 @@ func (t *TTS) speakBySsml(ctx context.Context, ssml, format string) ([]byte, err
 	}
 
 	if resp.StatusCode != http.StatusOK { /* 服务器返回错误 大概率是SSML格式问题 和 频率过高 */
-		return nil, errors.New(string(data))
+		return nil, &tts.StatusError{Code: resp.StatusCode, Status: resp.Status, Err: errors.New(string(data))}
 	}
 
 	return data, nil
 }
 
 func GetVoices(token string) ([]byte, error) {
+	return getVoices(http.DefaultClient, token)
+}
+
+func getVoices(client *http.Client, token string) ([]byte, error) {
 	payload := strings.NewReader(`{"queryCondition":{"items":[{"name":"VoiceTypeList","value":"StandardVoice","operatorKind":"Contains"}]}}`)
 
 	req, err := http.NewRequest(http.MethodPost, voicesUrl, payload)
@@ -141,14 +152,14 @@ func GetVoices(token string) ([]byte, error) {
 	req.Header.Add("X-Ms-Useragent", "SpeechStudio/2021.05.001")
 	req.Header.Add("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%v: %v, %v", httpStatusCodeErr, resp.StatusCode, resp.Status)
+		return nil, &tts.StatusError{Code: resp.StatusCode, Status: resp.Status, Err: httpStatusCodeErr}
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -159,14 +170,18 @@ func GetVoices(token string) ([]byte, error) {
 }
 
 func GetToken() (string, error) {
-	resp, err := http.Get(tokenUrl)
+	return getToken(http.DefaultClient)
+}
+
+func getToken(client *http.Client) (string, error) {
+	resp, err := client.Get(tokenUrl)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("%v: %v, %v", httpStatusCodeErr, resp.StatusCode, resp.Status)
+		return "", &tts.StatusError{Code: resp.StatusCode, Status: resp.Status, Err: httpStatusCodeErr}
 	}
 
 	value := make(map[string]string)
@@ -26,7 +26,8 @@ func TestGetAudioUseContext(t *testing.T) {
 	text := "我是测试文本"
 	format := "audio-48khz-96kbitrate-mono-mp3"
 
-	ctx, _ := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	c := &TTS{Client: &http.Client{Timeout: time.Second * 2}}
 	go func() {
 		//time.Sleep(500)
@@ -0,0 +1,68 @@
+package creation
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jing332/tts-server-go/tts"
+	"github.com/jing332/tts-server-go/tts/proxy"
+)
+
+// Engine 微软有声内容创作引擎，实现 tts.Engine
+type Engine struct {
+	Proxy *proxy.Proxy // 出站代理, 为空时按环境变量选择
+
+	lock sync.Mutex
+	tts  *TTS
+}
+
+func (e *Engine) Synthesize(ctx context.Context, req *tts.SpeakRequest) ([]byte, error) {
+	if req.Voice == nil {
+		return nil, errors.New("creation: 缺少发音人参数")
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.tts == nil {
+		e.tts = &TTS{Client: e.Proxy.Client()}
+	}
+
+	audio, err := e.tts.GetAudioUseContext(ctx, req.Text, req.Format, req.Voice)
+	if err != nil && !errors.Is(err, context.Canceled) { /* 重新获取Token */
+		e.tts = nil
+	}
+	return audio, err
+}
+
+// SynthesizeStream 接口不支持流式传输，合成完毕后一次性回调
+func (e *Engine) SynthesizeStream(ctx context.Context, req *tts.SpeakRequest, read func([]byte)) error {
+	audio, err := e.Synthesize(ctx, req)
+	if err != nil {
+		return err
+	}
+	read(audio)
+	return nil
+}
+
+func (e *Engine) Voices(ctx context.Context) ([]tts.Voice, error) {
+	data, err := e.RawVoices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseVoices(data)
+}
+
+// RawVoices Creation原始发音人列表
+func (e *Engine) RawVoices(context.Context) ([]byte, error) {
+	client := e.Proxy.Client()
+	token, err := getToken(client)
+	if err != nil {
+		return nil, err
+	}
+	return getVoices(client, token)
+}
+
+func (e *Engine) Close() error {
+	return nil
+}
@@ -0,0 +1,45 @@
+package creation
+
+import (
+	"encoding/json"
+
+	"github.com/jing332/tts-server-go/tts"
+)
+
+/* Creation发音人列表中的一项, 风格与角色等为逗号分隔的字符串 */
+type creationVoice struct {
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	Locale     string `json:"locale"`
+	Gender     string `json:"gender"`
+	Properties struct {
+		DisplayName       string `json:"DisplayName"`
+		LocalName         string `json:"LocalName"`
+		ShortName         string `json:"ShortName"`
+		Gender            string `json:"Gender"`
+		LocaleDescription string `json:"LocaleDescription"`
+		VoiceStyleNames   string `json:"VoiceStyleNames"`
+		VoiceRoleNames    string `json:"VoiceRoleNames"`
+		SecondaryLocales  string `json:"SecondaryLocales"`
+	} `json:"properties"`
+}
+
+// ParseVoices 将 GetVoices 返回的JSON转为统一格式
+func ParseVoices(data []byte) ([]tts.Voice, error) {
+	var list []creationVoice
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	voices := make([]tts.Voice, 0, len(list))
+	for _, v := range list {
+		p := v.Properties
+		gender := v.Gender
+		if gender == "" {
+			gender = p.Gender
+		}
+		voices = append(voices, tts.Voice{Engine: tts.EngineCreation, Id: v.Id, Name: v.Name, ShortName: p.ShortName,
+			DisplayName: p.DisplayName, LocalName: p.LocalName, Locale: v.Locale, LocaleName: p.LocaleDescription, Gender: gender,
+			Styles: tts.SplitList(p.VoiceStyleNames), Roles: tts.SplitList(p.VoiceRoleNames), SecondaryLocales: tts.SplitList(p.SecondaryLocales)})
+	}
+	return voices, nil
+}
@@ -0,0 +1,26 @@
+package creation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jing332/tts-server-go/tts"
+)
+
+func TestParseVoices(t *testing.T) {
+	data := []byte(`[{"id":"5f55541d-c844-4e04-a7f8-1723ffbea4a9","name":"Microsoft Server Speech Text to Speech Voice (zh-CN, XiaoxiaoNeural)",
+		"locale":"zh-CN","gender":"Female","voiceType":"StandardVoice","properties":{"DisplayName":"Xiaoxiao","LocalName":"晓晓",
+		"ShortName":"zh-CN-XiaoxiaoNeural","LocaleDescription":"Chinese (Mandarin, Simplified)","VoiceStyleNames":"affectionate,angry,",
+		"VoiceRoleNames":"","SecondaryLocales":""}}]`)
+	voices, err := ParseVoices(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := tts.Voice{Engine: tts.EngineCreation, Id: "5f55541d-c844-4e04-a7f8-1723ffbea4a9",
+		Name: "Microsoft Server Speech Text to Speech Voice (zh-CN, XiaoxiaoNeural)", ShortName: "zh-CN-XiaoxiaoNeural",
+		DisplayName: "Xiaoxiao", LocalName: "晓晓", Locale: "zh-CN", LocaleName: "Chinese (Mandarin, Simplified)", Gender: "Female",
+		Styles: []string{"affectionate", "angry"}}
+	if len(voices) != 1 || !reflect.DeepEqual(voices[0], want) {
+		t.Fatalf("%+v", voices)
+	}
+}
@@ -0,0 +1,115 @@
+// Package dialogue 识别小说中的引号对话与说话人, 用于旁白与对话使用不同的发音人
+package dialogue
+
+import (
+	"strings"
+)
+
+/* 支持的引号, ASCII双引号开闭相同 */
+var quotePairs = map[rune]rune{'“': '”', '「': '」', '『': '』', '"': '"'}
+
+const sentenceEnds = "。！？!?…\n"
+
+// Segment 旁白或对话
+type Segment struct {
+	Text    string // 对话不包含引号
+	Quoted  bool   // 引号内的对话
+	Speaker string // 根据说话人名称识别, 未识别时为空
+}
+
+// Split 将文本切分为旁白与对话, speakers 为说话人名称。
+// 说话人按对话前一句旁白(如 张三说：)中最后出现的名称识别, 其次为对话后一句旁白(如 ”张三说。)中最先出现的名称。
+// 未闭合的引号作为旁白
+func Split(text string, speakers []string) []Segment {
+	var segments []Segment
+	runes := []rune(text)
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		closeQuote, ok := quotePairs[runes[i]]
+		if !ok {
+			continue
+		}
+		end := -1
+		for j := i + 1; j < len(runes); j++ {
+			if runes[j] == closeQuote {
+				end = j
+				break
+			}
+		}
+		if end < 0 {
+			break
+		}
+
+		segments = appendSegment(segments, Segment{Text: string(runes[start:i])})
+		segments = appendSegment(segments, Segment{Text: string(runes[i+1 : end]), Quoted: true})
+		start = end + 1
+		i = end
+	}
+	segments = appendSegment(segments, Segment{Text: string(runes[start:])})
+
+	for i := range segments {
+		if !segments[i].Quoted {
+			continue
+		}
+		if i > 0 && !segments[i-1].Quoted {
+			segments[i].Speaker = lastName(lastSentence(segments[i-1].Text), speakers)
+		}
+		if segments[i].Speaker == "" && i+1 < len(segments) && !segments[i+1].Quoted {
+			segments[i].Speaker = firstName(firstSentence(segments[i+1].Text), speakers)
+		}
+	}
+	return segments
+}
+
+/* 忽略空白的旁白与空对话 */
+func appendSegment(segments []Segment, s Segment) []Segment {
+	if strings.TrimSpace(s.Text) == "" {
+		return segments
+	}
+	return append(segments, s)
+}
+
+func lastSentence(s string) string {
+	s = strings.TrimRight(s, " \t\r\n")
+	if i := strings.LastIndexAny(s, sentenceEnds); i >= 0 {
+		return s[i:]
+	}
+	return s
+}
+
+func firstSentence(s string) string {
+	if i := strings.IndexAny(s, sentenceEnds); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+/* 最后出现的名称, 多个名称在同一位置时取较长的 */
+func lastName(s string, names []string) string {
+	var found string
+	pos := -1
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if i := strings.LastIndex(s, name); i > pos || i == pos && i >= 0 && len(name) > len(found) {
+			found, pos = name, i
+		}
+	}
+	return found
+}
+
+/* 最先出现的名称, 多个名称在同一位置时取较长的 */
+func firstName(s string, names []string) string {
+	var found string
+	pos := len(s) + 1
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if i := strings.Index(s, name); i >= 0 && (i < pos || i == pos && len(name) > len(found)) {
+			found, pos = name, i
+		}
+	}
+	return found
+}
@@ -0,0 +1,29 @@
+package dialogue
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	speakers := []string{"张三", "李四", "张三丰"}
+	tests := []struct {
+		text string
+		want []Segment
+	}{
+		{`张三笑着说：“你好。”李四点头。`, []Segment{
+			{Text: "张三笑着说："}, {Text: "你好。", Quoted: true, Speaker: "张三"}, {Text: "李四点头。"}}},
+		{`“走吧，”李四说，“天快黑了。”`, []Segment{
+			{Text: "走吧，", Quoted: true, Speaker: "李四"}, {Text: "李四说，"}, {Text: "天快黑了。", Quoted: true, Speaker: "李四"}}},
+		{"张三走了。\n「等等！」张三丰喊道。", []Segment{
+			{Text: "张三走了。\n"}, {Text: "等等！", Quoted: true, Speaker: "张三丰"}, {Text: "张三丰喊道。"}}},
+		{`他说："Hi" 『嗯』`, []Segment{
+			{Text: "他说："}, {Text: "Hi", Quoted: true}, {Text: "嗯", Quoted: true}}},
+		{`“没有闭合`, []Segment{{Text: "“没有闭合"}}},
+	}
+	for _, tt := range tests {
+		if got := Split(tt.text, speakers); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s: %+v", tt.text, got)
+		}
+	}
+}
@@ -2,14 +2,17 @@ package edge
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/gorilla/websocket"
-	tsg "github.com/jing332/tts-server-go"
+	"github.com/jing332/tts-server-go/tts"
+	"github.com/jing332/tts-server-go/tts/protocol"
+	"github.com/jing332/tts-server-go/tts/proxy"
 	log "github.com/sirupsen/logrus"
-	"math/rand"
 	"net"
 	"net/http"
-	"strings"
+	"strconv"
+	"sync"
 	"time"
 )
 
@@ -17,20 +20,25 @@ const (
 	wssUrl = `wss://speech.platform.bing.com/consumer/speech/synthesize/readaloud/edge/v1?TrustedClientToken=6A5AA1D4EAFF4E9FB37E23D68491D6F4&ConnectionId=`
 )
 
+// TTS 单个WebSocket连接，可同时处理多个请求，按 X-RequestId 区分
 type TTS struct {
-	DnsLookupEnabled bool // 使用DNS解析，而不是北京微软云节点。
-	DialTimeout      time.Duration
-	WriteTimeout     time.Duration
+	DnsLookupEnabled bool     // 使用DNS解析，而不是北京微软云节点。
+	IpList           []string // 自定义节点IP, 为空时使用 ChinaIpList
+	// Endpoints 节点选择, 可在多个连接间共用, 为空时按 IpList 创建
+	Endpoints    *Endpoints
+	Proxy        *proxy.Proxy // 出站代理, 为空时按环境变量选择
+	DialTimeout  time.Duration
+	WriteTimeout time.Duration
 
 	dialContextCancel context.CancelFunc
 
-	uuid          string
-	conn          *websocket.Conn
-	onReadMessage TReadMessage
+	conn      *websocket.Conn
+	dialLock  sync.Mutex
+	writeLock sync.Mutex /* 保证config与ssml消息连续发送 */
+	lock      sync.Mutex
+	mux       protocol.Mux
 }
 
-type TReadMessage func(messageType int, p []byte, errMessage error) (finished bool)
-
 func (t *TTS) NewConn() error {
 	log.Infoln("创建WebSocket连接(Edge)...")
 	if t.WriteTimeout == 0 {
@@ -44,17 +52,24 @@ func (t *TTS) NewConn() error {
 		EnableCompression: true,
 	}
 
-	if !t.DnsLookupEnabled {
-		dialer := &net.Dialer{}
-		dl.NetDial = func(network, addr string) (net.Conn, error) {
-			if addr == "speech.platform.bing.com:443" {
-				rand.Seed(time.Now().Unix())
-				i := rand.Intn(len(ChinaIpList))
-				addr = fmt.Sprintf("%s:443", ChinaIpList[i])
+	var ip string /* 本次连接使用的节点, 握手结束后记录结果 */
+	if !t.DnsLookupEnabled && t.Endpoints == nil {
+		t.Endpoints = &Endpoints{IpList: t.IpList, Proxy: t.Proxy}
+	}
+	dl.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		proxyURL, err := t.Proxy.ProxyURL(addr) /* 按主机名判断 NO_PROXY */
+		if err != nil {
+			return nil, err
+		}
+		if !t.DnsLookupEnabled && addr == edgeHost+":443" {
+			if ip = t.Endpoints.Pick(); ip != "" {
+				addr = net.JoinHostPort(ip, "443")
+			} else {
+				log.Warnln("Edge节点均不可用, 使用DNS解析")
 			}
-			log.Infoln("connect to IP: " + addr)
-			return dialer.Dial(network, addr)
 		}
+		log.Infoln("connect to IP: " + addr)
+		return proxy.Dial(ctx, proxyURL, network, addr)
 	}
 
 	header := http.Header{}
@@ -69,93 +84,172 @@ func (t *TTS) NewConn() error {
 		t.dialContextCancel = nil
 	}()
 
-	var err error
-	var resp *http.Response
-	t.conn, resp, err = dl.DialContext(ctx, wssUrl+t.uuid, header)
+	conn, resp, err := dl.DialContext(ctx, wssUrl+protocol.NewRequestId(), header)
 	if err != nil {
 		if resp == nil {
+			if ip != "" && !errors.Is(err, context.Canceled) { /* 主动取消不代表节点不可用 */
+				t.Endpoints.Report(ip, err)
+			}
 			return err
 		}
-		return fmt.Errorf("%w: %s", err, resp.Status)
+		return &tts.StatusError{Code: resp.StatusCode, Status: resp.Status, Err: err}
+	}
+	if ip != "" {
+		t.Endpoints.Report(ip, nil)
 	}
 
-	go func() {
-		for {
-			if t.conn == nil {
-				return
-			}
-			messageType, p, err := t.conn.ReadMessage()
-			closed := t.onReadMessage(messageType, p, err)
-			if closed {
-				t.conn = nil
-				return
-			}
-		}
-	}()
+	t.lock.Lock()
+	t.conn = conn
+	t.lock.Unlock()
+	go t.readLoop(conn)
 
 	return nil
 }
 
-func (t *TTS) CloseConn() {
-	if t.conn != nil {
-		_ = t.conn.Close()
-		t.conn = nil
+/* 连接已断开时重新连接 */
+func (t *TTS) ensureConn() error {
+	t.dialLock.Lock()
+	defer t.dialLock.Unlock()
+	if t.Alive() {
+		return nil
 	}
+	return t.NewConn()
 }
 
-func (t *TTS) GetAudio(ssml, format string) (audioData []byte, err error) {
-	t.uuid = tsg.GetUUID()
-	if t.conn == nil {
-		err := t.NewConn()
+func (t *TTS) readLoop(conn *websocket.Conn) {
+	for {
+		messageType, p, err := conn.ReadMessage()
+		if err != nil { /* 已经断开链接, 通知所有请求 */
+			t.closeWithError(conn, err)
+			return
+		}
+
+		msg, err := protocol.Parse(messageType, p)
 		if err != nil {
-			return nil, err
+			log.Warnln("解析消息失败(Edge):", err)
+			continue
 		}
+		t.mux.Dispatch(msg)
 	}
+}
 
-	running := true
-	defer func() { running = false }()
-	var finished = make(chan bool)
-	var failed = make(chan error)
-	t.onReadMessage = func(messageType int, p []byte, errMessage error) bool {
-		if messageType == -1 && p == nil && errMessage != nil { //已经断开链接
-			if running {
-				failed <- errMessage
-			}
-			return true
-		}
+/* 关闭连接并使所有进行中的请求失败 */
+func (t *TTS) closeWithError(conn *websocket.Conn, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.conn != conn {
+		return
+	}
+	_ = conn.Close()
+	t.conn = nil
+	t.mux.Fail(err)
+}
 
-		if messageType == websocket.BinaryMessage {
-			index := strings.Index(string(p), "Path:audio")
-			data := []byte(string(p)[index+12:])
-			audioData = append(audioData, data...)
-		} else if messageType == websocket.TextMessage && string(p)[len(string(p))-14:len(string(p))-6] == "turn.end" {
-			finished <- true
-			return false
-		}
-		return false
+// Alive 连接是否可用
+func (t *TTS) Alive() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.conn != nil
+}
+
+// Ping 发送Ping控制帧，失败则断开连接
+func (t *TTS) Ping() error {
+	t.lock.Lock()
+	conn := t.conn
+	t.lock.Unlock()
+	if conn == nil {
+		return websocket.ErrCloseSent
 	}
-	err = t.sendConfigMessage(format)
+	err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(t.WriteTimeout))
 	if err != nil {
-		return nil, err
+		t.closeWithError(conn, err)
 	}
-	err = t.sendSsmlMessage(ssml)
+	return err
+}
+
+func (t *TTS) Close() error {
+	t.CloseConn()
+	return nil
+}
+
+func (t *TTS) CloseConn() {
+	t.lock.Lock()
+	conn := t.conn
+	t.lock.Unlock()
+	if conn != nil {
+		t.closeWithError(conn, &websocket.CloseError{Code: websocket.CloseNormalClosure})
+	}
+}
+
+func (t *TTS) GetAudio(ssml, format string) (audioData []byte, err error) {
+	err = t.GetAudioStream(ssml, format, func(bytes []byte) {
+		audioData = append(audioData, bytes...)
+	})
+	return audioData, err
+}
+
+func (t *TTS) GetAudioStream(ssml, format string, read func([]byte)) error {
+	return t.GetAudioStreamUseContext(context.Background(), ssml, format, read)
+}
+
+// GetAudioStreamUseContext 可与其他请求并发调用。ctx取消时仅丢弃该请求的后续数据，不影响连接
+func (t *TTS) GetAudioStreamUseContext(ctx context.Context, ssml, format string, read func([]byte)) error {
+	return t.speak(ctx, &tts.SpeakRequest{Ssml: ssml, Format: format}, read)
+}
+
+func (t *TTS) speak(ctx context.Context, req *tts.SpeakRequest, read func([]byte)) error {
+	err := t.ensureConn()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	select {
-	case <-finished:
-		return audioData, err
-	case errMessage := <-failed:
-		return nil, errMessage
+	id := protocol.NewRequestId()
+	t.lock.Lock()
+	conn := t.conn
+	t.lock.Unlock()
+	if conn == nil {
+		return &websocket.CloseError{Code: websocket.CloseAbnormalClosure}
+	}
+	s := protocol.NewStream(read)
+	if req.OnBoundary != nil {
+		s.OnMetadata = func(msg *protocol.Message) {
+			boundaries, err := protocol.ParseMetadata(msg.Body)
+			if err != nil {
+				log.Warnln("解析边界事件失败:", err)
+			}
+			for _, b := range boundaries {
+				req.OnBoundary(b)
+			}
+		}
+	}
+	t.mux.Add(id, s)
+	defer t.mux.Remove(id)
+
+	err = t.send(conn, id, req)
+	if err != nil {
+		t.closeWithError(conn, err)
+		return err
+	}
+
+	return s.Wait(ctx)
+}
+
+func (t *TTS) send(conn *websocket.Conn, id string, req *tts.SpeakRequest) error {
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+	err := t.sendConfigMessage(conn, req)
+	if err != nil {
+		return err
 	}
+	return t.sendSsmlMessage(conn, id, req.Ssml)
 }
 
-func (t *TTS) sendConfigMessage(format string) error {
-	cfgMsg := "X-Timestamp:" + tsg.GetISOTime() + "\r\nContent-Type:application/json; charset=utf-8\r\n" + "Path:speech.config\r\n\r\n" +
-		`{"context":{"synthesis":{"audio":{"metadataoptions":{"sentenceBoundaryEnabled":"false","wordBoundaryEnabled":"false"},"outputFormat":"` + format + `"}}}}`
-	_ = t.conn.SetWriteDeadline(time.Now().Add(t.WriteTimeout))
-	err := t.conn.WriteMessage(websocket.TextMessage, []byte(cfgMsg))
+func (t *TTS) sendConfigMessage(conn *websocket.Conn, req *tts.SpeakRequest) error {
+	cfgMsg := protocol.TextMessage(protocol.PathSpeechConfig, "", "application/json; charset=utf-8",
+		`{"context":{"synthesis":{"audio":{"metadataoptions":{"sentenceBoundaryEnabled":"`+strconv.FormatBool(req.SentenceBoundary)+
+			`","wordBoundaryEnabled":"`+strconv.FormatBool(req.WordBoundary)+`"},"outputFormat":"`+req.Format+`"}}}}`)
+	_ = conn.SetWriteDeadline(time.Now().Add(t.WriteTimeout))
+	err := conn.WriteMessage(websocket.TextMessage, cfgMsg)
 	if err != nil {
 		return fmt.Errorf("发送Config失败: %s", err)
 	}
@@ -163,10 +257,10 @@ func (t *TTS) sendConfigMessage(format string) error {
 	return nil
 }
 
-func (t *TTS) sendSsmlMessage(ssml string) error {
-	msg := "Path: ssml\r\nX-RequestId: " + t.uuid + "\r\nX-Timestamp: " + tsg.GetISOTime() + "\r\nContent-Type: application/ssml+xml\r\n\r\n" + ssml
-	_ = t.conn.SetWriteDeadline(time.Now().Add(t.WriteTimeout))
-	err := t.conn.WriteMessage(websocket.TextMessage, []byte(msg))
+func (t *TTS) sendSsmlMessage(conn *websocket.Conn, id, ssml string) error {
+	msg := protocol.TextMessage(protocol.PathSsml, id, "application/ssml+xml", ssml)
+	_ = conn.SetWriteDeadline(time.Now().Add(t.WriteTimeout))
+	err := conn.WriteMessage(websocket.TextMessage, msg)
 	if err != nil {
 		return err
 	}
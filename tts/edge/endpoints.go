@@ -0,0 +1,287 @@
+package edge
+
+import (
+	"context"
+	"crypto/tls"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jing332/tts-server-go/tts/proxy"
+	log "github.com/sirupsen/logrus"
+)
+
+const edgeHost = "speech.platform.bing.com"
+
+// Endpoints Edge节点管理, 定期探测各节点的TLS握手延迟并排序, 连接时使用延迟最低的可用节点,
+// 探测或连接失败的节点被隔离, 隔离时间按连续失败次数加倍, 探测成功后恢复
+type Endpoints struct {
+	IpList        []string      // 节点IP, 为空时使用 ChinaIpList
+	DnsFallback   bool          // 所有节点都被隔离时使用DNS解析
+	ProbeInterval time.Duration // 探测间隔, 默认5min
+	ProbeTimeout  time.Duration // 单个节点探测超时, 默认3s
+	Quarantine    time.Duration // 首次失败的隔离时间, 默认1min, 最长30min
+
+	Proxy *proxy.Proxy // 出站代理, 为空时按环境变量选择
+
+	// Probe 探测节点并返回延迟, 为空时测量与该IP的TLS握手时间(经代理时包括代理的耗时)
+	Probe func(ctx context.Context, ip string) (time.Duration, error)
+
+	once  sync.Once
+	lock  sync.Mutex
+	nodes []*node
+	stop  chan struct{}
+}
+
+type node struct {
+	ip       string
+	latency  time.Duration
+	probed   time.Time
+	failures int
+	until    time.Time /* 隔离结束时间 */
+	lastErr  error
+	order    int /* 未探测节点的随机顺序 */
+}
+
+// NodeStatus 节点状态
+type NodeStatus struct {
+	IP          string     `json:"ip"`
+	Rank        int        `json:"rank"`                  // 排名, 从1开始, 隔离中的节点为0
+	Latency     int64      `json:"latency"`               // 最近一次探测的TLS握手延迟(ms), 未探测为0
+	Probed      *time.Time `json:"probed,omitempty"`      // 最近一次探测成功的时间
+	Failures    int        `json:"failures"`              // 连续失败次数
+	Quarantined *time.Time `json:"quarantined,omitempty"` // 隔离中时, 隔离结束的时间
+	LastError   string     `json:"lastError,omitempty"`
+}
+
+func (e *Endpoints) init() {
+	e.once.Do(func() {
+		if e.ProbeInterval <= 0 {
+			e.ProbeInterval = 5 * time.Minute
+		}
+		if e.ProbeTimeout <= 0 {
+			e.ProbeTimeout = 3 * time.Second
+		}
+		if e.Quarantine <= 0 {
+			e.Quarantine = time.Minute
+		}
+		if e.Probe == nil {
+			e.Probe = e.probeTls
+		}
+		ipList := e.IpList
+		if len(ipList) == 0 {
+			ipList = ChinaIpList
+		}
+		seen := make(map[string]bool, len(ipList))
+		for _, ip := range ipList {
+			if !seen[ip] {
+				seen[ip] = true
+				e.nodes = append(e.nodes, &node{ip: ip, order: rand.Int()})
+			}
+		}
+	})
+}
+
+/* 与节点进行TLS握手, 返回耗时 */
+func (e *Endpoints) probeTls(ctx context.Context, ip string) (time.Duration, error) {
+	proxyURL, err := e.Proxy.ProxyURL(edgeHost + ":443")
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	conn, err := proxy.Dial(ctx, proxyURL, "tcp", net.JoinHostPort(ip, "443"))
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err = tls.Client(conn, &tls.Config{ServerName: edgeHost}).HandshakeContext(ctx); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+// Start 立即探测一次, 之后在后台定期探测, 直到 Close
+func (e *Endpoints) Start() {
+	e.init()
+	e.lock.Lock()
+	if e.stop != nil {
+		e.lock.Unlock()
+		return
+	}
+	e.stop = make(chan struct{})
+	stop := e.stop
+	e.lock.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(e.ProbeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop: /* 启动后立即关闭 */
+				return
+			default:
+			}
+			e.ProbeAll(context.Background())
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close 停止后台探测
+func (e *Endpoints) Close() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.stop != nil {
+		close(e.stop)
+		e.stop = nil
+	}
+}
+
+// ProbeAll 并发探测所有节点, 返回探测后的排名
+func (e *Endpoints) ProbeAll(ctx context.Context) []NodeStatus {
+	e.init()
+	e.lock.Lock()
+	ips := make([]string, 0, len(e.nodes))
+	for _, n := range e.nodes {
+		ips = append(ips, n.ip)
+	}
+	e.lock.Unlock()
+
+	var wg sync.WaitGroup
+	for _, ip := range ips {
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, e.ProbeTimeout)
+			defer cancel()
+			latency, err := e.Probe(probeCtx, ip)
+			if ctx.Err() != nil { /* 探测被取消, 不代表节点不可用 */
+				return
+			}
+			e.record(ip, latency, err)
+		}(ip)
+	}
+	wg.Wait()
+
+	status := e.Status()
+	available := 0
+	for _, st := range status {
+		if st.Rank > 0 {
+			available++
+		}
+	}
+	log.Debugf("Edge节点探测完成, 可用%d/%d", available, len(status))
+	return status
+}
+
+// Report 记录连接结果, 连接失败的节点被隔离
+func (e *Endpoints) Report(ip string, err error) {
+	e.record(ip, 0, err)
+}
+
+/* latency为0时只更新失败状态, 如连接成功 */
+func (e *Endpoints) record(ip string, latency time.Duration, err error) {
+	e.init()
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, n := range e.nodes {
+		if n.ip != ip {
+			continue
+		}
+		if err == nil {
+			if n.failures > 0 {
+				log.Infof("Edge节点已恢复: %s", ip)
+			}
+			n.failures, n.until, n.lastErr = 0, time.Time{}, nil
+			if latency > 0 {
+				n.latency, n.probed = latency, time.Now()
+			}
+			return
+		}
+		n.failures++
+		n.lastErr = err
+		d := e.Quarantine
+		for i := 1; i < n.failures && d < 30*time.Minute; i++ {
+			d *= 2
+		}
+		if d > 30*time.Minute {
+			d = 30 * time.Minute
+		}
+		n.until = time.Now().Add(d)
+		log.Warnf("Edge节点%s连续失败%d次, 隔离%v: %v", ip, n.failures, d, err)
+		return
+	}
+}
+
+/* 按排名排序的节点, 可用的在前: 已探测的按延迟, 未探测的按随机顺序; 隔离中的按隔离结束时间。需持有锁 */
+func (e *Endpoints) rankedLocked(now time.Time) (ranked []*node, available int) {
+	ranked = append([]*node(nil), e.nodes...)
+	quarantined := func(n *node) bool { return now.Before(n.until) }
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if qa, qb := quarantined(a), quarantined(b); qa != qb {
+			return qb
+		} else if qa {
+			return a.until.Before(b.until)
+		}
+		if (a.latency > 0) != (b.latency > 0) {
+			return a.latency > 0
+		}
+		if a.latency != b.latency {
+			return a.latency < b.latency
+		}
+		return a.order < b.order
+	})
+	for _, n := range ranked {
+		if !quarantined(n) {
+			available++
+		}
+	}
+	return ranked, available
+}
+
+// Pick 选择连接的节点, 返回空字符串表示所有节点都被隔离且启用了DNS解析回退
+func (e *Endpoints) Pick() string {
+	e.init()
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	ranked, available := e.rankedLocked(time.Now())
+	if len(ranked) == 0 || (available == 0 && e.DnsFallback) {
+		return ""
+	}
+	return ranked[0].ip /* 都被隔离时使用最早结束隔离的节点 */
+}
+
+// Status 当前排名
+func (e *Endpoints) Status() []NodeStatus {
+	e.init()
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	now := time.Now()
+	ranked, available := e.rankedLocked(now)
+	status := make([]NodeStatus, 0, len(ranked))
+	for i, n := range ranked {
+		st := NodeStatus{IP: n.ip, Latency: n.latency.Milliseconds(), Failures: n.failures}
+		if i < available {
+			st.Rank = i + 1
+		} else {
+			until := n.until
+			st.Quarantined = &until
+		}
+		if !n.probed.IsZero() {
+			probed := n.probed
+			st.Probed = &probed
+		}
+		if n.lastErr != nil {
+			st.LastError = n.lastErr.Error()
+		}
+		status = append(status, st)
+	}
+	return status
+}
@@ -0,0 +1,107 @@
+package edge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+/* 按IP返回固定延迟, 未设置的IP探测失败 */
+func fakeProbe(latency map[string]time.Duration) func(context.Context, string) (time.Duration, error) {
+	var lock sync.Mutex
+	return func(_ context.Context, ip string) (time.Duration, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if d, ok := latency[ip]; ok {
+			return d, nil
+		}
+		return 0, errors.New("connection refused")
+	}
+}
+
+func TestEndpointsRanking(t *testing.T) {
+	e := &Endpoints{IpList: []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "2.2.2.2"},
+		Probe: fakeProbe(map[string]time.Duration{"1.1.1.1": 80 * time.Millisecond, "2.2.2.2": 20 * time.Millisecond})}
+	status := e.ProbeAll(context.Background())
+	if len(status) != 3 || status[0].IP != "2.2.2.2" || status[0].Rank != 1 || status[0].Latency != 20 ||
+		status[1].IP != "1.1.1.1" || status[2].IP != "3.3.3.3" || status[2].Rank != 0 || status[2].Quarantined == nil {
+		t.Fatalf("%+v", status)
+	}
+	if ip := e.Pick(); ip != "2.2.2.2" {
+		t.Fatal(ip)
+	}
+
+	/* 连接失败的节点被隔离, 成功后恢复 */
+	e.Report("2.2.2.2", errors.New("i/o timeout"))
+	if ip := e.Pick(); ip != "1.1.1.1" {
+		t.Fatal(ip)
+	}
+	e.Report("2.2.2.2", nil)
+	if ip := e.Pick(); ip != "2.2.2.2" {
+		t.Fatal(ip)
+	}
+}
+
+func TestEndpointsQuarantine(t *testing.T) {
+	e := &Endpoints{IpList: []string{"1.1.1.1"}, Quarantine: time.Minute, Probe: fakeProbe(nil)}
+	e.ProbeAll(context.Background())
+	e.ProbeAll(context.Background())
+	st := e.Status()[0]
+	if st.Failures != 2 || st.Quarantined == nil || time.Until(*st.Quarantined) < time.Minute+50*time.Second {
+		t.Fatalf("%+v", st)
+	}
+
+	/* 都被隔离时仍使用该节点, 启用DNS回退时使用DNS解析 */
+	if ip := e.Pick(); ip != "1.1.1.1" {
+		t.Fatal(ip)
+	}
+	e.DnsFallback = true
+	if ip := e.Pick(); ip != "" {
+		t.Fatal(ip)
+	}
+}
+
+func TestEndpointsStart(t *testing.T) {
+	probed := make(chan string, 10)
+	e := &Endpoints{IpList: []string{"1.1.1.1"}, ProbeInterval: 10 * time.Millisecond,
+		Probe: func(_ context.Context, ip string) (time.Duration, error) {
+			probed <- ip
+			return time.Millisecond, nil
+		}}
+	e.Start()
+	e.Start()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-probed:
+		case <-time.After(time.Second):
+			t.Fatal("probe timeout")
+		}
+	}
+	e.Close()
+	if st := e.Status()[0]; st.Rank != 1 || st.Probed == nil {
+		t.Fatalf("%+v", st)
+	}
+}
+
+func TestEngineNoProbeBeforeUse(t *testing.T) {
+	probed := make(chan string, 10)
+	endpoints := &Endpoints{IpList: []string{"1.1.1.1"}, ProbeInterval: 10 * time.Millisecond,
+		Probe: func(_ context.Context, ip string) (time.Duration, error) {
+			probed <- ip
+			return time.Millisecond, nil
+		}}
+	e := &Engine{Endpoints: endpoints}
+	if st := e.Nodes(); len(st) != 1 || st[0].Probed != nil {
+		t.Fatalf("%+v", st)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ip := <-probed:
+		t.Fatalf("unused engine probed %s", ip)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,166 @@
+package edge
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/jing332/tts-server-go/tts"
+	"github.com/jing332/tts-server-go/tts/pool"
+	"github.com/jing332/tts-server-go/tts/proxy"
+	log "github.com/sirupsen/logrus"
+)
+
+// Engine Edge大声朗读引擎，实现 tts.Engine
+type Engine struct {
+	DnsLookupEnabled bool          // 使用DNS解析，而不是北京微软云节点。
+	IpList           []string      // 自定义节点IP, 为空时使用 ChinaIpList
+	DnsFallback      bool          // 所有节点都被隔离时使用DNS解析
+	ProbeInterval    time.Duration // 节点探测间隔, 默认5min
+	Proxy            *proxy.Proxy  // 出站代理, 为空时按环境变量选择
+	PoolSize         int           // 最大连接数, 默认4
+	MaxStreams       int           // 单个连接最大并发请求数, 默认1
+	IdleTimeout      time.Duration // 空闲连接超时关闭, 默认60s
+	VoicesTTL        time.Duration // 发音人列表缓存时间, 默认24h
+
+	// Endpoints 节点管理, 为空时按 IpList 创建, 未使用DNS解析时在后台定期探测
+	Endpoints *Endpoints
+
+	lock          sync.Mutex
+	pool          *pool.Pool
+	endpointsOnce sync.Once
+
+	voicesLock   sync.Mutex
+	voices       []Voice
+	voicesExpire time.Time
+}
+
+func (e *Engine) endpoints() *Endpoints {
+	e.endpointsOnce.Do(func() {
+		if e.Endpoints == nil {
+			e.Endpoints = &Endpoints{IpList: e.IpList, DnsFallback: e.DnsFallback, ProbeInterval: e.ProbeInterval, Proxy: e.Proxy}
+		}
+	})
+	return e.Endpoints
+}
+
+func (e *Engine) getPool() *pool.Pool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.pool == nil {
+		endpoints := e.endpoints()
+		e.pool = &pool.Pool{
+			MaxConns:    e.PoolSize,
+			MaxStreams:  e.MaxStreams,
+			IdleTimeout: e.IdleTimeout,
+			Dial: func(context.Context) (pool.Conn, error) {
+				if !e.DnsLookupEnabled { /* 首次连接时开始后台探测 */
+					endpoints.Start()
+				}
+				t := &TTS{DnsLookupEnabled: e.DnsLookupEnabled, Endpoints: endpoints, Proxy: e.Proxy}
+				if err := t.NewConn(); err != nil {
+					return nil, err
+				}
+				return t, nil
+			},
+		}
+	}
+	return e.pool
+}
+
+func (e *Engine) Synthesize(ctx context.Context, req *tts.SpeakRequest) (audio []byte, err error) {
+	err = e.SynthesizeStream(ctx, req, func(data []byte) {
+		audio = append(audio, data...)
+	})
+	return audio, err
+}
+
+func (e *Engine) SynthesizeStream(ctx context.Context, req *tts.SpeakRequest, read func([]byte)) error {
+	p := e.getPool()
+	conn, err := p.Get(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.Put(conn) /* 已断开的连接会被连接池移除 */
+
+	return conn.(*TTS).speak(ctx, req, read)
+}
+
+// Voices 发音人列表
+func (e *Engine) Voices(ctx context.Context) ([]tts.Voice, error) {
+	list, err := e.getVoices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	voices := make([]tts.Voice, 0, len(list))
+	for _, v := range list {
+		voices = append(voices, v.Voice())
+	}
+	return voices, nil
+}
+
+// RawVoices Edge发音人列表, 补全了Azure格式的字段
+func (e *Engine) RawVoices(ctx context.Context) ([]byte, error) {
+	list, err := e.getVoices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(list)
+}
+
+/* 发音人列表缓存在内存中; 接口失败时使用过期的缓存或内置列表 */
+func (e *Engine) getVoices(ctx context.Context) ([]Voice, error) {
+	e.voicesLock.Lock()
+	defer e.voicesLock.Unlock()
+	if e.voices != nil && time.Now().Before(e.voicesExpire) {
+		return e.voices, nil
+	}
+
+	ttl := e.VoicesTTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	voices, err := getVoices(ctx, e.Proxy.Client())
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Warnln("获取Edge发音人列表失败:", err)
+		if e.voices != nil {
+			return e.voices, nil
+		}
+		voices = FallbackVoices()
+		ttl = 5 * time.Minute /* 稍后重试 */
+	}
+
+	e.voices = voices
+	e.voicesExpire = time.Now().Add(ttl)
+	return voices, nil
+}
+
+// Stats 连接池状态
+func (e *Engine) Stats() pool.Stats {
+	return e.getPool().Stats()
+}
+
+// Nodes 节点排名, 不会开始探测
+func (e *Engine) Nodes() []NodeStatus {
+	return e.endpoints().Status()
+}
+
+// ProbeNodes 立即探测所有节点, 返回探测后的排名
+func (e *Engine) ProbeNodes(ctx context.Context) []NodeStatus {
+	return e.endpoints().ProbeAll(ctx)
+}
+
+func (e *Engine) Close() error {
+	e.lock.Lock()
+	p := e.pool
+	e.lock.Unlock()
+	if p == nil { /* 未使用过 */
+		return nil
+	}
+	e.endpoints().Close()
+	return p.Close()
+}
@@ -0,0 +1,111 @@
+package edge
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/jing332/tts-server-go/tts"
+)
+
+var voicesUrl = `https://speech.platform.bing.com/consumer/speech/synthesize/readaloud/voices/list?trustedclienttoken=6A5AA1D4EAFF4E9FB37E23D68491D6F4`
+
+// 内置的发音人列表, 无法连接接口时使用
+//
+//go:embed voices.json
+var fallbackVoices []byte
+
+// Voice 发音人, 字段与Azure发音人列表一致, 并保留Edge特有的字段
+type Voice struct {
+	Name         string `json:"Name"`
+	DisplayName  string `json:"DisplayName"`
+	LocalName    string `json:"LocalName"`
+	ShortName    string `json:"ShortName"`
+	Gender       string `json:"Gender"`
+	Locale       string `json:"Locale"`
+	LocaleName   string `json:"LocaleName"`
+	VoiceType    string `json:"VoiceType"`
+	Status       string `json:"Status"`
+	FriendlyName string `json:"FriendlyName"`
+	VoiceTag     struct {
+		ContentCategories  []string `json:"ContentCategories"`
+		VoicePersonalities []string `json:"VoicePersonalities"`
+	} `json:"VoiceTag"`
+	SuggestedCodec string `json:"SuggestedCodec"`
+}
+
+// GetVoices 获取Edge大声朗读的发音人列表
+func GetVoices(ctx context.Context) ([]Voice, error) {
+	return getVoices(ctx, http.DefaultClient)
+}
+
+func getVoices(ctx context.Context, client *http.Client) ([]Voice, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, voicesUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/103.0.5060.66 Safari/537.36 Edg/103.0.1264.44")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取发音人列表失败: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseVoices(body)
+}
+
+// FallbackVoices 内置的发音人列表
+func FallbackVoices() []Voice {
+	voices, _ := parseVoices(fallbackVoices)
+	return voices
+}
+
+func parseVoices(data []byte) ([]Voice, error) {
+	var voices []Voice
+	if err := json.Unmarshal(data, &voices); err != nil {
+		return nil, err
+	}
+	for i := range voices {
+		voices[i].normalize()
+	}
+	return voices, nil
+}
+
+/* 根据FriendlyName补全Azure格式的字段: Microsoft Xiaoxiao Online (Natural) - Chinese (Mainland) */
+func (v *Voice) normalize() {
+	name, localeName, _ := strings.Cut(v.FriendlyName, " - ")
+	name = strings.TrimPrefix(name, "Microsoft ")
+	if i := strings.Index(name, " Online"); i > 0 {
+		name = name[:i]
+	}
+	if v.DisplayName == "" {
+		v.DisplayName = name
+	}
+	if v.LocalName == "" {
+		v.LocalName = v.DisplayName
+	}
+	if v.LocaleName == "" {
+		v.LocaleName = localeName
+	}
+	if v.VoiceType == "" {
+		v.VoiceType = "Neural"
+	}
+}
+
+// Voice 转为统一格式
+func (v *Voice) Voice() tts.Voice {
+	return tts.Voice{Engine: tts.EngineEdge, Id: v.ShortName, Name: v.Name, ShortName: v.ShortName, DisplayName: v.DisplayName,
+		LocalName: v.LocalName, Locale: v.Locale, LocaleName: v.LocaleName, Gender: v.Gender}
+}
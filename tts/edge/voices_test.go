@@ -0,0 +1,62 @@
+package edge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jing332/tts-server-go/tts"
+)
+
+func TestFallbackVoices(t *testing.T) {
+	voices := FallbackVoices()
+	if len(voices) == 0 {
+		t.Fatal("fallback voices should not be empty")
+	}
+	v := voices[0]
+	if v.ShortName != "zh-CN-XiaoxiaoNeural" || v.DisplayName != "Xiaoxiao" || v.LocaleName != "Chinese (Mainland)" || v.VoiceType != "Neural" {
+		t.Fatalf("%+v", v)
+	}
+}
+
+func TestEngineVoices(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests > 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`[{"ShortName":"en-US-AriaNeural","Locale":"en-US","FriendlyName":"Microsoft Aria Online (Natural) - English (United States)"}]`))
+	}))
+	defer srv.Close()
+	defer func(url string) { voicesUrl = url }(voicesUrl)
+	voicesUrl = srv.URL
+
+	e := &Engine{}
+	for i := 0; i < 2; i++ { /* 第二次命中缓存 */
+		voices, err := e.Voices(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(voices) != 1 || voices[0].DisplayName != "Aria" || voices[0].Engine != tts.EngineEdge || voices[0].Id != "en-US-AriaNeural" {
+			t.Fatalf("%+v", voices)
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("requests: %d", requests)
+	}
+
+	/* 接口失败且无缓存时使用内置列表 */
+	e = &Engine{}
+	data, err := e.RawVoices(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var voices []Voice
+	if err := json.Unmarshal(data, &voices); err != nil || len(voices) != len(FallbackVoices()) {
+		t.Fatalf("%v: %d", err, len(voices))
+	}
+}
@@ -0,0 +1,131 @@
+package tts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 内置引擎名称
+const (
+	EngineEdge     = "edge"
+	EngineAzure    = "azure"
+	EngineCreation = "creation"
+)
+
+var (
+	// ErrEngineNotFound 未注册的引擎
+	ErrEngineNotFound = errors.New("engine not found")
+	// ErrNotSupported 引擎不支持该操作
+	ErrNotSupported = errors.New("not supported")
+)
+
+// StatusError 上游返回的HTTP错误状态, 如WebSocket握手失败
+type StatusError struct {
+	Code   int
+	Status string // 如 429 Too Many Requests
+	Err    error
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%v: %s", e.Err, e.Status)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// SpeakRequest 合成请求
+type SpeakRequest struct {
+	Ssml   string // 完整SSML (Edge, Azure)
+	Text   string // 纯文本，配合Voice使用 (Creation)
+	Format string // 音频格式，如 audio-24khz-48kbitrate-mono-mp3
+	Voice  *VoiceProperty
+
+	WordBoundary     bool           // 启用单词边界事件
+	SentenceBoundary bool           // 启用句子边界事件
+	OnBoundary       func(Boundary) // 接收到边界事件时回调，不支持的引擎不会调用
+}
+
+// 边界类型
+const (
+	WordBoundary     = "WordBoundary"
+	SentenceBoundary = "SentenceBoundary"
+)
+
+// Boundary 单词或句子边界，时间相对于音频起点
+type Boundary struct {
+	Type     string
+	Offset   time.Duration
+	Duration time.Duration
+	Text     string
+}
+
+// Engine 统一的TTS引擎接口
+type Engine interface {
+	// Synthesize 合成并返回完整音频
+	Synthesize(ctx context.Context, req *SpeakRequest) ([]byte, error)
+	// SynthesizeStream 合成音频，每接收到一段音频数据就调用一次read
+	SynthesizeStream(ctx context.Context, req *SpeakRequest, read func([]byte)) error
+	// Voices 获取发音人列表
+	Voices(ctx context.Context) ([]Voice, error)
+	// Close 关闭引擎，释放连接
+	Close() error
+}
+
+// Registry 引擎注册表，并发安全
+type Registry struct {
+	lock    sync.RWMutex
+	engines map[string]Engine
+}
+
+func NewRegistry() *Registry {
+	return &Registry{engines: make(map[string]Engine)}
+}
+
+// Register 注册引擎，同名引擎会被替换并关闭
+func (r *Registry) Register(name string, engine Engine) {
+	r.lock.Lock()
+	old := r.engines[name]
+	r.engines[name] = engine
+	r.lock.Unlock()
+
+	if old != nil && old != engine {
+		_ = old.Close()
+	}
+}
+
+// Get 根据名称获取引擎
+func (r *Registry) Get(name string) (Engine, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	engine, ok := r.engines[name]
+	if !ok {
+		return nil, ErrEngineNotFound
+	}
+	return engine, nil
+}
+
+// Names 已注册的引擎名称(已排序)
+func (r *Registry) Names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	names := make([]string, 0, len(r.engines))
+	for name := range r.engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close 关闭所有引擎
+func (r *Registry) Close() {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for _, engine := range r.engines {
+		_ = engine.Close()
+	}
+}
@@ -0,0 +1,58 @@
+package tts
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type testEngine struct {
+	closed bool
+}
+
+func (e *testEngine) Synthesize(context.Context, *SpeakRequest) ([]byte, error) {
+	return []byte("audio"), nil
+}
+
+func (e *testEngine) SynthesizeStream(_ context.Context, _ *SpeakRequest, read func([]byte)) error {
+	read([]byte("audio"))
+	return nil
+}
+
+func (e *testEngine) Voices(context.Context) ([]Voice, error) {
+	return nil, ErrNotSupported
+}
+
+func (e *testEngine) Close() error {
+	e.closed = true
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	e1 := &testEngine{}
+	r.Register("b", e1)
+	r.Register("a", &testEngine{})
+
+	if names := r.Names(); len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Fatalf("names: %v", names)
+	}
+	if _, err := r.Get("c"); !errors.Is(err, ErrEngineNotFound) {
+		t.Fatalf("want ErrEngineNotFound, got %v", err)
+	}
+
+	e2 := &testEngine{}
+	r.Register("b", e2)
+	if !e1.closed {
+		t.Fatal("replaced engine should be closed")
+	}
+	got, err := r.Get("b")
+	if err != nil || got != e2 {
+		t.Fatalf("get: %v, %v", got, err)
+	}
+
+	r.Close()
+	if !e2.closed {
+		t.Fatal("engine should be closed")
+	}
+}
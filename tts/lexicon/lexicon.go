@@ -0,0 +1,289 @@
+// Package lexicon 自定义读音与文本替换规则, 在生成SSML之前应用
+package lexicon
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jing332/tts-server-go/tts/ssml"
+)
+
+// 规则类型
+const (
+	TypeLiteral = "literal" // 文本替换
+	TypeRegex   = "regex"   // 正则替换, Replacement 可使用 $1 引用分组
+	TypePhoneme = "phoneme" // 使用<phoneme>指定读音, Replacement 为音标
+	TypeSub     = "sub"     // 使用<sub>指定别名, Replacement 为朗读的文本
+)
+
+// DefaultAlphabet phoneme规则未指定音标类型时使用, 中文可使用 sapi 拼音(如 chong 2)
+const DefaultAlphabet = "ipa"
+
+var ErrNotFound = errors.New("lexicon: 规则不存在")
+
+// Rule 替换规则, 文本替换(literal, regex)按顺序先执行, 之后匹配phoneme与sub规则
+type Rule struct {
+	Id          string `json:"id"`
+	Type        string `json:"type"`    // literal(默认), regex, phoneme, sub
+	Pattern     string `json:"pattern"` // 匹配的文本, regex类型为正则表达式
+	Replacement string `json:"replacement"`
+	Alphabet    string `json:"alphabet,omitempty"` // phoneme的音标类型: ipa(默认), sapi, ups, x-microsoft-pinyin 等
+}
+
+/* 校验后的规则 */
+type compiledRule struct {
+	Rule
+	re *regexp.Regexp
+}
+
+func compile(r Rule) (*compiledRule, error) {
+	if r.Type == "" {
+		r.Type = TypeLiteral
+	}
+	if r.Pattern == "" {
+		return nil, fmt.Errorf("pattern 不能为空")
+	}
+	c := &compiledRule{Rule: r}
+	switch r.Type {
+	case TypeLiteral:
+	case TypeRegex:
+		var err error
+		if c.re, err = regexp.Compile(r.Pattern); err != nil {
+			return nil, fmt.Errorf("无效的正则表达式: %w", err)
+		}
+	case TypePhoneme, TypeSub:
+		if r.Replacement == "" {
+			return nil, fmt.Errorf("%s 规则的 replacement 不能为空", r.Type)
+		}
+		if r.Type == TypePhoneme && c.Alphabet == "" {
+			c.Alphabet = DefaultAlphabet
+		}
+	default:
+		return nil, fmt.Errorf("不支持的规则类型: %s", r.Type)
+	}
+	return c, nil
+}
+
+// Validate 校验规则
+func (r *Rule) Validate() error {
+	_, err := compile(*r)
+	return err
+}
+
+// Lexicon 规则集, 零值可用, 可并发使用
+type Lexicon struct {
+	lock   sync.RWMutex
+	rules  []*compiledRule
+	nextId int
+}
+
+// New 使用规则创建规则集, 未指定Id的规则按顺序编号
+func New(rules []Rule) (*Lexicon, error) {
+	l := &Lexicon{}
+	if _, err := l.AddAll(rules); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Rules 所有规则
+func (l *Lexicon) Rules() []Rule {
+	if l == nil {
+		return nil
+	}
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	rules := make([]Rule, 0, len(l.rules))
+	for _, r := range l.rules {
+		rules = append(rules, r.Rule)
+	}
+	return rules
+}
+
+// Add 添加规则到末尾, 返回补全Id与默认值后的规则
+func (l *Lexicon) Add(r Rule) (Rule, error) {
+	c, err := compile(r)
+	if err != nil {
+		return Rule{}, err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if err = l.add(c); err != nil {
+		return Rule{}, err
+	}
+	return c.Rule, nil
+}
+
+// AddAll 按顺序添加多条规则到末尾, 任一规则无效时都不添加
+func (l *Lexicon) AddAll(rules []Rule) ([]Rule, error) {
+	compiled := make([]*compiledRule, 0, len(rules))
+	for i, r := range rules {
+		c, err := compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("第%d条规则: %w", i+1, err)
+		}
+		compiled = append(compiled, c)
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	n, nextId := len(l.rules), l.nextId
+	added := make([]Rule, 0, len(compiled))
+	for i, c := range compiled {
+		if err := l.add(c); err != nil { /* Id重复, 撤销已添加的规则 */
+			l.rules, l.nextId = l.rules[:n], nextId
+			return nil, fmt.Errorf("第%d条规则: %w", i+1, err)
+		}
+		added = append(added, c.Rule)
+	}
+	return added, nil
+}
+
+/* 补全Id后添加到末尾, 调用前需持有锁 */
+func (l *Lexicon) add(c *compiledRule) error {
+	if c.Id == "" {
+		for c.Id == "" || l.index(c.Id) >= 0 {
+			l.nextId++
+			c.Id = strconv.Itoa(l.nextId)
+		}
+	} else if l.index(c.Id) >= 0 {
+		return fmt.Errorf("规则已存在: %s", c.Id)
+	}
+	l.rules = append(l.rules, c)
+	return nil
+}
+
+// Update 替换Id相同的规则, 不存在时返回 ErrNotFound
+func (l *Lexicon) Update(r Rule) (Rule, error) {
+	c, err := compile(r)
+	if err != nil {
+		return Rule{}, err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	i := l.index(c.Id)
+	if i < 0 {
+		return Rule{}, ErrNotFound
+	}
+	l.rules[i] = c
+	return c.Rule, nil
+}
+
+// Delete 删除规则, 不存在时返回false
+func (l *Lexicon) Delete(id string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	i := l.index(id)
+	if i < 0 {
+		return false
+	}
+	l.rules = append(l.rules[:i:i], l.rules[i+1:]...)
+	return true
+}
+
+// Clear 删除所有规则
+func (l *Lexicon) Clear() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.rules = nil
+}
+
+func (l *Lexicon) index(id string) int {
+	for i, r := range l.rules {
+		if r.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+/* 当前规则的快照, 避免应用规则时持有锁 */
+func (l *Lexicon) snapshot() []*compiledRule {
+	if l == nil {
+		return nil
+	}
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.rules
+}
+
+// Replace 只执行文本替换规则, 用于不支持SSML的引擎
+func (l *Lexicon) Replace(text string) string {
+	return replace(l.snapshot(), text)
+}
+
+func replace(rules []*compiledRule, text string) string {
+	for _, r := range rules {
+		switch r.Type {
+		case TypeLiteral:
+			text = strings.ReplaceAll(text, r.Pattern, r.Replacement)
+		case TypeRegex:
+			text = r.re.ReplaceAllString(text, r.Replacement)
+		}
+	}
+	return text
+}
+
+// Apply 对节点中的文本应用规则, 匹配phoneme与sub规则的文本转为对应元素。
+// 只处理 Text, Fragment 与 Emphasis 中的文本, 其他节点原样返回
+func (l *Lexicon) Apply(nodes ...ssml.Node) []ssml.Node {
+	rules := l.snapshot()
+	if len(rules) == 0 {
+		return nodes
+	}
+	return apply(rules, nodes)
+}
+
+func apply(rules []*compiledRule, nodes []ssml.Node) []ssml.Node {
+	result := make([]ssml.Node, 0, len(nodes))
+	for _, n := range nodes {
+		switch t := n.(type) {
+		case ssml.Text:
+			result = append(result, split(rules, replace(rules, string(t)))...)
+		case ssml.Fragment:
+			result = append(result, ssml.Fragment(apply(rules, t)))
+		case *ssml.Emphasis:
+			result = append(result, &ssml.Emphasis{Level: t.Level, Children: apply(rules, t.Children)})
+		default:
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+/* 将匹配phoneme与sub规则的文本转为对应元素, 同一位置匹配多条规则时使用最长的 */
+func split(rules []*compiledRule, text string) []ssml.Node {
+	var nodes []ssml.Node
+	for text != "" {
+		var match *compiledRule
+		pos := -1
+		for _, r := range rules {
+			if r.Type != TypePhoneme && r.Type != TypeSub {
+				continue
+			}
+			i := strings.Index(text, r.Pattern)
+			if i >= 0 && (pos < 0 || i < pos || i == pos && len(r.Pattern) > len(match.Pattern)) {
+				match, pos = r, i
+			}
+		}
+		if match == nil {
+			break
+		}
+		if pos > 0 {
+			nodes = append(nodes, ssml.Text(text[:pos]))
+		}
+		if match.Type == TypePhoneme {
+			nodes = append(nodes, &ssml.Phoneme{Alphabet: match.Alphabet, Ph: match.Replacement, Text: match.Pattern})
+		} else {
+			nodes = append(nodes, &ssml.Sub{Alias: match.Replacement, Text: match.Pattern})
+		}
+		text = text[pos+len(match.Pattern):]
+	}
+	if text != "" {
+		nodes = append(nodes, ssml.Text(text))
+	}
+	return nodes
+}
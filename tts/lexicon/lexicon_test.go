@@ -0,0 +1,96 @@
+package lexicon
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jing332/tts-server-go/tts/ssml"
+)
+
+func TestApply(t *testing.T) {
+	l, err := New([]Rule{
+		{Pattern: "TTS", Replacement: "语音合成"},
+		{Type: TypeRegex, Pattern: `(\d+)km`, Replacement: "${1}公里"},
+		{Type: TypePhoneme, Pattern: "重庆", Replacement: "chong 2 qing 4", Alphabet: "sapi"},
+		{Type: TypePhoneme, Pattern: "重", Replacement: "zhong 4", Alphabet: "sapi"},
+		{Type: TypeSub, Pattern: "WWW", Replacement: "万维网"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodes := l.Apply(ssml.Text("TTS: 重庆<5km>很重, WWW"), &ssml.Emphasis{Children: []ssml.Node{ssml.Text("WWW")}}, &ssml.Break{})
+	want := `语音合成: <phoneme alphabet="sapi" ph="chong 2 qing 4">重庆</phoneme>&lt;5公里&gt;很<phoneme alphabet="sapi" ph="zhong 4">重</phoneme>, ` +
+		`<sub alias="万维网">WWW</sub><emphasis><sub alias="万维网">WWW</sub></emphasis><break/>`
+	if s := ssml.String(nodes...); s != want {
+		t.Fatal(s)
+	}
+	if s := l.Replace("TTS 3km 重庆"); s != "语音合成 3公里 重庆" {
+		t.Fatal(s)
+	}
+}
+
+func TestRules(t *testing.T) {
+	var l Lexicon
+	r, err := l.Add(Rule{Pattern: "a", Replacement: "b"})
+	if err != nil || r.Id != "1" || r.Type != TypeLiteral {
+		t.Fatalf("%+v %v", r, err)
+	}
+	if _, err := l.Add(Rule{Id: "1", Pattern: "c"}); err == nil {
+		t.Fatal("重复的Id")
+	}
+	if r, _ = l.Add(Rule{Type: TypePhoneme, Pattern: "x", Replacement: "y"}); r.Id != "2" || r.Alphabet != DefaultAlphabet {
+		t.Fatalf("%+v", r)
+	}
+	if _, err := l.Update(Rule{Id: "1", Type: TypeSub, Pattern: "a", Replacement: "A"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Update(Rule{Id: "9", Pattern: "a"}); !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+	if !l.Delete("2") || l.Delete("2") || len(l.Rules()) != 1 || l.Rules()[0].Type != TypeSub {
+		t.Fatalf("%+v", l.Rules())
+	}
+
+	/* 任一规则无效时都不添加 */
+	for _, rules := range [][]Rule{{{Pattern: "b"}, {Type: TypeRegex, Pattern: "("}}, {{Pattern: "b"}, {Id: "1", Pattern: "c"}}} {
+		if added, err := l.AddAll(rules); err == nil || added != nil || len(l.Rules()) != 1 {
+			t.Fatalf("%+v %v: %+v", added, err, l.Rules())
+		}
+	}
+	if added, err := l.AddAll([]Rule{{Pattern: "b"}, {Pattern: "c"}}); err != nil || len(added) != 2 || added[0].Id != "3" || added[1].Id != "4" {
+		t.Fatalf("%+v %v", added, err)
+	}
+
+	for _, r := range []Rule{{}, {Type: TypeRegex, Pattern: "("}, {Type: TypeSub, Pattern: "a"}, {Type: "x", Pattern: "a"}} {
+		if err := r.Validate(); err == nil {
+			t.Fatalf("%+v", r)
+		}
+	}
+}
+
+func TestParsePls(t *testing.T) {
+	rules, err := ParsePls([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<lexicon version="1.0" xmlns="http://www.w3.org/2005/01/pronunciation-lexicon" alphabet="ipa" xml:lang="en-US">
+	<lexeme><grapheme>Benigni</grapheme><grapheme>benigni</grapheme><phoneme>bɛˈniːnji</phoneme></lexeme>
+	<lexeme><grapheme>BTW</grapheme><alias>By the way</alias></lexeme>
+</lexicon>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rule{{Type: TypePhoneme, Pattern: "Benigni", Replacement: "bɛˈniːnji", Alphabet: "ipa"},
+		{Type: TypePhoneme, Pattern: "benigni", Replacement: "bɛˈniːnji", Alphabet: "ipa"},
+		{Type: TypeSub, Pattern: "BTW", Replacement: "By the way"}}
+	if len(rules) != len(want) {
+		t.Fatalf("%+v", rules)
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Fatalf("%+v", rules[i])
+		}
+	}
+
+	if _, err := ParsePls([]byte(`<lexicon><lexeme><grapheme>a</grapheme></lexeme></lexicon>`)); err == nil {
+		t.Fatal("缺少phoneme")
+	}
+}
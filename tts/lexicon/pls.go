@@ -0,0 +1,55 @@
+package lexicon
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+/* W3C Pronunciation Lexicon Specification */
+type plsLexicon struct {
+	XMLName  xml.Name `xml:"lexicon"`
+	Alphabet string   `xml:"alphabet,attr"`
+	Lexemes  []struct {
+		Graphemes []string `xml:"grapheme"`
+		Phonemes  []struct {
+			Alphabet string `xml:"alphabet,attr"`
+			Value    string `xml:",chardata"`
+		} `xml:"phoneme"`
+		Aliases []string `xml:"alias"`
+	} `xml:"lexeme"`
+}
+
+// ParsePls 解析PLS词典文件, 每个grapheme转为一条phoneme规则, 只有alias时转为sub规则
+func ParsePls(data []byte) ([]Rule, error) {
+	var pls plsLexicon
+	if err := xml.Unmarshal(data, &pls); err != nil {
+		return nil, fmt.Errorf("解析PLS失败: %w", err)
+	}
+
+	var rules []Rule
+	for i, lexeme := range pls.Lexemes {
+		rule := Rule{}
+		switch {
+		case len(lexeme.Phonemes) > 0:
+			rule.Type, rule.Replacement, rule.Alphabet = TypePhoneme, strings.TrimSpace(lexeme.Phonemes[0].Value), lexeme.Phonemes[0].Alphabet
+			if rule.Alphabet == "" {
+				rule.Alphabet = pls.Alphabet
+			}
+		case len(lexeme.Aliases) > 0:
+			rule.Type, rule.Replacement = TypeSub, strings.TrimSpace(lexeme.Aliases[0])
+		default:
+			return nil, fmt.Errorf("解析PLS失败: 第%d个lexeme缺少phoneme或alias", i+1)
+		}
+		for _, grapheme := range lexeme.Graphemes {
+			if grapheme = strings.TrimSpace(grapheme); grapheme != "" {
+				rule.Pattern = grapheme
+				if err := rule.Validate(); err != nil {
+					return nil, fmt.Errorf("解析PLS失败: 第%d个lexeme: %w", i+1, err)
+				}
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules, nil
+}
@@ -0,0 +1,258 @@
+package normalize
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/jing332/tts-server-go/tts/ssml"
+)
+
+var (
+	enOnes = []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "ten",
+		"eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen", "seventeen", "eighteen", "nineteen"}
+	enTens   = []string{"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety"}
+	enScales = []string{"", "thousand", "million", "billion", "trillion", "quadrillion", "quintillion"}
+	enMonths = []string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October",
+		"November", "December"}
+	enOrdinals = map[string]string{"one": "first", "two": "second", "three": "third", "five": "fifth", "eight": "eighth",
+		"nine": "ninth", "twelve": "twelfth"}
+)
+
+/* 单位的单数与复数 */
+var enUnits = map[string][2]string{
+	"km/h": {"kilometer per hour", "kilometers per hour"}, "mph": {"mile per hour", "miles per hour"},
+	"km": {"kilometer", "kilometers"}, "kg": {"kilogram", "kilograms"}, "mg": {"milligram", "milligrams"},
+	"mm": {"millimeter", "millimeters"}, "cm": {"centimeter", "centimeters"}, "ml": {"milliliter", "milliliters"},
+	"m": {"meter", "meters"}, "g": {"gram", "grams"}, "lb": {"pound", "pounds"}, "lbs": {"pound", "pounds"},
+	"ft": {"foot", "feet"}, "°C": {"degree Celsius", "degrees Celsius"}, "°F": {"degree Fahrenheit", "degrees Fahrenheit"},
+}
+
+const enNumber = `(\d{1,3}(?:,\d{3})+|\d+)(?:\.(\d+))?`
+
+// English 英文规则: 日期、时间、百分数、金额、序数词、单位、长数字与普通数字
+var English = Rules{
+	{
+		Pattern: regexp.MustCompile(`\b(\d{4})-(\d{1,2})-(\d{1,2})\b`),
+		SayAs: func(m []string) ssml.Node {
+			return sayAs("date", "ymd", m[0])
+		},
+		Expand: func(m []string) string { return enDate(m[1], m[2], m[3]) },
+	},
+	{
+		Pattern: regexp.MustCompile(`\b(\d{1,2})/(\d{1,2})/(\d{4})\b`),
+		SayAs: func(m []string) ssml.Node {
+			return sayAs("date", "mdy", m[0])
+		},
+		Expand: func(m []string) string { return enDate(m[3], m[1], m[2]) },
+	},
+	{
+		Pattern: regexp.MustCompile(`\b(\d{1,2}):(\d{2})(?:\s*([AaPp])\.?[Mm]\.?)?`),
+		SayAs: func(m []string) ssml.Node {
+			if m[3] != "" {
+				return sayAs("time", "hms12", m[0])
+			}
+			return sayAs("time", "hms24", m[0])
+		},
+		Expand: func(m []string) string {
+			hour, _ := parseInt(m[1])
+			minute, _ := parseInt(m[2])
+			if hour > 24 || minute > 59 {
+				return ""
+			}
+			s := enInt(hour)
+			switch {
+			case minute == 0 && m[3] == "":
+				s += " o'clock"
+			case minute == 0:
+			case minute < 10:
+				s += " oh " + enInt(minute)
+			default:
+				s += " " + enInt(minute)
+			}
+			if m[3] != "" {
+				s += " " + strings.ToUpper(m[3]) + " M"
+			}
+			return s
+		},
+	},
+	{
+		Pattern: regexp.MustCompile(enNumber + `\s*%`),
+		Expand:  func(m []string) string { return enDecimal(m[1], m[2]) + " percent" },
+	},
+	{
+		Pattern: regexp.MustCompile(`\$(\d{1,3}(?:,\d{3})+|\d+)(?:\.(\d{2}))?\b`),
+		Expand: func(m []string) string {
+			dollars, ok := parseInt(m[1])
+			if !ok {
+				return ""
+			}
+			s := enInt(dollars) + enPlural(dollars, " dollar", " dollars")
+			if cents, _ := parseInt(m[2]); cents > 0 {
+				s += " and " + enInt(cents) + enPlural(cents, " cent", " cents")
+			}
+			return s
+		},
+	},
+	{
+		Pattern: regexp.MustCompile(`\b(\d+)(?:st|nd|rd|th)\b`),
+		SayAs: func(m []string) ssml.Node {
+			return sayAs("ordinal", "", m[1])
+		},
+		Expand: func(m []string) string {
+			n, ok := parseInt(m[1])
+			if !ok {
+				return ""
+			}
+			return enOrdinal(n)
+		},
+	},
+	{
+		Pattern: regexp.MustCompile(enNumber + `\s*(°C|°F)`),
+		SayAs:   enUnitSayAs,
+		Expand:  enUnitExpand,
+	},
+	{
+		Pattern: regexp.MustCompile(`\b` + enNumber + `\s*(km/h|mph|km|kg|mg|mm|cm|ml|m|g|lbs|lb|ft)\b`),
+		SayAs:   enUnitSayAs,
+		Expand:  enUnitExpand,
+	},
+	{
+		Pattern: regexp.MustCompile(`\b\d{7,}\b`),
+		SayAs: func(m []string) ssml.Node {
+			return sayAs("characters", "", m[0])
+		},
+		Expand: func(m []string) string { return enSpell(m[0]) },
+	},
+	{
+		Pattern: regexp.MustCompile(enNumber),
+		SayAs: func(m []string) ssml.Node {
+			return sayAs("cardinal", "", strings.ReplaceAll(m[0], ",", ""))
+		},
+		Expand: func(m []string) string { return enDecimal(m[1], m[2]) },
+	},
+}
+
+func init() {
+	Register("en-US", English)
+}
+
+func enUnitSayAs(m []string) ssml.Node {
+	return ssml.Fragment{sayAs("cardinal", "", strings.ReplaceAll(m[1], ",", "")+decimalSuffix(m[2])), ssml.Text(" " + enUnit(m))}
+}
+
+func enUnitExpand(m []string) string {
+	return enDecimal(m[1], m[2]) + " " + enUnit(m)
+}
+
+/* 只有整数1使用单数 */
+func enUnit(m []string) string {
+	unit := enUnits[m[3]]
+	if n, _ := parseInt(m[1]); n == 1 && m[2] == "" {
+		return unit[0]
+	}
+	return unit[1]
+}
+
+func enPlural(n uint64, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+/* 月份名称, 序数日期与年份, 如 January fifth, twenty twenty-four */
+func enDate(year, month, day string) string {
+	y, _ := parseInt(year)
+	mo, _ := parseInt(month)
+	d, _ := parseInt(day)
+	if mo < 1 || mo > 12 || d < 1 || d > 31 {
+		return ""
+	}
+	return enMonths[mo-1] + " " + enOrdinal(d) + ", " + enYear(y)
+}
+
+/* 年份按两位一组读出, 如 1999 为 nineteen ninety-nine, 2005 为 two thousand five */
+func enYear(y uint64) string {
+	high, low := y/100, y%100
+	switch {
+	case y < 1000 || y%1000 < 10 && high%10 == 0:
+		return enInt(y)
+	case low == 0:
+		return enInt(high) + " hundred"
+	case low < 10:
+		return enInt(high) + " oh " + enInt(low)
+	}
+	return enInt(high) + " " + enInt(low)
+}
+
+func enOrdinal(n uint64) string {
+	s := enInt(n)
+	i := strings.LastIndexAny(s, " -") + 1
+	last := s[i:]
+	switch {
+	case enOrdinals[last] != "":
+		last = enOrdinals[last]
+	case strings.HasSuffix(last, "y"):
+		last = strings.TrimSuffix(last, "y") + "ieth"
+	default:
+		last += "th"
+	}
+	return s[:i] + last
+}
+
+func enSpell(digits string) string {
+	words := make([]string, 0, len(digits))
+	for _, c := range digits {
+		if c >= '0' && c <= '9' {
+			words = append(words, enOnes[c-'0'])
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+/* 整数与小数部分, 整数过大时逐位读出 */
+func enDecimal(integer, fraction string) string {
+	s := enSpell(integer)
+	if n, ok := parseInt(integer); ok {
+		s = enInt(n)
+	}
+	if fraction != "" {
+		s += " point " + enSpell(fraction)
+	}
+	return s
+}
+
+/* 英文数字, 如 1234 为 one thousand two hundred thirty-four */
+func enInt(n uint64) string {
+	if n < 20 {
+		return enOnes[n]
+	}
+	var groups []string
+	for scale := 0; n > 0; scale, n = scale+1, n/1000 {
+		if g := n % 1000; g > 0 {
+			words := enBelowThousand(int(g))
+			if enScales[scale] != "" {
+				words += " " + enScales[scale]
+			}
+			groups = append([]string{words}, groups...)
+		}
+	}
+	return strings.Join(groups, " ")
+}
+
+func enBelowThousand(n int) string {
+	var words []string
+	if n >= 100 {
+		words = append(words, enOnes[n/100]+" hundred")
+		n %= 100
+	}
+	switch {
+	case n >= 20 && n%10 != 0:
+		words = append(words, enTens[n/10]+"-"+enOnes[n%10])
+	case n >= 20:
+		words = append(words, enTens[n/10])
+	case n > 0:
+		words = append(words, enOnes[n])
+	}
+	return strings.Join(words, " ")
+}
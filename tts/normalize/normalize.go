@@ -0,0 +1,193 @@
+// Package normalize 文本规范化, 将数字、日期、单位等转为<say-as>元素或展开为文字。
+// 内置 zh-CN 与 en-US, 可使用 Register 添加其他区域
+package normalize
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jing332/tts-server-go/tts/ssml"
+)
+
+// 规范化方式
+const (
+	ModeSayAs  = "say-as" // 使用<say-as>元素, 由引擎决定读法, 无对应类型时展开为文字
+	ModeExpand = "expand" // 展开为文字, 适用于不支持<say-as>的引擎
+)
+
+// ValidMode 是否为支持的规范化方式, 空表示不规范化
+func ValidMode(mode string) bool {
+	return mode == "" || mode == ModeSayAs || mode == ModeExpand
+}
+
+// Normalizer 某个区域的规范化规则
+type Normalizer interface {
+	Normalize(text, mode string) []ssml.Node
+}
+
+// Rule 识别一类文本, m 为正则的分组, 与 regexp.FindStringSubmatch 相同
+type Rule struct {
+	Pattern *regexp.Regexp
+	SayAs   func(m []string) ssml.Node // 为nil时展开为文字
+	Expand  func(m []string) string    // 返回空时保留原文本
+}
+
+// Rules 按顺序匹配的规则, 同一位置匹配多条规则时使用靠前的
+type Rules []Rule
+
+func (rules Rules) Normalize(text, mode string) []ssml.Node {
+	var nodes []ssml.Node
+	for text != "" {
+		var match *Rule
+		var loc []int
+		for i := range rules {
+			if l := rules[i].Pattern.FindStringSubmatchIndex(text); l != nil && (loc == nil || l[0] < loc[0]) {
+				match, loc = &rules[i], l
+			}
+		}
+		if match == nil || loc[1] == loc[0] {
+			break
+		}
+		if loc[0] > 0 {
+			nodes = append(nodes, ssml.Text(text[:loc[0]]))
+		}
+		m := submatches(text, loc)
+		if mode == ModeSayAs && match.SayAs != nil {
+			nodes = append(nodes, match.SayAs(m))
+		} else if expanded := match.Expand(m); expanded != "" {
+			nodes = append(nodes, ssml.Text(expanded))
+		} else {
+			nodes = append(nodes, ssml.Text(m[0]))
+		}
+		text = text[loc[1]:]
+	}
+	if text != "" {
+		nodes = append(nodes, ssml.Text(text))
+	}
+	return nodes
+}
+
+func submatches(text string, loc []int) []string {
+	m := make([]string, len(loc)/2)
+	for i := range m {
+		if loc[2*i] >= 0 {
+			m[i] = text[loc[2*i]:loc[2*i+1]]
+		}
+	}
+	return m
+}
+
+var (
+	lock        sync.RWMutex
+	normalizers = map[string]Normalizer{}
+)
+
+// Register 注册区域的规范化规则, locale 如 zh-CN, 也可只使用语言, 如 ja
+func Register(locale string, n Normalizer) {
+	lock.Lock()
+	defer lock.Unlock()
+	normalizers[strings.ToLower(locale)] = n
+}
+
+// Get 查找区域的规范化规则, 没有完全匹配时使用同一语言的规则, 如 zh-TW 使用 zh-CN
+func Get(locale string) (Normalizer, bool) {
+	locale = strings.ToLower(locale)
+	lock.RLock()
+	defer lock.RUnlock()
+	if n, ok := normalizers[locale]; ok {
+		return n, true
+	}
+	lang, _, _ := strings.Cut(locale, "-")
+	if n, ok := normalizers[lang]; ok {
+		return n, true
+	}
+	names := make([]string, 0, len(normalizers))
+	for name := range normalizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.HasPrefix(name, lang+"-") {
+			return normalizers[name], true
+		}
+	}
+	return nil, false
+}
+
+// Locales 已注册的区域
+func Locales() []string {
+	lock.RLock()
+	defer lock.RUnlock()
+	locales := make([]string, 0, len(normalizers))
+	for name := range normalizers {
+		locales = append(locales, name)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Apply 使用区域的规则规范化节点中的文本, mode 为空或区域不支持时原样返回。
+// 只处理 Text, Fragment 与 Emphasis 中的文本
+func Apply(locale, mode string, nodes ...ssml.Node) []ssml.Node {
+	if mode == "" {
+		return nodes
+	}
+	n, ok := Get(locale)
+	if !ok {
+		return nodes
+	}
+	return apply(n, mode, nodes)
+}
+
+func apply(n Normalizer, mode string, nodes []ssml.Node) []ssml.Node {
+	result := make([]ssml.Node, 0, len(nodes))
+	for _, node := range nodes {
+		switch t := node.(type) {
+		case ssml.Text:
+			result = append(result, n.Normalize(string(t), mode)...)
+		case ssml.Fragment:
+			result = append(result, ssml.Fragment(apply(n, mode, t)))
+		case *ssml.Emphasis:
+			result = append(result, &ssml.Emphasis{Level: t.Level, Children: apply(n, mode, t.Children)})
+		default:
+			result = append(result, node)
+		}
+	}
+	return result
+}
+
+/* 读取整数, 失败或超出范围时 ok 为false */
+func parseInt(s string) (n uint64, ok bool) {
+	s = strings.ReplaceAll(s, ",", "")
+	if s == "" || len(s) > 18 {
+		return 0, false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + uint64(c-'0')
+	}
+	return n, true
+}
+
+func sayAs(interpretAs, format, text string) ssml.Node {
+	return &ssml.SayAs{InterpretAs: interpretAs, Format: format, Text: text}
+}
+
+// ExpandText 展开为纯文本, 用于不支持SSML的引擎, 区域不支持时原样返回
+func ExpandText(locale, text string) string {
+	n, ok := Get(locale)
+	if !ok {
+		return text
+	}
+	var b strings.Builder
+	for _, node := range n.Normalize(text, ModeExpand) {
+		if t, ok := node.(ssml.Text); ok {
+			b.WriteString(string(t))
+		}
+	}
+	return b.String()
+}
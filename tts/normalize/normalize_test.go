@@ -0,0 +1,69 @@
+package normalize
+
+import (
+	"testing"
+
+	"github.com/jing332/tts-server-go/tts/ssml"
+)
+
+func TestChinese(t *testing.T) {
+	tests := map[string]string{
+		"第123章 2024年1月5日":   "第一百二十三章 二零二四年一月五日",
+		"2024-12-31与1999年":  "二零二四年十二月三十一日与一九九九年",
+		"12:05和8:00":        "十二点零五分和八点整",
+		"增长12.5%":           "增长百分之十二点五",
+		"10km, 3.5kg, 25℃":  "十公里, 三点五千克, 二十五摄氏度",
+		"10010元 1,000,000人": "一万零一十元 一百万人",
+		"100000 110 1001":   "十万 一百一十 一千零一",
+		"电话13800138000":     "电话一三八零零一三八零零零",
+		"3G网络":              "三G网络",
+	}
+	for text, want := range tests {
+		if s := ssml.String(Chinese.Normalize(text, ModeExpand)...); s != want {
+			t.Errorf("%s: %s", text, s)
+		}
+	}
+
+	want := `第<say-as interpret-as="cardinal">3</say-as>章 <say-as interpret-as="date" format="ymd">2024-1-5</say-as>` +
+		`百分之五十 <say-as interpret-as="cardinal">5</say-as>公里`
+	if s := ssml.String(Chinese.Normalize("第3章 2024年1月5日50% 5km", ModeSayAs)...); s != want {
+		t.Fatal(s)
+	}
+}
+
+func TestEnglish(t *testing.T) {
+	tests := map[string]string{
+		"On 2024-01-05 at 9:05 PM":    "On January fifth, twenty twenty-four at nine oh five P M",
+		"12/25/2005, 1900 and 12:00":  "December twenty-fifth, two thousand five, one thousand nine hundred and twelve o'clock",
+		"It costs $1.50, 21st place":  "It costs one dollar and fifty cents, twenty-first place",
+		"1 km, 2.5 kg, 30°C":          "one kilometer, two point five kilograms, thirty degrees Celsius",
+		"1,234,567 people, 99.9%":     "one million two hundred thirty-four thousand five hundred sixty-seven people, ninety-nine point nine percent",
+		"Call 5551234 or 12th or 3rd": "Call five five five one two three four or twelfth or third",
+	}
+	for text, want := range tests {
+		if s := ssml.String(English.Normalize(text, ModeExpand)...); s != want {
+			t.Errorf("%s: %s", text, s)
+		}
+	}
+
+	want := `<say-as interpret-as="ordinal">2</say-as> at <say-as interpret-as="time" format="hms12">10:30 am</say-as>`
+	if s := ssml.String(English.Normalize("2nd at 10:30 am", ModeSayAs)...); s != want {
+		t.Fatal(s)
+	}
+}
+
+func TestApply(t *testing.T) {
+	nodes := []ssml.Node{ssml.Text("共3章"), &ssml.Break{}, &ssml.Emphasis{Children: []ssml.Node{ssml.Text("50%")}}}
+	want := `共三章<break/><emphasis>百分之五十</emphasis>`
+	if s := ssml.String(Apply("zh-TW", ModeExpand, nodes...)...); s != want {
+		t.Fatal(s)
+	}
+	if s := ssml.String(Apply("ja-JP", ModeExpand, nodes...)...); s != `共3章<break/><emphasis>50%</emphasis>` {
+		t.Fatal(s)
+	}
+
+	Register("xx", Rules{})
+	if _, ok := Get("xx-YY"); !ok {
+		t.Fatal("xx")
+	}
+}
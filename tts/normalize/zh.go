@@ -0,0 +1,203 @@
+package normalize
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jing332/tts-server-go/tts/ssml"
+)
+
+var zhDigits = []string{"零", "一", "二", "三", "四", "五", "六", "七", "八", "九"}
+
+/* 常用单位, 正则中较长的单位在前 */
+var zhUnits = map[string]string{
+	"km/h": "公里每小时", "km": "公里", "kg": "千克", "mg": "毫克", "mm": "毫米", "cm": "厘米", "ml": "毫升", "mL": "毫升",
+	"m": "米", "g": "克", "L": "升", "℃": "摄氏度", "°C": "摄氏度", "m²": "平方米", "㎡": "平方米",
+}
+
+const zhNumber = `(\d{1,3}(?:,\d{3})+|\d+)(?:\.(\d+))?`
+
+// Chinese 中文规则: 日期、年份、时间、百分数、章节、单位、长数字与普通数字
+var Chinese = Rules{
+	{
+		Pattern: regexp.MustCompile(`(\d{4})\s*(?:年|[-/.])\s*(\d{1,2})\s*(?:月|[-/.])\s*(\d{1,2})\s*日?`),
+		SayAs: func(m []string) ssml.Node {
+			return sayAs("date", "ymd", m[1]+"-"+m[2]+"-"+m[3])
+		},
+		Expand: func(m []string) string {
+			month, _ := parseInt(m[2])
+			day, _ := parseInt(m[3])
+			if month < 1 || month > 12 || day < 1 || day > 31 {
+				return ""
+			}
+			return zhSpell(m[1]) + "年" + zhInt(month) + "月" + zhInt(day) + "日"
+		},
+	},
+	{
+		Pattern: regexp.MustCompile(`(\d{4})年`),
+		Expand:  func(m []string) string { return zhSpell(m[1]) + "年" },
+	},
+	{
+		Pattern: regexp.MustCompile(`(\d{1,2}):(\d{2})(?::(\d{2}))?`),
+		SayAs: func(m []string) ssml.Node {
+			return sayAs("time", "hms24", m[0])
+		},
+		Expand: func(m []string) string {
+			hour, _ := parseInt(m[1])
+			minute, _ := parseInt(m[2])
+			second, _ := parseInt(m[3])
+			if hour > 24 || minute > 59 || second > 59 {
+				return ""
+			}
+			s := zhInt(hour) + "点"
+			switch {
+			case minute == 0 && second == 0:
+				return s + "整"
+			case minute < 10:
+				s += "零" + zhInt(minute) + "分"
+			default:
+				s += zhInt(minute) + "分"
+			}
+			if second > 0 {
+				s += zhInt(second) + "秒"
+			}
+			return s
+		},
+	},
+	{
+		Pattern: regexp.MustCompile(zhNumber + `\s*[%％]`),
+		Expand:  func(m []string) string { return "百分之" + zhDecimal(m[1], m[2]) },
+	},
+	{
+		Pattern: regexp.MustCompile(`第\s*(\d+)\s*([章节回卷集部篇话])`),
+		SayAs: func(m []string) ssml.Node {
+			return ssml.Fragment{ssml.Text("第"), sayAs("cardinal", "", m[1]), ssml.Text(m[2])}
+		},
+		Expand: func(m []string) string { return "第" + zhDecimal(m[1], "") + m[2] },
+	},
+	{
+		Pattern: regexp.MustCompile(zhNumber + `\s*(℃|°C|m²|㎡)`),
+		SayAs:   zhUnitSayAs,
+		Expand:  zhUnitExpand,
+	},
+	{
+		Pattern: regexp.MustCompile(zhNumber + `\s*(km/h|km|kg|mg|mm|cm|ml|mL|m|g|L)\b`),
+		SayAs:   zhUnitSayAs,
+		Expand:  zhUnitExpand,
+	},
+	{
+		Pattern: regexp.MustCompile(`\d{7,}`),
+		SayAs: func(m []string) ssml.Node {
+			return sayAs("characters", "", m[0])
+		},
+		Expand: func(m []string) string { return zhSpell(m[0]) },
+	},
+	{
+		Pattern: regexp.MustCompile(zhNumber),
+		SayAs: func(m []string) ssml.Node {
+			return sayAs("cardinal", "", strings.ReplaceAll(m[0], ",", ""))
+		},
+		Expand: func(m []string) string { return zhDecimal(m[1], m[2]) },
+	},
+}
+
+func init() {
+	Register("zh-CN", Chinese)
+}
+
+func zhUnitSayAs(m []string) ssml.Node {
+	return ssml.Fragment{sayAs("cardinal", "", strings.ReplaceAll(m[1], ",", "")+decimalSuffix(m[2])), ssml.Text(zhUnits[m[3]])}
+}
+
+func zhUnitExpand(m []string) string {
+	return zhDecimal(m[1], m[2]) + zhUnits[m[3]]
+}
+
+func decimalSuffix(fraction string) string {
+	if fraction == "" {
+		return ""
+	}
+	return "." + fraction
+}
+
+/* 逐位读出, 如年份、电话号码 */
+func zhSpell(digits string) string {
+	var b strings.Builder
+	for _, c := range digits {
+		if c >= '0' && c <= '9' {
+			b.WriteString(zhDigits[c-'0'])
+		}
+	}
+	return b.String()
+}
+
+/* 整数与小数部分, 整数过长时逐位读出 */
+func zhDecimal(integer, fraction string) string {
+	n, ok := parseInt(integer)
+	s := zhSpell(integer)
+	if ok && n < 1e16 {
+		s = zhInt(n)
+	}
+	if fraction != "" {
+		s += "点" + zhSpell(fraction)
+	}
+	return s
+}
+
+/* 中文数字, 如 10010 为 一万零一十, 10 为 十 */
+func zhInt(n uint64) string {
+	if n == 0 {
+		return "零"
+	}
+	units := []string{"", "万", "亿", "万亿"}
+	var groups []int
+	for v := n; v > 0; v /= 10000 {
+		groups = append(groups, int(v%10000))
+	}
+	if len(groups) > len(units) {
+		return zhSpell(strconv.FormatUint(n, 10))
+	}
+
+	var b strings.Builder
+	zero := false
+	for i := len(groups) - 1; i >= 0; i-- {
+		g := groups[i]
+		if g == 0 {
+			zero = b.Len() > 0
+			continue
+		}
+		if b.Len() > 0 && (zero || g < 1000) {
+			b.WriteString("零")
+		}
+		b.WriteString(zhSection(g))
+		b.WriteString(units[i])
+		zero = false
+	}
+	s := b.String()
+	if strings.HasPrefix(s, "一十") {
+		s = strings.TrimPrefix(s, "一")
+	}
+	return s
+}
+
+/* 1-9999 */
+func zhSection(g int) string {
+	names := []string{"千", "百", "十", ""}
+	var b strings.Builder
+	started, zero := false, false
+	for i, d := range []int{1000, 100, 10, 1} {
+		digit := g / d % 10
+		if digit == 0 {
+			zero = started
+			continue
+		}
+		if zero {
+			b.WriteString("零")
+			zero = false
+		}
+		b.WriteString(zhDigits[digit] + names[i])
+		started = true
+	}
+	return b.String()
+}
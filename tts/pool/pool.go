@@ -0,0 +1,234 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClosed 连接池已关闭
+var ErrClosed = errors.New("pool closed")
+
+// Conn 池中的连接
+type Conn interface {
+	// Alive 连接是否可用，已断开返回false
+	Alive() bool
+	Close() error
+}
+
+// Pinger 支持主动探测的连接，空闲时由健康检查调用
+type Pinger interface {
+	Ping() error
+}
+
+// Pool 有界连接池，单个连接可同时承载 MaxStreams 个请求
+type Pool struct {
+	Dial        func(ctx context.Context) (Conn, error)
+	MaxConns    int           // 最大连接数, 默认4
+	MaxStreams  int           // 单个连接最大并发请求数, 默认1
+	IdleTimeout time.Duration // 空闲连接超时关闭, 默认60s
+
+	lock    sync.Mutex
+	entries []*entry
+	dialing int
+	wait    chan struct{} // 有连接被释放时关闭, 用于唤醒等待者
+	closed  bool
+	done    chan struct{}
+	once    sync.Once
+}
+
+type entry struct {
+	conn     Conn
+	streams  int
+	lastUsed time.Time
+}
+
+// Stats 连接池状态
+type Stats struct {
+	Conns   int `json:"conns"`
+	Streams int `json:"streams"`
+	Idle    int `json:"idle"`
+}
+
+func (p *Pool) init() {
+	p.once.Do(func() {
+		if p.MaxConns <= 0 {
+			p.MaxConns = 4
+		}
+		if p.MaxStreams <= 0 {
+			p.MaxStreams = 1
+		}
+		if p.IdleTimeout <= 0 {
+			p.IdleTimeout = time.Second * 60
+		}
+		p.wait = make(chan struct{})
+		p.done = make(chan struct{})
+		go p.janitor()
+	})
+}
+
+// Get 获取一个可用连接，连接数已满时等待其他请求释放。用完后必须调用 Put
+func (p *Pool) Get(ctx context.Context) (Conn, error) {
+	p.init()
+	for {
+		p.lock.Lock()
+		if p.closed {
+			p.lock.Unlock()
+			return nil, ErrClosed
+		}
+		p.removeDead()
+
+		var best *entry
+		for _, e := range p.entries {
+			if e.streams < p.MaxStreams && (best == nil || e.streams < best.streams) {
+				best = e
+			}
+		}
+		if best != nil && (best.streams == 0 || len(p.entries)+p.dialing >= p.MaxConns) {
+			best.streams++
+			best.lastUsed = time.Now()
+			p.lock.Unlock()
+			return best.conn, nil
+		}
+
+		if len(p.entries)+p.dialing < p.MaxConns { /* 优先新建连接, 而不是复用繁忙连接 */
+			p.dialing++
+			p.lock.Unlock()
+			return p.dial(ctx)
+		}
+
+		wait := p.wait
+		p.lock.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (p *Pool) dial(ctx context.Context) (Conn, error) {
+	conn, err := p.Dial(ctx)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.dialing--
+	if err != nil {
+		p.notify()
+		return nil, err
+	}
+	if p.closed {
+		_ = conn.Close()
+		return nil, ErrClosed
+	}
+	p.entries = append(p.entries, &entry{conn: conn, streams: 1, lastUsed: time.Now()})
+	return conn, nil
+}
+
+// Put 归还连接，已断开的连接会被移除
+func (p *Pool) Put(conn Conn) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, e := range p.entries {
+		if e.conn == conn {
+			e.streams--
+			e.lastUsed = time.Now()
+			break
+		}
+	}
+	p.removeDead()
+	p.notify()
+}
+
+// Stats 当前连接池状态
+func (p *Pool) Stats() Stats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var stats Stats
+	for _, e := range p.entries {
+		stats.Conns++
+		stats.Streams += e.streams
+		if e.streams == 0 {
+			stats.Idle++
+		}
+	}
+	return stats
+}
+
+// Close 关闭连接池及所有连接
+func (p *Pool) Close() error {
+	p.init()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+	for _, e := range p.entries {
+		_ = e.conn.Close()
+	}
+	p.entries = nil
+	p.notify()
+	return nil
+}
+
+/* 唤醒所有等待者, 调用前需持有锁 */
+func (p *Pool) notify() {
+	close(p.wait)
+	p.wait = make(chan struct{})
+}
+
+/* 移除已断开且无请求的连接, 调用前需持有锁 */
+func (p *Pool) removeDead() {
+	p.evict(func(e *entry) bool {
+		return !e.conn.Alive()
+	})
+}
+
+func (p *Pool) evict(fn func(e *entry) bool) {
+	entries := p.entries[:0]
+	for _, e := range p.entries {
+		if e.streams <= 0 && fn(e) {
+			_ = e.conn.Close()
+			continue
+		}
+		entries = append(entries, e)
+	}
+	for i := len(entries); i < len(p.entries); i++ {
+		p.entries[i] = nil
+	}
+	p.entries = entries
+}
+
+/* 定时关闭空闲超时的连接, 并探测空闲连接是否可用 */
+func (p *Pool) janitor() {
+	ticker := time.NewTicker(p.IdleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		p.lock.Lock()
+		var idle []Conn
+		p.evict(func(e *entry) bool {
+			return !e.conn.Alive() || time.Since(e.lastUsed) > p.IdleTimeout
+		})
+		for _, e := range p.entries {
+			if e.streams == 0 {
+				idle = append(idle, e.conn)
+			}
+		}
+		p.lock.Unlock()
+
+		for _, conn := range idle {
+			if pinger, ok := conn.(Pinger); ok {
+				_ = pinger.Ping() /* 失败的连接会在下次检查时被移除 */
+			}
+		}
+	}
+}
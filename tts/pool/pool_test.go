@@ -0,0 +1,123 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testConn struct {
+	lock   sync.Mutex
+	dead   bool
+	closed bool
+}
+
+func (c *testConn) Alive() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return !c.dead && !c.closed
+}
+
+func (c *testConn) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.closed = true
+	return nil
+}
+
+func newTestPool(maxConns, maxStreams int) (*Pool, *int) {
+	dials := 0
+	p := &Pool{MaxConns: maxConns, MaxStreams: maxStreams, IdleTimeout: time.Second,
+		Dial: func(context.Context) (Conn, error) {
+			dials++
+			return &testConn{}, nil
+		}}
+	return p, &dials
+}
+
+func TestPoolBounded(t *testing.T) {
+	p, dials := newTestPool(2, 1)
+	defer p.Close()
+
+	c1, _ := p.Get(context.Background())
+	c2, _ := p.Get(context.Background())
+	if c1 == c2 || *dials != 2 {
+		t.Fatalf("want 2 different conns, dials: %d", *dials)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if _, err := p.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want DeadlineExceeded, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(time.Millisecond * 20)
+		p.Put(c1)
+	}()
+	c3, err := p.Get(context.Background())
+	if err != nil || c3 != c1 {
+		t.Fatalf("want released conn, got %v, %v", c3, err)
+	}
+}
+
+func TestPoolMultiplex(t *testing.T) {
+	p, dials := newTestPool(1, 3)
+	defer p.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := p.Get(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if *dials != 1 {
+		t.Fatalf("dials: %d", *dials)
+	}
+	if stats := p.Stats(); stats.Conns != 1 || stats.Streams != 3 {
+		t.Fatalf("stats: %+v", stats)
+	}
+}
+
+func TestPoolRemoveDead(t *testing.T) {
+	p, dials := newTestPool(1, 1)
+	defer p.Close()
+
+	c, _ := p.Get(context.Background())
+	c.(*testConn).dead = true
+	p.Put(c)
+	if !c.(*testConn).closed {
+		t.Fatal("dead conn should be closed")
+	}
+
+	c2, _ := p.Get(context.Background())
+	if c2 == c || *dials != 2 {
+		t.Fatalf("want new conn, dials: %d", *dials)
+	}
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	p, _ := newTestPool(1, 1)
+	p.IdleTimeout = time.Millisecond * 50
+	defer p.Close()
+
+	c, _ := p.Get(context.Background())
+	p.Put(c)
+	time.Sleep(time.Millisecond * 200)
+	if stats := p.Stats(); stats.Conns != 0 || !c.(*testConn).closed {
+		t.Fatalf("idle conn should be evicted: %+v", stats)
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	p, _ := newTestPool(1, 1)
+	c, _ := p.Get(context.Background())
+	_ = p.Close()
+	if !c.(*testConn).closed {
+		t.Fatal("conn should be closed")
+	}
+	if _, err := p.Get(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Fatalf("want ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrTooLarge 单个请求的音频超过 Stream.MaxSize
+var ErrTooLarge = errors.New("audio too large")
+
+// Stream 单个合成请求，由 Mux 按消息路径回调
+type Stream struct {
+	OnAudio    func([]byte)
+	OnMetadata func(*Message) // audio.metadata，可为空
+	MaxSize    int            // 音频最大字节数, 超过时该请求失败, 不影响连接上的其他请求。0为不限制
+
+	lock     sync.Mutex
+	done     bool
+	size     int
+	finished chan struct{}
+	failed   chan error
+}
+
+func NewStream(onAudio func([]byte)) *Stream {
+	return &Stream{OnAudio: onAudio, finished: make(chan struct{}, 1), failed: make(chan error, 1)}
+}
+
+// Wait 等待 turn.end, 连接断开或ctx取消
+func (s *Stream) Wait(ctx context.Context) error {
+	select {
+	case <-s.finished:
+		return nil
+	case err := <-s.failed:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/* 在锁内回调, 保证请求结束后不再回调 */
+func (s *Stream) call(fn func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.done {
+		fn()
+	}
+}
+
+/* 累计音频大小, 超过MaxSize时结束请求并返回false */
+func (s *Stream) add(n int) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.size += n
+	if s.MaxSize > 0 && s.size > s.MaxSize && !s.done {
+		s.done = true
+		s.fail(ErrTooLarge)
+	}
+	return !s.done
+}
+
+func (s *Stream) close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.done = true
+}
+
+func (s *Stream) finish() {
+	select {
+	case s.finished <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Stream) fail(err error) {
+	select {
+	case s.failed <- err:
+	default:
+	}
+}
+
+// Mux 按 X-RequestId 将消息分发到对应的请求，并发安全
+type Mux struct {
+	lock    sync.Mutex
+	streams map[string]*Stream
+}
+
+// Add 注册请求
+func (m *Mux) Add(id string, s *Stream) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.streams == nil {
+		m.streams = make(map[string]*Stream)
+	}
+	m.streams[strings.ToLower(id)] = s
+}
+
+// Remove 移除请求，之后不再回调
+func (m *Mux) Remove(id string) {
+	m.lock.Lock()
+	s := m.streams[strings.ToLower(id)]
+	delete(m.streams, strings.ToLower(id))
+	m.lock.Unlock()
+	if s != nil {
+		s.close()
+	}
+}
+
+// Len 进行中的请求数
+func (m *Mux) Len() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.streams)
+}
+
+// Dispatch 分发消息, 未知请求(如已取消)的消息会被忽略
+func (m *Mux) Dispatch(msg *Message) {
+	m.lock.Lock()
+	s := m.streams[msg.RequestId()]
+	m.lock.Unlock()
+	if s == nil {
+		return
+	}
+
+	switch msg.Path() {
+	case PathTurnStart, PathResponse:
+		log.Debugln("收到消息:", msg.Path())
+	case PathAudioMetadata:
+		if s.OnMetadata != nil {
+			s.call(func() { s.OnMetadata(msg) })
+		}
+	case PathAudio:
+		if msg.Binary && len(msg.Body) > 0 && s.add(len(msg.Body)) {
+			s.call(func() { s.OnAudio(msg.Body) })
+		}
+	case PathTurnEnd:
+		s.finish()
+	}
+}
+
+// Fail 连接断开，所有进行中的请求失败
+func (m *Mux) Fail(err error) {
+	m.lock.Lock()
+	streams := m.streams
+	m.streams = nil
+	m.lock.Unlock()
+	for _, s := range streams {
+		s.fail(err)
+	}
+}
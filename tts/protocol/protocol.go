@@ -0,0 +1,163 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	tsg "github.com/jing332/tts-server-go"
+	"github.com/jing332/tts-server-go/tts"
+)
+
+// 消息路径 (Path 头)
+const (
+	PathSpeechConfig     = "speech.config"
+	PathSynthesisContext = "synthesis.context"
+	PathSsml             = "ssml"
+
+	PathTurnStart     = "turn.start"
+	PathResponse      = "response"
+	PathAudioMetadata = "audio.metadata"
+	PathAudio         = "audio"
+	PathTurnEnd       = "turn.end"
+)
+
+var (
+	// ErrShortMessage 消息长度不足
+	ErrShortMessage = errors.New("protocol: message too short")
+	// ErrInvalidHeader 消息头格式错误
+	ErrInvalidHeader = errors.New("protocol: invalid header")
+)
+
+// Message 解析后的WebSocket消息
+type Message struct {
+	Binary  bool
+	Headers map[string]string // 键为小写
+	Body    []byte
+}
+
+// Header 获取消息头，不区分大小写
+func (m *Message) Header(key string) string {
+	return m.Headers[strings.ToLower(key)]
+}
+
+func (m *Message) Path() string {
+	return m.Header("Path")
+}
+
+// RequestId 小写的 X-RequestId
+func (m *Message) RequestId() string {
+	return strings.ToLower(m.Header("X-RequestId"))
+}
+
+func (m *Message) ContentType() string {
+	return m.Header("Content-Type")
+}
+
+// Parse 根据WebSocket消息类型解析
+func Parse(messageType int, p []byte) (*Message, error) {
+	if messageType == websocket.BinaryMessage {
+		return ParseBinary(p)
+	}
+	return ParseText(p)
+}
+
+// ParseText 文本消息: 消息头与消息体以空行分隔
+func ParseText(p []byte) (*Message, error) {
+	head, body := string(p), ""
+	if index := strings.Index(head, "\r\n\r\n"); index >= 0 {
+		head, body = head[:index], head[index+4:]
+	}
+	headers, err := parseHeaders(head)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Headers: headers, Body: []byte(body)}, nil
+}
+
+// ParseBinary 二进制消息: 前2字节为消息头长度(大端序)，其后为消息头与音频数据
+func ParseBinary(p []byte) (*Message, error) {
+	if len(p) < 2 {
+		return nil, ErrShortMessage
+	}
+	headerLen := int(binary.BigEndian.Uint16(p[:2]))
+	if len(p) < 2+headerLen {
+		return nil, ErrShortMessage
+	}
+	headers, err := parseHeaders(string(p[2 : 2+headerLen]))
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Binary: true, Headers: headers, Body: p[2+headerLen:]}, nil
+}
+
+func parseHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, line := range strings.Split(s, "\r\n") {
+		if line == "" {
+			continue
+		}
+		index := strings.Index(line, ":")
+		if index <= 0 {
+			return nil, ErrInvalidHeader
+		}
+		headers[strings.ToLower(strings.TrimSpace(line[:index]))] = strings.TrimSpace(line[index+1:])
+	}
+	return headers, nil
+}
+
+// TextMessage 构造发送的文本消息，requestId为空时不添加 X-RequestId
+func TextMessage(path, requestId, contentType, body string) []byte {
+	var sb strings.Builder
+	sb.WriteString("Path: " + path + "\r\n")
+	if requestId != "" {
+		sb.WriteString("X-RequestId: " + requestId + "\r\n")
+	}
+	sb.WriteString("X-Timestamp: " + tsg.GetISOTime() + "\r\n")
+	sb.WriteString("Content-Type: " + contentType + "\r\n\r\n")
+	sb.WriteString(body)
+	return []byte(sb.String())
+}
+
+// NewRequestId 生成不带'-'的请求ID, 与官方SDK一致
+func NewRequestId() string {
+	return strings.ReplaceAll(tsg.GetUUID(), "-", "")
+}
+
+type metadata struct {
+	Metadata []struct {
+		Type string `json:"Type"`
+		Data struct {
+			Offset   int64 `json:"Offset"`
+			Duration int64 `json:"Duration"`
+			Text     struct {
+				Text string `json:"Text"`
+			} `json:"text"`
+		} `json:"Data"`
+	} `json:"Metadata"`
+}
+
+// ParseMetadata 解析 audio.metadata 消息体中的边界事件，忽略其他类型(如SessionEnd)
+func ParseMetadata(body []byte) ([]tts.Boundary, error) {
+	var m metadata
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, err
+	}
+
+	var boundaries []tts.Boundary
+	for _, v := range m.Metadata {
+		if v.Type != tts.WordBoundary && v.Type != tts.SentenceBoundary {
+			continue
+		}
+		boundaries = append(boundaries, tts.Boundary{
+			Type:     v.Type,
+			Offset:   time.Duration(v.Data.Offset) * 100, /* 单位为100纳秒 */
+			Duration: time.Duration(v.Data.Duration) * 100,
+			Text:     v.Data.Text.Text,
+		})
+	}
+	return boundaries, nil
+}
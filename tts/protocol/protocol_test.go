@@ -0,0 +1,196 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jing332/tts-server-go/tts"
+)
+
+/* 构造二进制帧: 2字节消息头长度 + 消息头 + 音频数据 */
+func binaryFrame(header string, body []byte) []byte {
+	p := []byte{byte(len(header) >> 8), byte(len(header))}
+	p = append(p, header...)
+	return append(p, body...)
+}
+
+/* 录制自Edge大声朗读接口的消息 */
+var (
+	frameTurnStart = []byte("X-RequestId:1d0bd5a1d8b54b5c8c5d4e0d2c1b6a99\r\nContent-Type:application/json; charset=utf-8\r\nPath:turn.start\r\n\r\n" +
+		`{"context":{"serviceTag":"0c0ab66b0ed94f9fa6c3e4b8f0b8c8de"}}`)
+	frameResponse = []byte("X-RequestId:1d0bd5a1d8b54b5c8c5d4e0d2c1b6a99\r\nContent-Type:application/json; charset=utf-8\r\nPath:response\r\n\r\n" +
+		`{"context":{"serviceTag":"0c0ab66b0ed94f9fa6c3e4b8f0b8c8de"},"audio":{"type":"inline","streamId":"8E8F4F3C9E2B4B6C9A1B2C3D4E5F6A7B"}}`)
+	frameMetadata = []byte("X-RequestId:1d0bd5a1d8b54b5c8c5d4e0d2c1b6a99\r\nContent-Type:application/json; charset=utf-8\r\nPath:audio.metadata\r\n\r\n" +
+		`{"Metadata":[{"Type":"WordBoundary","Data":{"Offset":1000000,"Duration":3250000,"text":{"Text":"你好","Length":2,"BoundaryType":"WordBoundary"}}}]}`)
+	frameTurnEnd = []byte("X-RequestId:1d0bd5a1d8b54b5c8c5d4e0d2c1b6a99\r\nContent-Type:application/json; charset=utf-8\r\nPath:turn.end\r\n\r\n{}")
+	frameAudio   = binaryFrame("X-RequestId:1d0bd5a1d8b54b5c8c5d4e0d2c1b6a99\r\nContent-Type:audio/webm; codec=opus\r\nX-StreamId:8E8F4F3C9E2B4B6C9A1B2C3D4E5F6A7B\r\nPath:audio\r\n",
+		[]byte{0x1a, 0x45, 0xdf, 0xa3, 0x9f, 0x42, 0x86})
+	frameAudioEnd = binaryFrame("X-RequestId:1d0bd5a1d8b54b5c8c5d4e0d2c1b6a99\r\nContent-Type:audio/webm; codec=opus\r\nX-StreamId:8E8F4F3C9E2B4B6C9A1B2C3D4E5F6A7B\r\nPath:audio\r\n", nil)
+)
+
+func TestParse(t *testing.T) {
+	const id = "1d0bd5a1d8b54b5c8c5d4e0d2c1b6a99"
+	tests := []struct {
+		name        string
+		messageType int
+		frame       []byte
+		path        string
+		contentType string
+		body        []byte
+		err         error
+	}{
+		{"turn.start", websocket.TextMessage, frameTurnStart, PathTurnStart, "application/json; charset=utf-8",
+			[]byte(`{"context":{"serviceTag":"0c0ab66b0ed94f9fa6c3e4b8f0b8c8de"}}`), nil},
+		{"response", websocket.TextMessage, frameResponse, PathResponse, "application/json; charset=utf-8", nil, nil},
+		{"audio.metadata", websocket.TextMessage, frameMetadata, PathAudioMetadata, "application/json; charset=utf-8", nil, nil},
+		{"turn.end", websocket.TextMessage, frameTurnEnd, PathTurnEnd, "application/json; charset=utf-8", []byte("{}"), nil},
+		{"audio", websocket.BinaryMessage, frameAudio, PathAudio, "audio/webm; codec=opus", []byte{0x1a, 0x45, 0xdf, 0xa3, 0x9f, 0x42, 0x86}, nil},
+		{"audio end", websocket.BinaryMessage, frameAudioEnd, PathAudio, "audio/webm; codec=opus", []byte{}, nil},
+		{"empty binary", websocket.BinaryMessage, []byte{}, "", "", nil, ErrShortMessage},
+		{"one byte binary", websocket.BinaryMessage, []byte{0x00}, "", "", nil, ErrShortMessage},
+		{"header length overflow", websocket.BinaryMessage, []byte{0x00, 0xff, 'P'}, "", "", nil, ErrShortMessage},
+		{"invalid header", websocket.TextMessage, []byte("no colon here\r\n\r\n{}"), "", "", nil, ErrInvalidHeader},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := Parse(tt.messageType, tt.frame)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("want %v, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Path() != tt.path || msg.RequestId() != id || msg.ContentType() != tt.contentType {
+				t.Fatalf("headers: %v", msg.Headers)
+			}
+			if tt.body != nil && !bytes.Equal(msg.Body, tt.body) {
+				t.Fatalf("body: %q", msg.Body)
+			}
+		})
+	}
+}
+
+func TestTextMessage(t *testing.T) {
+	p := TextMessage(PathSsml, "abc", "application/ssml+xml", "<speak/>")
+	msg, err := ParseText(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Path() != PathSsml || msg.RequestId() != "abc" || string(msg.Body) != "<speak/>" || msg.Header("X-Timestamp") == "" {
+		t.Fatalf("%q", p)
+	}
+
+	msg, _ = ParseText(TextMessage(PathSpeechConfig, "", "application/json", "{}"))
+	if _, ok := msg.Headers["x-requestid"]; ok {
+		t.Fatal("empty request id should be omitted")
+	}
+}
+
+func TestMux(t *testing.T) {
+	const id = "1D0BD5A1D8B54B5C8C5D4E0D2C1B6A99" /* 不区分大小写 */
+	var audio []byte
+	var metadata int
+	s := NewStream(func(data []byte) { audio = append(audio, data...) })
+	s.OnMetadata = func(*Message) { metadata++ }
+
+	mux := &Mux{}
+	mux.Add(id, s)
+	for _, frame := range []struct {
+		messageType int
+		p           []byte
+	}{
+		{websocket.TextMessage, frameTurnStart},
+		{websocket.TextMessage, frameResponse},
+		{websocket.TextMessage, frameMetadata},
+		{websocket.BinaryMessage, frameAudio},
+		{websocket.BinaryMessage, frameAudioEnd},
+		{websocket.BinaryMessage, binaryFrame("X-RequestId:other\r\nPath:audio\r\n", []byte{1, 2, 3})},
+		{websocket.TextMessage, frameTurnEnd},
+	} {
+		msg, err := Parse(frame.messageType, frame.p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mux.Dispatch(msg)
+	}
+
+	if err := s.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(audio) != 7 || metadata != 1 {
+		t.Fatalf("audio: %d, metadata: %d", len(audio), metadata)
+	}
+
+	mux.Remove(id)
+	if mux.Len() != 0 {
+		t.Fatal("stream should be removed")
+	}
+	msg, _ := ParseBinary(frameAudio)
+	mux.Dispatch(msg)
+	if len(audio) != 7 {
+		t.Fatal("removed stream should not receive audio")
+	}
+}
+
+func TestMuxFail(t *testing.T) {
+	mux := &Mux{}
+	s := NewStream(func([]byte) {})
+	mux.Add("a", s)
+	mux.Fail(websocket.ErrCloseSent)
+	if err := s.Wait(context.Background()); !errors.Is(err, websocket.ErrCloseSent) {
+		t.Fatalf("want ErrCloseSent, got %v", err)
+	}
+}
+
+func TestMuxMaxSize(t *testing.T) {
+	mux := &Mux{}
+	var big, small []byte
+	s1 := NewStream(func(data []byte) { big = append(big, data...) })
+	s1.MaxSize = 10
+	s2 := NewStream(func(data []byte) { small = append(small, data...) })
+	mux.Add("a", s1)
+	mux.Add("b", s2)
+	for i := 0; i < 3; i++ {
+		for _, id := range []string{"a", "b"} {
+			msg, _ := ParseBinary(binaryFrame("X-RequestId:"+id+"\r\nPath:audio\r\n", []byte{1, 2, 3, 4, 5}))
+			mux.Dispatch(msg)
+		}
+	}
+	msg, _ := Parse(websocket.TextMessage, []byte("X-RequestId:b\r\nPath:turn.end\r\n\r\n{}"))
+	mux.Dispatch(msg)
+
+	if err := s1.Wait(context.Background()); !errors.Is(err, ErrTooLarge) || len(big) != 10 {
+		t.Fatalf("%v: %d", err, len(big))
+	}
+	if err := s2.Wait(context.Background()); err != nil || len(small) != 15 { /* 同一连接上的其他请求不受影响 */
+		t.Fatalf("%v: %d", err, len(small))
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	msg, _ := ParseText(frameMetadata)
+	boundaries, err := ParseMetadata(msg.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(boundaries) != 1 {
+		t.Fatalf("boundaries: %+v", boundaries)
+	}
+	b := boundaries[0]
+	if b.Type != tts.WordBoundary || b.Text != "你好" || b.Offset != 100*time.Millisecond || b.Duration != 325*time.Millisecond {
+		t.Fatalf("boundary: %+v", b)
+	}
+
+	boundaries, err = ParseMetadata([]byte(`{"Metadata":[{"Type":"SessionEnd","Data":{"Offset":5000000}}]}`))
+	if err != nil || len(boundaries) != 0 {
+		t.Fatalf("SessionEnd should be ignored: %+v, %v", boundaries, err)
+	}
+}
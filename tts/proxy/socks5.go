@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+)
+
+// ErrSocksAuth SOCKS5代理认证失败
+var ErrSocksAuth = errors.New("socks5 authentication failed")
+
+const (
+	socksVersion      = 5
+	socksNoAuth       = 0
+	socksUserPass     = 2
+	socksNoAcceptable = 0xff
+	socksConnect      = 1
+	socksIPv4         = 1
+	socksDomain       = 3
+	socksIPv6         = 4
+)
+
+var socksReplies = []string{
+	"succeeded",
+	"general SOCKS server failure",
+	"connection not allowed by ruleset",
+	"network unreachable",
+	"host unreachable",
+	"connection refused",
+	"TTL expired",
+	"command not supported",
+	"address type not supported",
+}
+
+/* SOCKS5 CONNECT(RFC 1928), 有用户名时支持用户名密码认证(RFC 1929), 域名由代理解析 */
+func socks5Connect(conn net.Conn, user *url.Userinfo, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("无效的端口: %s", portStr)
+	}
+
+	methods := []byte{socksNoAuth}
+	if user != nil {
+		methods = append(methods, socksUserPass)
+	}
+	if _, err = conn.Write(append([]byte{socksVersion, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	buf := make([]byte, 2)
+	if _, err = io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if buf[0] != socksVersion {
+		return fmt.Errorf("不是SOCKS5代理: version %d", buf[0])
+	}
+	switch buf[1] {
+	case socksNoAuth:
+	case socksUserPass:
+		if user == nil {
+			return ErrSocksAuth
+		}
+		password, _ := user.Password()
+		if len(user.Username()) > 255 || len(password) > 255 {
+			return errors.New("socks5 用户名或密码过长")
+		}
+		req := []byte{1, byte(len(user.Username()))}
+		req = append(req, user.Username()...)
+		req = append(req, byte(len(password)))
+		req = append(req, password...)
+		if _, err = conn.Write(req); err != nil {
+			return err
+		}
+		if _, err = io.ReadFull(conn, buf); err != nil {
+			return err
+		}
+		if buf[1] != 0 {
+			return ErrSocksAuth
+		}
+	case socksNoAcceptable:
+		return ErrSocksAuth
+	default:
+		return fmt.Errorf("socks5 不支持的认证方式: %d", buf[1])
+	}
+
+	req := []byte{socksVersion, socksConnect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return fmt.Errorf("域名过长: %s", host)
+		}
+		req = append(req, socksDomain, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(append(req, socksIPv4), ip4...)
+	} else {
+		req = append(append(req, socksIPv6), ip.To16()...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err = conn.Write(req); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 4)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		if int(reply[1]) < len(socksReplies) {
+			return fmt.Errorf("socks5: %s", socksReplies[reply[1]])
+		}
+		return fmt.Errorf("socks5: unknown error %d", reply[1])
+	}
+	/* 跳过绑定地址与端口 */
+	var skip int
+	switch reply[3] {
+	case socksIPv4:
+		skip = net.IPv4len
+	case socksIPv6:
+		skip = net.IPv6len
+	case socksDomain:
+		if _, err = io.ReadFull(conn, reply[:1]); err != nil {
+			return err
+		}
+		skip = int(reply[0])
+	default:
+		return fmt.Errorf("socks5 不支持的地址类型: %d", reply[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
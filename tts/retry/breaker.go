@@ -0,0 +1,191 @@
+package retry
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrOpen 熔断器已打开, 暂停请求上游
+var ErrOpen = errors.New("circuit breaker open")
+
+// State 熔断器状态
+type State string
+
+const (
+	StateClosed   State = "closed"    // 正常请求
+	StateOpen     State = "open"      // 连续失败过多, 冷却期内拒绝请求
+	StateHalfOpen State = "half-open" // 冷却结束, 仅放行一个探测请求
+)
+
+// Breaker 熔断器, 连续失败 Threshold 次后打开, 冷却 Cooldown 后半开, 探测成功则关闭, 失败则重新打开。
+// SSML错误与取消不计入失败
+type Breaker struct {
+	Name      string
+	Threshold int           // 连续失败次数, 默认5
+	Cooldown  time.Duration // 打开后的冷却时间, 默认30s
+
+	lock     sync.Mutex
+	state    State
+	failures int
+	probing  bool
+	openedAt time.Time
+	lastErr  error
+	lastKind Kind
+}
+
+// Status 熔断器状态
+type Status struct {
+	Name      string     `json:"name"`
+	State     State      `json:"state"`
+	Failures  int        `json:"failures"`            // 连续失败次数
+	LastError string     `json:"lastError,omitempty"` // 最近一次错误
+	LastKind  Kind       `json:"lastKind,omitempty"`  // 最近一次错误分类
+	OpenedAt  *time.Time `json:"openedAt,omitempty"`  // 最近一次打开的时间
+	RetryAt   *time.Time `json:"retryAt,omitempty"`   // 打开时, 允许探测的时间
+}
+
+func (b *Breaker) threshold() int {
+	if b.Threshold <= 0 {
+		return 5
+	}
+	return b.Threshold
+}
+
+func (b *Breaker) cooldown() time.Duration {
+	if b.Cooldown <= 0 {
+		return 30 * time.Second
+	}
+	return b.Cooldown
+}
+
+/* 冷却结束时转为半开, 需持有锁 */
+func (b *Breaker) stateLocked() State {
+	if b.state == "" {
+		b.state = StateClosed
+	}
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.cooldown() {
+		b.state = StateHalfOpen
+		b.probing = false
+	}
+	return b.state
+}
+
+// Allow 是否允许请求, 打开时或半开且已有探测请求时返回 ErrOpen。b为nil时总是允许
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	switch b.stateLocked() {
+	case StateOpen:
+		return ErrOpen
+	case StateHalfOpen:
+		if b.probing {
+			return ErrOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Record 记录请求结果
+func (b *Breaker) Record(err error) {
+	if b == nil {
+		return
+	}
+	kind := Classify(err)
+	if kind == KindSsml || kind == KindCanceled || errors.Is(err, ErrOpen) {
+		b.lock.Lock()
+		b.probing = false /* 探测结果无效, 允许下一个请求探测 */
+		b.lock.Unlock()
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	state := b.stateLocked()
+	if err == nil {
+		if state != StateClosed {
+			log.Infof("%s熔断器已关闭", b.Name)
+		}
+		b.state, b.failures, b.probing = StateClosed, 0, false
+		return
+	}
+	b.failures++
+	b.lastErr, b.lastKind = err, kind
+	if state == StateHalfOpen || (state == StateClosed && b.failures >= b.threshold()) {
+		b.state, b.openedAt, b.probing = StateOpen, time.Now(), false
+		log.Warnf("%s连续失败%d次, 熔断器已打开, %v后重试: %v", b.Name, b.failures, b.cooldown(), err)
+	}
+}
+
+// Status 当前状态
+func (b *Breaker) Status() Status {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	st := Status{Name: b.Name, State: b.stateLocked(), Failures: b.failures, LastKind: b.lastKind}
+	if b.lastErr != nil {
+		st.LastError = b.lastErr.Error()
+	}
+	if !b.openedAt.IsZero() {
+		openedAt := b.openedAt
+		st.OpenedAt = &openedAt
+	}
+	if st.State == StateOpen {
+		retryAt := b.openedAt.Add(b.cooldown())
+		st.RetryAt = &retryAt
+	}
+	return st
+}
+
+// Breakers 按引擎名称创建的熔断器
+type Breakers struct {
+	Threshold int           // 连续失败次数, 默认5
+	Cooldown  time.Duration // 冷却时间, 默认30s
+
+	lock     sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// Get 获取名称对应的熔断器, 不存在时创建。bs为nil时返回nil, 即不熔断
+func (bs *Breakers) Get(name string) *Breaker {
+	if bs == nil {
+		return nil
+	}
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	if bs.breakers == nil {
+		bs.breakers = make(map[string]*Breaker)
+	}
+	b, ok := bs.breakers[name]
+	if !ok {
+		b = &Breaker{Name: name, Threshold: bs.Threshold, Cooldown: bs.Cooldown}
+		bs.breakers[name] = b
+	}
+	return b
+}
+
+// Status 所有熔断器的状态, 按名称排序
+func (bs *Breakers) Status() []Status {
+	if bs == nil {
+		return nil
+	}
+	bs.lock.Lock()
+	list := make([]*Breaker, 0, len(bs.breakers))
+	for _, b := range bs.breakers {
+		list = append(list, b)
+	}
+	bs.lock.Unlock()
+
+	status := make([]Status, 0, len(list))
+	for _, b := range list {
+		status = append(status, b.Status())
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Name < status[j].Name })
+	return status
+}
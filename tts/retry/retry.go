@@ -0,0 +1,147 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jing332/tts-server-go/tts"
+	"github.com/jing332/tts-server-go/tts/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// Kind 错误分类
+type Kind string
+
+const (
+	KindNetwork   Kind = "network"    // 网络错误或上游5xx, 可重试
+	KindSsml      Kind = "ssml"       // SSML格式错误等被服务器拒绝的请求, 不重试
+	KindRateLimit Kind = "rate_limit" // 请求过于频繁, 延长等待后重试
+	KindAuth      Kind = "auth"       // 认证失败(含代理认证), 不重试
+	KindCanceled  Kind = "canceled"   // 请求被取消或超时, 不重试
+	KindUnknown   Kind = "unknown"    // 其他错误, 可重试
+)
+
+// Classify 对上游错误分类
+func Classify(err error) Kind {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return KindCanceled
+	}
+	if errors.Is(err, protocol.ErrTooLarge) { /* 重试结果相同 */
+		return KindSsml
+	}
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		switch closeErr.Code {
+		case websocket.CloseAbnormalClosure: /* 1006异常断开 */
+			return KindNetwork
+		case websocket.CloseTryAgainLater:
+			return KindRateLimit
+		default: /* 服务器主动断开，如SSML格式错误 */
+			return KindSsml
+		}
+	}
+	var statusErr *tts.StatusError
+	if errors.As(err, &statusErr) {
+		switch code := statusErr.Code; {
+		case code == http.StatusUnauthorized || code == http.StatusForbidden || code == http.StatusProxyAuthRequired:
+			return KindAuth
+		case code == http.StatusTooManyRequests:
+			return KindRateLimit
+		case code == http.StatusBadRequest:
+			return KindSsml
+		case code >= 500:
+			return KindNetwork
+		}
+		return KindUnknown
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return KindNetwork
+	}
+	return KindUnknown
+}
+
+// Retryable 该类错误是否可重试
+func (k Kind) Retryable() bool {
+	return k == KindNetwork || k == KindRateLimit || k == KindUnknown
+}
+
+// Backoff 带抖动的指数退避, 第n次重试等待 [d/2, d), d = Base * 2^n, 不超过 Max
+type Backoff struct {
+	Base time.Duration // 初始间隔, 默认1s, 负数为不等待
+	Max  time.Duration // 最大间隔, 默认30s
+}
+
+// Delay 第n次(从0开始)重试前的等待时间, 限流时加倍
+func (b Backoff) Delay(n int, kind Kind) time.Duration {
+	base, max := b.Base, b.Max
+	if base < 0 {
+		return 0
+	}
+	if base == 0 {
+		base = time.Second
+	}
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+	if kind == KindRateLimit {
+		n++
+	}
+	d := base
+	for i := 0; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// Policy 重试策略
+type Policy struct {
+	Attempts int // 最多尝试次数, 默认3
+	Backoff  Backoff
+}
+
+// Do 执行fn, 可重试的错误按退避间隔重试, breaker不为空时先检查熔断状态并记录结果。
+// fn返回 retry=false 时不再重试, 如流式合成已输出数据
+func (p Policy) Do(ctx context.Context, breaker *Breaker, fn func(attempt int) (retry bool, err error)) (err error) {
+	attempts := p.Attempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	for i := 0; i < attempts; i++ {
+		if err = breaker.Allow(); err != nil {
+			return err
+		}
+		var again bool
+		again, err = fn(i)
+		breaker.Record(err)
+		if err == nil {
+			return nil
+		}
+		kind := Classify(err)
+		if !again || !kind.Retryable() || i == attempts-1 {
+			return err
+		}
+
+		delay := p.Backoff.Delay(i, kind)
+		log.Warnf("第%d次合成失败(%s), %dms后重试: %v", i+1, kind, delay.Milliseconds(), err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
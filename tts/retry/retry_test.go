@@ -0,0 +1,170 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jing332/tts-server-go/tts"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Kind
+	}{
+		{context.Canceled, KindCanceled},
+		{fmt.Errorf("合成超时: %w", context.DeadlineExceeded), KindCanceled},
+		{&websocket.CloseError{Code: websocket.CloseAbnormalClosure}, KindNetwork},
+		{&websocket.CloseError{Code: websocket.CloseTryAgainLater}, KindRateLimit},
+		{&websocket.CloseError{Code: websocket.CloseInvalidFramePayloadData}, KindSsml},
+		{&tts.StatusError{Code: http.StatusUnauthorized, Err: errors.New("bad handshake")}, KindAuth},
+		{&tts.StatusError{Code: http.StatusProxyAuthRequired, Err: errors.New("CONNECT失败")}, KindAuth},
+		{&tts.StatusError{Code: http.StatusTooManyRequests, Err: errors.New("bad handshake")}, KindRateLimit},
+		{&tts.StatusError{Code: http.StatusBadRequest, Err: errors.New("bad request")}, KindSsml},
+		{&tts.StatusError{Code: http.StatusBadGateway, Err: errors.New("bad handshake")}, KindNetwork},
+		{io.ErrUnexpectedEOF, KindNetwork},
+		{errors.New("unknown"), KindUnknown},
+	}
+	for _, test := range tests {
+		if got := Classify(test.err); got != test.want {
+			t.Errorf("%v: %s, want %s", test.err, got, test.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Base: 100 * time.Millisecond, Max: time.Second}
+	for i := 0; i < 100; i++ {
+		if d := b.Delay(0, KindNetwork); d < 50*time.Millisecond || d > 100*time.Millisecond {
+			t.Fatal(d)
+		}
+		if d := b.Delay(2, KindNetwork); d < 200*time.Millisecond || d > 400*time.Millisecond {
+			t.Fatal(d)
+		}
+		if d := b.Delay(1, KindRateLimit); d < 200*time.Millisecond || d > 400*time.Millisecond {
+			t.Fatal(d)
+		}
+		if d := b.Delay(10, KindNetwork); d < 500*time.Millisecond || d > time.Second {
+			t.Fatal(d)
+		}
+	}
+	if d := (Backoff{Base: -1}).Delay(3, KindNetwork); d != 0 {
+		t.Fatal(d)
+	}
+}
+
+func TestPolicyDo(t *testing.T) {
+	p := Policy{Attempts: 3, Backoff: Backoff{Base: -1}}
+	calls := 0
+	err := p.Do(context.Background(), nil, func(int) (bool, error) {
+		calls++
+		if calls < 3 {
+			return true, io.ErrUnexpectedEOF
+		}
+		return true, nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatal(err, calls)
+	}
+
+	/* 不可重试的错误与已输出数据时不重试 */
+	calls = 0
+	ssmlErr := &websocket.CloseError{Code: websocket.CloseInvalidFramePayloadData}
+	err = p.Do(context.Background(), nil, func(int) (bool, error) {
+		calls++
+		return true, ssmlErr
+	})
+	if err != ssmlErr || calls != 1 {
+		t.Fatal(err, calls)
+	}
+	calls = 0
+	err = p.Do(context.Background(), nil, func(int) (bool, error) {
+		calls++
+		return false, io.ErrUnexpectedEOF
+	})
+	if err != io.ErrUnexpectedEOF || calls != 1 {
+		t.Fatal(err, calls)
+	}
+
+	/* 等待时取消 */
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Policy{Backoff: Backoff{Base: time.Hour}}.Do(ctx, nil, func(int) (bool, error) {
+		return true, io.ErrUnexpectedEOF
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	b := &Breaker{Name: "edge", Threshold: 2, Cooldown: 50 * time.Millisecond}
+	p := Policy{Attempts: 5, Backoff: Backoff{Base: -1}}
+	calls := 0
+	fail := func(int) (bool, error) {
+		calls++
+		return true, io.ErrUnexpectedEOF
+	}
+	if err := p.Do(context.Background(), b, fail); !errors.Is(err, ErrOpen) || calls != 2 {
+		t.Fatal(err, calls)
+	}
+	if st := b.Status(); st.State != StateOpen || st.LastKind != KindNetwork || st.RetryAt == nil {
+		t.Fatalf("%+v", st)
+	}
+
+	/* SSML错误不计入失败 */
+	b2 := &Breaker{Threshold: 1}
+	b2.Record(&websocket.CloseError{Code: websocket.CloseInvalidFramePayloadData})
+	if b2.Allow() != nil {
+		t.Fatal("ssml error should not open breaker")
+	}
+
+	/* 冷却后半开, 仅放行一个探测请求, 失败重新打开 */
+	time.Sleep(60 * time.Millisecond)
+	if b.Status().State != StateHalfOpen {
+		t.Fatal(b.Status().State)
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatal("only one probe allowed")
+	}
+	b.Record(io.ErrUnexpectedEOF)
+	if b.Status().State != StateOpen {
+		t.Fatal(b.Status().State)
+	}
+
+	/* 探测成功则关闭 */
+	time.Sleep(60 * time.Millisecond)
+	calls = 0
+	if err := p.Do(context.Background(), b, func(int) (bool, error) { calls++; return true, nil }); err != nil {
+		t.Fatal(err)
+	}
+	if st := b.Status(); st.State != StateClosed || st.Failures != 0 || calls != 1 {
+		t.Fatalf("%+v", st)
+	}
+}
+
+func TestBreakers(t *testing.T) {
+	var nilBreakers *Breakers
+	if nilBreakers.Get("edge").Allow() != nil || nilBreakers.Status() != nil {
+		t.Fatal("nil breakers should allow")
+	}
+
+	bs := &Breakers{Threshold: 1}
+	if bs.Get("edge") != bs.Get("edge") {
+		t.Fatal("breaker should be reused")
+	}
+	bs.Get("azure").Record(io.ErrUnexpectedEOF)
+	st := bs.Status()
+	if len(st) != 2 || st[0].Name != "azure" || st[0].State != StateOpen || st[1].State != StateClosed {
+		t.Fatalf("%+v", st)
+	}
+}
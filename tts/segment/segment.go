@@ -0,0 +1,262 @@
+package segment
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/* 断句优先级, 数值越小越优先 */
+const (
+	levelNone     = iota
+	levelSentence /* 引号外的句末标点, 换行 */
+	levelQuoted   /* 引号内的句末标点 */
+	levelClause   /* 逗号等分句标点 */
+	levelSpace    /* 空白 */
+)
+
+const (
+	sentenceEnds = "。！？!?；;…"
+	clauseEnds   = "，,、：:—"
+	openQuotes   = "“‘「『《（(【["
+	closeQuotes  = "”’」』》）)】]"
+)
+
+// Split 切分SSML片段，每段不超过maxRunes个字符。
+// 优先在引号外的句末标点处切分，其次为引号内的句末、分句标点、空白，最后按字数切分；不会切断SSML标签。
+// 在元素内切分时, 在段末补全结束标签, 并在下一段开头重新打开, 补全的标签不计入长度。
+// 相邻的短句会合并到同一段中。纯文本请使用 SplitText
+func Split(text string, maxRunes int) []string {
+	return split(text, maxRunes, true)
+}
+
+// SplitText 切分纯文本，规则同 Split，但 < 与 > 作为普通字符，不识别标签
+func SplitText(text string, maxRunes int) []string {
+	return split(text, maxRunes, false)
+}
+
+func split(text string, maxRunes int, tags bool) []string {
+	runes := []rune(text)
+	levels := boundaries(runes, tags)
+	var chunks []string
+	var b balancer
+	for len(runes) > 0 {
+		n := len(runes)
+		if maxRunes > 0 && n > maxRunes {
+			n = breakPoint(runes, levels, maxRunes, tags)
+		}
+		if !tags {
+			if chunk := strings.TrimSpace(string(runes[:n])); chunk != "" {
+				chunks = append(chunks, chunk)
+			}
+		} else if chunk, ok := b.wrap(string(runes[:n])); ok {
+			chunks = append(chunks, chunk)
+		}
+		runes, levels = runes[n:], levels[n:]
+	}
+	return chunks
+}
+
+// Sentences 在每个句末标点处切分，不合并短句, SSML元素的处理同 Split
+func Sentences(text string) []string {
+	runes := []rune(text)
+	levels := boundaries(runes, true)
+	var sentences []string
+	var b balancer
+	start := 0
+	for i, level := range levels {
+		if level == levelSentence || level == levelQuoted || i == len(runes)-1 {
+			if s, ok := b.wrap(string(runes[start : i+1])); ok {
+				sentences = append(sentences, s)
+			}
+			start = i + 1
+		}
+	}
+	return sentences
+}
+
+/* 记录各段之间未闭合的元素, 使每段的标签成对 */
+type balancer struct {
+	open []openTag
+}
+
+type openTag struct {
+	name string
+	raw  string /* 完整的开始标签 */
+}
+
+/* 补全段首的开始标签与段末的结束标签, 只有标签与空白的段返回false */
+func (b *balancer) wrap(chunk string) (string, bool) {
+	var prefix strings.Builder
+	for _, t := range b.open {
+		prefix.WriteString(t.raw)
+	}
+
+	content := false
+	rest := chunk
+	for {
+		start, end := nextTag(rest)
+		if start < 0 {
+			content = content || strings.TrimSpace(rest) != ""
+			break
+		}
+		content = content || strings.TrimSpace(rest[:start]) != ""
+		tag := rest[start:end]
+		switch {
+		case strings.HasPrefix(tag, "</"):
+			name := tagName(tag[2:])
+			for i := len(b.open) - 1; i >= 0; i-- {
+				if b.open[i].name == name {
+					b.open = b.open[:i]
+					break
+				}
+			}
+		case strings.HasPrefix(tag, "<!") || strings.HasPrefix(tag, "<?"):
+		case strings.HasSuffix(tag, "/>"): /* 如break, 视为内容 */
+			content = true
+		default:
+			b.open = append(b.open, openTag{name: tagName(tag[1:]), raw: tag})
+		}
+		rest = rest[end:]
+	}
+	if !content {
+		return "", false
+	}
+
+	var suffix strings.Builder
+	for i := len(b.open) - 1; i >= 0; i-- {
+		suffix.WriteString("</" + b.open[i].name + ">")
+	}
+	return prefix.String() + strings.TrimSpace(chunk) + suffix.String(), true
+}
+
+/* 下一个标签的起止位置, 无标签时返回-1 */
+func nextTag(s string) (start, end int) {
+	for i := 0; i < len(s)-1; i++ {
+		if s[i] != '<' {
+			continue
+		}
+		next, _ := utf8.DecodeRuneInString(s[i+1:])
+		if !isTagStart(next) {
+			continue
+		}
+		if j := strings.IndexByte(s[i:], '>'); j > 0 {
+			return i, i + j + 1
+		}
+		return -1, -1
+	}
+	return -1, -1
+}
+
+func tagName(s string) string {
+	if i := strings.IndexAny(s, " \t\r\n/>"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+/* 在前max个字符内选择优先级最高且最靠后的断点, 返回切分长度 */
+func breakPoint(runes []rune, levels []int, max int, tags bool) int {
+	for level := levelSentence; level <= levelSpace; level++ {
+		for i := max; i > 0; i-- {
+			if levels[i-1] == level {
+				return i
+			}
+		}
+	}
+
+	if !tags {
+		return max
+	}
+	/* 无可用断点, 按字数切分, 但不切断标签 */
+	if tagStart := lastTagStart(runes[:max]); tagStart > 0 {
+		return tagStart
+	} else if tagStart == 0 { /* 标签本身超长, 整体保留 */
+		for i := max; i < len(runes); i++ {
+			if runes[i] == '>' {
+				return i + 1
+			}
+		}
+		return len(runes)
+	}
+	return max
+}
+
+/* 若末尾处于未闭合的标签内, 返回标签起始位置 */
+func lastTagStart(runes []rune) int {
+	for i := len(runes) - 1; i >= 0; i-- {
+		switch runes[i] {
+		case '>':
+			return -1
+		case '<':
+			return i
+		}
+	}
+	return -1
+}
+
+/* levels[i] 表示在第i个字符之后断开的优先级, tags为true时不在SSML标签内断开 */
+func boundaries(runes []rune, tags bool) []int {
+	levels := make([]int, len(runes))
+	quoteDepth := 0
+	asciiQuote := false
+	inTag := false
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if inTag {
+			if r == '>' {
+				inTag = false
+			}
+			continue
+		}
+
+		switch {
+		case tags && r == '<' && i+1 < len(runes) && isTagStart(runes[i+1]):
+			inTag = true
+		case r == '"':
+			asciiQuote = !asciiQuote
+		case strings.ContainsRune(openQuotes, r):
+			quoteDepth++
+		case strings.ContainsRune(closeQuotes, r):
+			if quoteDepth > 0 {
+				quoteDepth--
+			}
+		case r == '\n':
+			levels[i] = levelSentence
+		case strings.ContainsRune(sentenceEnds, r) || r == '.' && isLatinPeriod(runes, i):
+			/* 连续的句末标点与右引号归入同一句 */
+			for i+1 < len(runes) && (strings.ContainsRune(sentenceEnds, runes[i+1]) || runes[i+1] == '.' ||
+				strings.ContainsRune(closeQuotes, runes[i+1]) || runes[i+1] == '"' && asciiQuote) {
+				i++
+				if runes[i] == '"' {
+					asciiQuote = false
+				} else if strings.ContainsRune(closeQuotes, runes[i]) && quoteDepth > 0 {
+					quoteDepth--
+				}
+			}
+			if quoteDepth > 0 || asciiQuote {
+				levels[i] = levelQuoted
+			} else {
+				levels[i] = levelSentence
+			}
+		case strings.ContainsRune(clauseEnds, r):
+			levels[i] = levelClause
+		case unicode.IsSpace(r):
+			levels[i] = levelSpace
+		}
+	}
+	return levels
+}
+
+func isTagStart(r rune) bool {
+	return r == '/' || r == '!' || r == '?' || unicode.IsLetter(r)
+}
+
+/* 英文句号: 后跟空白或位于末尾, 排除小数 */
+func isLatinPeriod(runes []rune, i int) bool {
+	if i+1 >= len(runes) {
+		return true
+	}
+	next := runes[i+1]
+	return unicode.IsSpace(next) || strings.ContainsRune(closeQuotes, next) || next == '"'
+}
@@ -0,0 +1,106 @@
+package segment
+
+import (
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxRunes int
+		want     []string
+	}{
+		{"short", "你好。", 10, []string{"你好。"}},
+		{"merge sentences", "第一句。第二句。第三句。", 8, []string{"第一句。第二句。", "第三句。"}},
+		{"latin", "Hello world. How are you? Fine.", 16, []string{"Hello world.", "How are you?", "Fine."}},
+		{"decimal", "圆周率约为3.14159。很长。", 14, []string{"圆周率约为3.14159。", "很长。"}},
+		{"closing quote", "他说：“走吧。”我们走了。", 9, []string{"他说：“走吧。”", "我们走了。"}},
+		{"prefer outside quote", "“你好。我是小明。”他说。然后", 13, []string{"“你好。我是小明。”他说。", "然后"}},
+		{"quoted fallback", "“你好。我是小明，今天天气很好。”", 8, []string{"“你好。", "我是小明，", "今天天气很好。”"}},
+		{"clause", "今天天气很好，我们去公园散步吧", 8, []string{"今天天气很好，", "我们去公园散步吧"}},
+		{"space", "aaaa bbbb cccc", 10, []string{"aaaa bbbb", "cccc"}},
+		{"runes", "一二三四五六七八九十", 4, []string{"一二三四", "五六七八", "九十"}},
+		{"newline", "标题\n正文。", 100, []string{"标题\n正文。"}},
+		{"tag", `一二<break time="1s"/>三四五`, 21, []string{`一二<break time="1s"/>三`, "四五"}},
+		{"long tag", `一二<break time="1s"/>三四`, 6, []string{"一二", `<break time="1s"/>`, "三四"}},
+		{"punctuation in tag", `<prosody rate="+10.5%">一句。二句。</prosody>`, 28, []string{`<prosody rate="+10.5%">一句。</prosody>`, `<prosody rate="+10.5%">二句。</prosody>`}},
+		{"nested", `<voice name="a"><prosody rate="10%">一句。二句。</prosody>三句。</voice>`, 40,
+			[]string{`<voice name="a"><prosody rate="10%">一句。</prosody></voice>`, `<voice name="a"><prosody rate="10%">二句。</prosody>三句。</voice>`}},
+		{"tag only", `<prosody rate="10%">一二三四。 </prosody>`, 25, []string{`<prosody rate="10%">一二三四。</prosody>`}},
+		{"ellipsis", "等等……好吧", 5, []string{"等等……", "好吧"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Split(tt.text, tt.maxRunes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("want %q, got %q", tt.want, got)
+			}
+			for _, chunk := range got {
+				if !wellFormed(chunk) {
+					t.Fatalf("unbalanced: %q", chunk)
+				}
+			}
+		})
+	}
+}
+
+/* 标签是否成对 */
+func wellFormed(chunk string) bool {
+	d := xml.NewDecoder(strings.NewReader("<r>" + chunk + "</r>"))
+	for {
+		if _, err := d.Token(); err == io.EOF {
+			return true
+		} else if err != nil {
+			return false
+		}
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	text := "甲甲甲甲甲甲甲甲若a<b且c>d则乙乙乙乙乙乙乙乙乙乙。<br>不是标签"
+	got := SplitText(text, 12)
+	want := []string{"甲甲甲甲甲甲甲甲若a<b", "且c>d则乙乙乙乙乙乙乙", "乙乙乙。<br>不是标签"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+	if strings.Join(got, "") != text {
+		t.Fatal("chunks should join to the original text")
+	}
+}
+
+func TestSplitLength(t *testing.T) {
+	text := strings.Repeat("这是一个测试句子，用来检查切分后的长度。", 50)
+	chunks := Split(text, 290)
+	if strings.Join(chunks, "") != text {
+		t.Fatal("chunks should join to the original text")
+	}
+	for _, c := range chunks {
+		if n := utf8.RuneCountInString(c); n > 290 {
+			t.Fatalf("chunk too long: %d", n)
+		}
+		if !strings.HasSuffix(c, "。") {
+			t.Fatalf("chunk should end at sentence: %q", c)
+		}
+	}
+}
+
+func TestSentences(t *testing.T) {
+	got := Sentences("第一句。“第二句！”第三句?  Last one. 3.14")
+	want := []string{"第一句。", "“第二句！”", "第三句?", "Last one.", "3.14"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	got = Sentences(`<emphasis>一句。二句。</emphasis>`)
+	want = []string{"<emphasis>一句。</emphasis>", "<emphasis>二句。</emphasis>"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
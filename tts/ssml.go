@@ -2,6 +2,8 @@ package tts
 
 import (
 	"strconv"
+
+	"github.com/jing332/tts-server-go/tts/ssml"
 )
 
 const (
@@ -19,30 +21,56 @@ type VoiceProperty struct {
 	*ExpressAs
 }
 
-// ElementString 转为Voice元素字符串
-func (v *VoiceProperty) ElementString(text string) string {
-	var element string
+// EngineApi 引擎对应的SSML格式, 未知的引擎使用Edge格式
+func EngineApi(engine string) int {
+	switch engine {
+	case EngineAzure:
+		return ApiAzure
+	case EngineCreation:
+		return ApiCreation
+	}
+	return ApiEdge
+}
+
+// NewVoiceProperty 使用默认语速、风格等参数的发音人
+func NewVoiceProperty(engine, voiceName string) *VoiceProperty {
+	return &VoiceProperty{Api: EngineApi(engine), VoiceName: voiceName, Prosody: &Prosody{}, ExpressAs: &ExpressAs{}}
+}
+
+// Node 转为voice元素, children 为朗读的内容
+func (v *VoiceProperty) Node(children ...ssml.Node) ssml.Node {
+	var content ssml.Node
 	if v.Api == ApiEdge {
-		element = v.Prosody.ElementString(text)
+		content = v.Prosody.Node(children...)
 	} else {
-		element = v.ExpressAs.ElementString(text, v.Prosody)
+		content = v.ExpressAs.Node(v.Prosody.Node(children...))
 	}
-	if v.SecondaryLocale == "" {
-		return `<voice name="` + v.VoiceName + `">` + element + `</voice>`
-	} else { // 二级语言标签
-		return `<voice name="` + v.VoiceName + `"><lang xml:lang="` + v.SecondaryLocale + `">` + element + `</lang></voice>`
+	if v.SecondaryLocale != "" { // 二级语言标签
+		content = &ssml.Lang{Lang: v.SecondaryLocale, Children: []ssml.Node{content}}
 	}
+	return &ssml.Voice{Name: v.VoiceName, Children: []ssml.Node{content}}
+}
+
+// ElementString 转为Voice元素字符串, text 不会被转义
+func (v *VoiceProperty) ElementString(text string) string {
+	return ssml.String(v.Node(ssml.Raw(text)))
 }
 
 type Prosody struct {
 	Rate, Volume, Pitch int8
 }
 
+// Node 转为prosody元素, 为nil时直接返回内容
+func (p *Prosody) Node(children ...ssml.Node) ssml.Node {
+	if p == nil {
+		return ssml.Fragment(children)
+	}
+	return &ssml.Prosody{Rate: strconv.Itoa(int(p.Rate)) + "%", Volume: strconv.Itoa(int(p.Volume)) + "%",
+		Pitch: strconv.Itoa(int(p.Pitch)) + "%", Children: children}
+}
+
 func (p *Prosody) ElementString(text string) string {
-	return `<prosody rate="` + strconv.Itoa(int(p.Rate)) +
-		`%" volume="` + strconv.Itoa(int(p.Volume)) +
-		`%" pitch="` + strconv.Itoa(int(p.Pitch)) +
-		`%">` + text + `</prosody>`
+	return ssml.String(p.Node(ssml.Raw(text)))
 }
 
 type ExpressAs struct {
@@ -51,17 +79,22 @@ type ExpressAs struct {
 	Role        string
 }
 
-func (e *ExpressAs) ElementString(text string, prosody *Prosody) string {
-	if e.Style == "" {
-		e.Style = "general"
-	}
-	if e.Role == "" {
-		e.Role = "default"
+// Node 转为mstts:express-as元素, 未设置的风格与角色使用 general 与 default
+func (e *ExpressAs) Node(children ...ssml.Node) ssml.Node {
+	style, role, degree := "general", "default", float32(0)
+	if e != nil {
+		if e.Style != "" {
+			style = e.Style
+		}
+		if e.Role != "" {
+			role = e.Role
+		}
+		degree = e.StyleDegree
 	}
+	return &ssml.ExpressAs{Style: style, StyleDegree: strconv.FormatFloat(float64(degree), 'f', 1, 32), Role: role,
+		Children: children}
+}
 
-	return `<mstts:express-as style="` + e.Style +
-		`" styledegree="` + strconv.FormatFloat(float64(e.StyleDegree), 'f', 1, 32) +
-		`" role="` + e.Role +
-		`">"` + prosody.ElementString(text) +
-		`</mstts:express-as>`
+func (e *ExpressAs) ElementString(text string, prosody *Prosody) string {
+	return ssml.String(e.Node(prosody.Node(ssml.Raw(text))))
 }
@@ -0,0 +1,139 @@
+package ssml
+
+import (
+	"regexp"
+	"strings"
+)
+
+// 代码块的处理方式
+const (
+	CodeSkip  = "skip"  // 跳过
+	CodeSpell = "spell" // 逐字符朗读
+	CodeRead  = "read"  // 按普通文本朗读
+)
+
+/* 各类块之后的停顿 */
+const (
+	headingBreak   = "700ms"
+	paragraphBreak = "400ms"
+	itemBreak      = "300ms"
+)
+
+// MarkdownOptions Markdown转换选项, 零值可用
+type MarkdownOptions struct {
+	Emphasis   bool   // 标题使用emphasis元素, 仅部分Azure发音人支持, 否则只使用停顿
+	CodeBlocks string // 代码块: CodeSkip(默认), CodeSpell, CodeRead
+}
+
+var (
+	headingRe   = regexp.MustCompile(`^#{1,6}\s+(.*?)\s*#*\s*$`)
+	ruleRe      = regexp.MustCompile(`^(\*\s*){3,}$|^(-\s*){3,}$|^(_\s*){3,}$`)
+	listRe      = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+(.*)$`)
+	quoteRe     = regexp.MustCompile(`^\s*(?:>\s?)+`)
+	tableSepRe  = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+	imageRe     = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	linkRe      = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	codeSpanRe  = regexp.MustCompile("`+([^`]+)`+")
+	strongRe    = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	emRe        = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+	strikeRe    = regexp.MustCompile(`~~(.+?)~~`)
+	htmlTagRe   = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	inlineRules = []struct {
+		re   *regexp.Regexp
+		repl string
+	}{{imageRe, "$1"}, {linkRe, "$1"}, {codeSpanRe, "$1"}, {strongRe, "$1$2"}, {emRe, "$1"}, {strikeRe, "$1"}, {htmlTagRe, ""}}
+)
+
+// FromText 纯文本转为SSML节点
+func FromText(text string) []Node {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	return []Node{Text(text)}
+}
+
+// FromMarkdown Markdown转为SSML节点: 段落、标题、列表之后添加停顿, 去除强调、链接等标记
+func FromMarkdown(md string, opts *MarkdownOptions) []Node {
+	if opts == nil {
+		opts = &MarkdownOptions{}
+	}
+
+	var nodes []Node
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			nodes = append(nodes, Text(strings.Join(paragraph, "\n")), &Break{Time: paragraphBreak})
+			paragraph = nil
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~"):
+			flush()
+			fence := line[:3]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			nodes = append(nodes, codeBlock(strings.Join(code, "\n"), opts.CodeBlocks)...)
+		case line == "":
+			flush()
+		case headingRe.MatchString(line):
+			flush()
+			var heading Node = Text(inline(headingRe.FindStringSubmatch(line)[1]))
+			if opts.Emphasis {
+				heading = &Emphasis{Level: "strong", Children: []Node{heading}}
+			}
+			nodes = append(nodes, heading, &Break{Time: headingBreak})
+		case ruleRe.MatchString(line):
+			flush()
+			nodes = append(nodes, &Break{Time: paragraphBreak})
+		case listRe.MatchString(line):
+			flush()
+			nodes = append(nodes, Text(inline(listRe.FindStringSubmatch(line)[1])), &Break{Time: itemBreak})
+		case tableSepRe.MatchString(line) && strings.Contains(line, "|"):
+		default:
+			line = quoteRe.ReplaceAllString(line, "")
+			if strings.HasPrefix(line, "|") { /* 表格行 */
+				line = strings.TrimSpace(strings.ReplaceAll(strings.Trim(line, "|"), "|", " "))
+			}
+			if line = inline(line); line != "" {
+				paragraph = append(paragraph, line)
+			}
+		}
+	}
+	flush()
+
+	/* 去除末尾的停顿 */
+	for len(nodes) > 0 {
+		if _, ok := nodes[len(nodes)-1].(*Break); !ok {
+			break
+		}
+		nodes = nodes[:len(nodes)-1]
+	}
+	return nodes
+}
+
+func codeBlock(code, mode string) []Node {
+	if strings.TrimSpace(code) == "" {
+		return nil
+	}
+	switch mode {
+	case CodeSpell:
+		return []Node{&SayAs{InterpretAs: "characters", Text: code}, &Break{Time: paragraphBreak}}
+	case CodeRead:
+		return []Node{Text(code), &Break{Time: paragraphBreak}}
+	}
+	return nil
+}
+
+/* 去除行内标记 */
+func inline(s string) string {
+	for _, r := range inlineRules {
+		s = r.re.ReplaceAllString(s, r.repl)
+	}
+	return strings.TrimSpace(s)
+}
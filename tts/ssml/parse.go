@@ -0,0 +1,331 @@
+package ssml
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// SyntaxError SSML格式错误, 行列从1开始
+type SyntaxError struct {
+	Line, Column int
+	Msg          string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("ssml: 第%d行第%d列: %s", e.Line, e.Column, e.Msg)
+}
+
+/* 除内置类型外允许的元素, mstts与emo命名空间的元素均允许 */
+var otherElements = map[string]bool{"p": true, "s": true, "lexicon": true, "math": true}
+
+/* 必需的属性 */
+var requiredAttrs = map[string]string{
+	"voice":            "name",
+	"lang":             "xml:lang",
+	"mstts:express-as": "style",
+	"say-as":           "interpret-as",
+	"phoneme":          "ph",
+	"sub":              "alias",
+	"audio":            "src",
+	"bookmark":         "mark",
+}
+
+type parser struct {
+	src string
+	d   *xml.Decoder
+}
+
+// Validate 校验SSML, 格式错误时返回 *SyntaxError
+func Validate(doc string) error {
+	_, err := Parse(doc)
+	return err
+}
+
+// WellFormed 只校验XML格式与<speak>根元素, 不限制元素与属性, 用于原样转发给上游的SSML。格式错误时返回 *SyntaxError
+func WellFormed(doc string) error {
+	p := &parser{src: doc, d: xml.NewDecoder(strings.NewReader(doc))}
+	depth, root := 0, false
+	for {
+		offset := p.d.InputOffset()
+		tok, err := p.d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return p.syntaxError(err, offset)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				if root {
+					return p.errorAt(offset, "根元素之后不能有其他元素")
+				}
+				if name := p.name(t.Name); name != "speak" {
+					return p.errorAt(offset, "根元素应为<speak>: <%s>", name)
+				}
+				root = true
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 0 && strings.TrimSpace(string(t)) != "" {
+				return p.errorAt(offset, "文本应在<speak>内")
+			}
+		}
+	}
+	if depth > 0 {
+		return p.errorAt(int64(len(doc)), "意外的结尾")
+	}
+	if !root {
+		return p.errorAt(int64(len(doc)), "缺少<speak>根元素")
+	}
+	return nil
+}
+
+// Parse 解析并校验SSML, 格式错误时返回 *SyntaxError
+func Parse(doc string) (*Speak, error) {
+	p := &parser{src: doc, d: xml.NewDecoder(strings.NewReader(doc))}
+	var root *Speak
+	for {
+		offset := p.d.InputOffset()
+		tok, err := p.d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, p.syntaxError(err, offset)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if root != nil {
+				return nil, p.errorAt(offset, "根元素之后不能有其他元素")
+			}
+			if name := p.name(t.Name); name != "speak" {
+				return nil, p.errorAt(offset, "根元素应为<speak>: <%s>", name)
+			}
+			root = &Speak{}
+			for _, a := range t.Attr {
+				if p.name(a.Name) == "xml:lang" {
+					root.Lang = a.Value
+				}
+			}
+			if root.Children, err = p.children(nil); err != nil {
+				return nil, err
+			}
+		case xml.CharData:
+			if strings.TrimSpace(string(t)) != "" {
+				return nil, p.errorAt(offset, "文本应在<speak>内")
+			}
+		}
+	}
+	if root == nil {
+		return nil, p.errorAt(int64(len(doc)), "缺少<speak>根元素")
+	}
+	return root, nil
+}
+
+/* 读取子节点直到当前元素结束, ancestors 为上级元素名称 */
+func (p *parser) children(ancestors []string) ([]Node, error) {
+	var nodes []Node
+	for {
+		offset := p.d.InputOffset()
+		tok, err := p.d.Token()
+		if err != nil {
+			return nil, p.syntaxError(err, offset)
+		}
+		switch t := tok.(type) {
+		case xml.EndElement:
+			return nodes, nil
+		case xml.CharData:
+			if prev, ok := lastText(nodes); ok { /* 被注释分隔的文本 */
+				nodes[len(nodes)-1] = prev + Text(t)
+			} else if len(t) > 0 {
+				nodes = append(nodes, Text(t))
+			}
+		case xml.StartElement:
+			n, err := p.element(t, offset, ancestors)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		}
+	}
+}
+
+func (p *parser) element(t xml.StartElement, offset int64, ancestors []string) (Node, error) {
+	name := p.name(t.Name)
+	attrs := make(map[string]string, len(t.Attr))
+	for _, a := range t.Attr {
+		attrs[p.name(a.Name)] = a.Value
+	}
+	if required, ok := requiredAttrs[name]; ok && attrs[required] == "" {
+		return nil, p.errorAt(offset, "<%s>缺少属性%s", name, required)
+	}
+	for _, a := range ancestors {
+		if a == name && (name == "voice" || name == "mstts:express-as") {
+			return nil, p.errorAt(offset, "<%s>不能嵌套", name)
+		}
+	}
+
+	var err error
+	children := func() []Node {
+		var nodes []Node
+		if err == nil {
+			nodes, err = p.children(append(ancestors, name))
+		}
+		return nodes
+	}
+
+	var n Node
+	switch name {
+	case "speak":
+		return nil, p.errorAt(offset, "<speak>只能作为根元素")
+	case "voice":
+		n = &Voice{Name: attrs["name"], Children: children()}
+	case "lang":
+		n = &Lang{Lang: attrs["xml:lang"], Children: children()}
+	case "prosody":
+		n = &Prosody{Rate: attrs["rate"], Volume: attrs["volume"], Pitch: attrs["pitch"], Contour: attrs["contour"], Range: attrs["range"],
+			Children: children()}
+	case "mstts:express-as":
+		n = &ExpressAs{Style: attrs["style"], StyleDegree: attrs["styledegree"], Role: attrs["role"], Children: children()}
+	case "emphasis":
+		if !oneOf(attrs["level"], "", "strong", "moderate", "none", "reduced") {
+			return nil, p.errorAt(offset, "无效的emphasis level: %q", attrs["level"])
+		}
+		n = &Emphasis{Level: attrs["level"], Children: children()}
+	case "audio":
+		n = &Audio{Src: attrs["src"], Children: children()}
+	case "break":
+		if !oneOf(attrs["strength"], "", "x-weak", "weak", "medium", "strong", "x-strong") {
+			return nil, p.errorAt(offset, "无效的break strength: %q", attrs["strength"])
+		}
+		err = p.empty(name, offset)
+		n = &Break{Time: attrs["time"], Strength: attrs["strength"]}
+	case "bookmark":
+		err = p.empty(name, offset)
+		n = &Bookmark{Mark: attrs["mark"]}
+	case "say-as":
+		var text string
+		text, err = p.text(name)
+		n = &SayAs{InterpretAs: attrs["interpret-as"], Format: attrs["format"], Detail: attrs["detail"], Text: text}
+	case "phoneme":
+		var text string
+		text, err = p.text(name)
+		n = &Phoneme{Alphabet: attrs["alphabet"], Ph: attrs["ph"], Text: text}
+	case "sub":
+		var text string
+		text, err = p.text(name)
+		n = &Sub{Alias: attrs["alias"], Text: text}
+	default:
+		if !otherElements[name] && !strings.HasPrefix(name, "mstts:") && !strings.HasPrefix(name, "emo:") {
+			return nil, p.errorAt(offset, "不支持的元素<%s>", name)
+		}
+		e := &Element{Name: name}
+		for _, a := range t.Attr {
+			if a.Name.Space != "xmlns" && a.Name.Local != "xmlns" {
+				e.Attrs = append(e.Attrs, Attr{Name: p.name(a.Name), Value: a.Value})
+			}
+		}
+		e.Children = children()
+		n = e
+	}
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+/* 只能包含文本的元素 */
+func (p *parser) text(name string) (string, error) {
+	var sb strings.Builder
+	for {
+		offset := p.d.InputOffset()
+		tok, err := p.d.Token()
+		if err != nil {
+			return "", p.syntaxError(err, offset)
+		}
+		switch t := tok.(type) {
+		case xml.EndElement:
+			return sb.String(), nil
+		case xml.CharData:
+			sb.Write(t)
+		case xml.StartElement:
+			return "", p.errorAt(offset, "<%s>只能包含文本", name)
+		}
+	}
+}
+
+/* 不能包含内容的元素, offset 为元素的起始位置 */
+func (p *parser) empty(name string, offset int64) error {
+	text, err := p.text(name)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(text) != "" {
+		return p.errorAt(offset, "<%s>不能包含内容", name)
+	}
+	return nil
+}
+
+/* 带前缀的名称, 如 mstts:express-as, xml:lang */
+func (p *parser) name(n xml.Name) string {
+	switch n.Space {
+	case "", NamespaceSynthesis:
+		return n.Local
+	case NamespaceMstts, "mstts":
+		return "mstts:" + n.Local
+	case NamespaceEmo, "emo":
+		return "emo:" + n.Local
+	case NamespaceXml, "xml":
+		return "xml:" + n.Local
+	}
+	return n.Space + ":" + n.Local
+}
+
+/* XML格式错误, offset 为出错的节点起始位置 */
+func (p *parser) syntaxError(err error, offset int64) error {
+	var xmlErr *xml.SyntaxError
+	if errors.As(err, &xmlErr) {
+		return p.errorAt(offset, "%s", xmlErr.Msg)
+	}
+	if err == io.EOF {
+		return p.errorAt(offset, "意外的结尾")
+	}
+	return p.errorAt(offset, "%v", err)
+}
+
+/* 根据字节偏移计算行列 */
+func (p *parser) errorAt(offset int64, format string, args ...any) error {
+	if offset > int64(len(p.src)) {
+		offset = int64(len(p.src))
+	}
+	before := p.src[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:]) + 1
+	return &SyntaxError{Line: line, Column: column, Msg: fmt.Sprintf(format, args...)}
+}
+
+func lastText(nodes []Node) (Text, bool) {
+	if len(nodes) == 0 {
+		return "", false
+	}
+	t, ok := nodes[len(nodes)-1].(Text)
+	return t, ok
+}
+
+func oneOf(s string, values ...string) bool {
+	for _, v := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
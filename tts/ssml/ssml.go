@@ -0,0 +1,296 @@
+// Package ssml SSML文档模型, 序列化时对文本与属性进行XML转义
+package ssml
+
+import (
+	"strings"
+)
+
+// 命名空间
+const (
+	NamespaceSynthesis = "http://www.w3.org/2001/10/synthesis"
+	NamespaceMstts     = "http://www.w3.org/2001/mstts"
+	NamespaceEmo       = "http://www.w3.org/2009/10/emotionml"
+	NamespaceXml       = "http://www.w3.org/XML/1998/namespace"
+)
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;")
+)
+
+// Node SSML节点
+type Node interface {
+	render(b *strings.Builder)
+}
+
+// String 序列化节点
+func String(nodes ...Node) string {
+	var b strings.Builder
+	renderAll(&b, nodes)
+	return b.String()
+}
+
+func renderAll(b *strings.Builder, nodes []Node) {
+	for _, n := range nodes {
+		if n != nil {
+			n.render(b)
+		}
+	}
+}
+
+/* 写入元素, 值为空的属性被忽略, attrs 为 名称,值 交替 */
+func element(b *strings.Builder, name string, children []Node, attrs ...string) {
+	b.WriteString("<" + name)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i+1] != "" {
+			b.WriteString(" " + attrs[i] + `="`)
+			attrEscaper.WriteString(b, attrs[i+1])
+			b.WriteByte('"')
+		}
+	}
+	if len(children) == 0 {
+		b.WriteString("/>")
+		return
+	}
+	b.WriteByte('>')
+	renderAll(b, children)
+	b.WriteString("</" + name + ">")
+}
+
+// Text 文本, 序列化时转义
+type Text string
+
+func (t Text) render(b *strings.Builder) {
+	textEscaper.WriteString(b, string(t))
+}
+
+// Raw 原样输出, 不转义, 用于已转义的文本或模板变量
+type Raw string
+
+func (r Raw) render(b *strings.Builder) {
+	b.WriteString(string(r))
+}
+
+// Fragment 依次输出多个节点, 不包含元素本身
+type Fragment []Node
+
+func (f Fragment) render(b *strings.Builder) {
+	renderAll(b, f)
+}
+
+// Speak 根元素
+type Speak struct {
+	Lang     string // xml:lang, 默认 en-US
+	Children []Node
+}
+
+func (s *Speak) render(b *strings.Builder) {
+	lang := s.Lang
+	if lang == "" {
+		lang = "en-US"
+	}
+	b.WriteString(`<speak xmlns="` + NamespaceSynthesis + `" xmlns:mstts="` + NamespaceMstts + `" xmlns:emo="` + NamespaceEmo +
+		`" version="1.0" xml:lang="`)
+	attrEscaper.WriteString(b, lang)
+	b.WriteString(`">`)
+	renderAll(b, s.Children)
+	b.WriteString("</speak>")
+}
+
+// String 完整的SSML文档
+func (s *Speak) String() string {
+	return String(s)
+}
+
+// Voice 发音人
+type Voice struct {
+	Name     string
+	Children []Node
+}
+
+func (v *Voice) render(b *strings.Builder) {
+	element(b, "voice", v.Children, "name", v.Name)
+}
+
+// Lang 多语言发音人的二级语言
+type Lang struct {
+	Lang     string
+	Children []Node
+}
+
+func (l *Lang) render(b *strings.Builder) {
+	element(b, "lang", l.Children, "xml:lang", l.Lang)
+}
+
+// Prosody 语速、音量、音调, 如 Rate: "+10%", Pitch: "+0Hz"
+type Prosody struct {
+	Rate, Volume, Pitch, Contour, Range string
+	Children                            []Node
+}
+
+func (p *Prosody) render(b *strings.Builder) {
+	element(b, "prosody", p.Children, "rate", p.Rate, "volume", p.Volume, "pitch", p.Pitch, "contour", p.Contour, "range", p.Range)
+}
+
+// ExpressAs 说话风格与角色 (mstts:express-as)
+type ExpressAs struct {
+	Style, StyleDegree, Role string
+	Children                 []Node
+}
+
+func (e *ExpressAs) render(b *strings.Builder) {
+	element(b, "mstts:express-as", e.Children, "style", e.Style, "styledegree", e.StyleDegree, "role", e.Role)
+}
+
+// Break 停顿, Time 如 "500ms", Strength 为 x-weak, weak, medium, strong, x-strong
+type Break struct {
+	Time, Strength string
+}
+
+func (br *Break) render(b *strings.Builder) {
+	element(b, "break", nil, "time", br.Time, "strength", br.Strength)
+}
+
+// SayAs 指定文本类型, 如 InterpretAs: "date", Format: "ymd"
+type SayAs struct {
+	InterpretAs, Format, Detail string
+	Text                        string
+}
+
+func (s *SayAs) render(b *strings.Builder) {
+	element(b, "say-as", textChildren(s.Text), "interpret-as", s.InterpretAs, "format", s.Format, "detail", s.Detail)
+}
+
+// Phoneme 音标, Alphabet 为 ipa, sapi, ups, x-microsoft-pinyin 等
+type Phoneme struct {
+	Alphabet, Ph string
+	Text         string
+}
+
+func (p *Phoneme) render(b *strings.Builder) {
+	element(b, "phoneme", textChildren(p.Text), "alphabet", p.Alphabet, "ph", p.Ph)
+}
+
+// Sub 使用别名朗读文本
+type Sub struct {
+	Alias string
+	Text  string
+}
+
+func (s *Sub) render(b *strings.Builder) {
+	element(b, "sub", textChildren(s.Text), "alias", s.Alias)
+}
+
+// Emphasis 重读, Level 为 strong, moderate, none, reduced
+type Emphasis struct {
+	Level    string
+	Children []Node
+}
+
+func (e *Emphasis) render(b *strings.Builder) {
+	element(b, "emphasis", e.Children, "level", e.Level)
+}
+
+// Audio 插入音频, 无法加载时朗读 Children
+type Audio struct {
+	Src      string
+	Children []Node
+}
+
+func (a *Audio) render(b *strings.Builder) {
+	element(b, "audio", a.Children, "src", a.Src)
+}
+
+// Bookmark 书签
+type Bookmark struct {
+	Mark string
+}
+
+func (bm *Bookmark) render(b *strings.Builder) {
+	element(b, "bookmark", nil, "mark", bm.Mark)
+}
+
+// Attr 元素属性
+type Attr struct {
+	Name, Value string
+}
+
+// Element 其他元素, 如 p, s, mstts:silence
+type Element struct {
+	Name     string // 带前缀的名称, 如 mstts:silence
+	Attrs    []Attr
+	Children []Node
+}
+
+func (e *Element) render(b *strings.Builder) {
+	attrs := make([]string, 0, len(e.Attrs)*2)
+	for _, a := range e.Attrs {
+		attrs = append(attrs, a.Name, a.Value)
+	}
+	element(b, e.Name, e.Children, attrs...)
+}
+
+func textChildren(text string) []Node {
+	if text == "" {
+		return nil
+	}
+	return []Node{Text(text)}
+}
+
+/* 容器元素的子节点, 其他节点返回nil */
+func childrenOf(n Node) *[]Node {
+	switch t := n.(type) {
+	case *Speak:
+		return &t.Children
+	case *Voice:
+		return &t.Children
+	case *Lang:
+		return &t.Children
+	case *Prosody:
+		return &t.Children
+	case *ExpressAs:
+		return &t.Children
+	case *Emphasis:
+		return &t.Children
+	case *Audio:
+		return &t.Children
+	case *Element:
+		return &t.Children
+	}
+	return nil
+}
+
+// Map 递归替换节点, 先处理子节点再处理元素本身, f 返回nil时删除节点。容器元素会被直接修改
+func Map(nodes []Node, f func(Node) Node) []Node {
+	result := make([]Node, 0, len(nodes))
+	for _, n := range nodes {
+		if fragment, ok := n.(Fragment); ok {
+			n = Fragment(Map(fragment, f))
+		} else if children := childrenOf(n); children != nil {
+			*children = Map(*children, f)
+		}
+		if n = f(n); n != nil {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// PlainText 节点中的纯文本, sub使用原文本, 不包含Raw
+func PlainText(nodes ...Node) string {
+	var b strings.Builder
+	Map(nodes, func(n Node) Node {
+		switch t := n.(type) {
+		case Text:
+			b.WriteString(string(t))
+		case *SayAs:
+			b.WriteString(t.Text)
+		case *Phoneme:
+			b.WriteString(t.Text)
+		case *Sub:
+			b.WriteString(t.Text)
+		}
+		return n
+	})
+	return b.String()
+}
@@ -0,0 +1,192 @@
+package ssml
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	doc := &Speak{Lang: "zh-CN", Children: []Node{
+		&Voice{Name: "zh-CN-XiaoxiaoNeural", Children: []Node{
+			&ExpressAs{Style: "cheerful", Children: []Node{
+				&Prosody{Rate: "+10%", Children: []Node{Text(`"A&B" <1>`)}},
+			}},
+			&Break{Time: "500ms"},
+			&SayAs{InterpretAs: "date", Format: "ymd", Text: "2022-08-01"},
+			&Phoneme{Alphabet: "sapi", Ph: "chong 2", Text: "重"},
+			&Sub{Alias: "World Wide Web", Text: "WWW"},
+			&Emphasis{Level: "strong", Children: []Node{Text("好")}},
+			&Audio{Src: "https://example.com/a.mp3?a=1&b=2"},
+			&Bookmark{Mark: "m'1"},
+			&Element{Name: "mstts:silence", Attrs: []Attr{{"type", "Sentenceboundary"}, {"value", "200ms"}}},
+		}},
+	}}
+
+	want := `<speak xmlns="http://www.w3.org/2001/10/synthesis" xmlns:mstts="http://www.w3.org/2001/mstts" xmlns:emo="http://www.w3.org/2009/10/emotionml" version="1.0" xml:lang="zh-CN">` +
+		`<voice name="zh-CN-XiaoxiaoNeural"><mstts:express-as style="cheerful"><prosody rate="+10%">"A&amp;B" &lt;1&gt;</prosody></mstts:express-as>` +
+		`<break time="500ms"/><say-as interpret-as="date" format="ymd">2022-08-01</say-as><phoneme alphabet="sapi" ph="chong 2">重</phoneme>` +
+		`<sub alias="World Wide Web">WWW</sub><emphasis level="strong">好</emphasis><audio src="https://example.com/a.mp3?a=1&amp;b=2"/>` +
+		`<bookmark mark="m&apos;1"/><mstts:silence type="Sentenceboundary" value="200ms"/></voice></speak>`
+	if s := doc.String(); s != want {
+		t.Fatal(s)
+	}
+
+	/* 解析后重新序列化结果不变 */
+	parsed, err := Parse(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := parsed.String(); s != want {
+		t.Fatal(s)
+	}
+}
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(`<?xml version="1.0"?>
+<speak version="1.0" xml:lang="en-US">
+	<!-- 注释 -->
+	<voice name="en-US-JennyNeural"><mstts:express-as style="sad">Hi <break/></mstts:express-as></voice>
+</speak>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Lang != "en-US" || len(doc.Children) != 3 {
+		t.Fatalf("%+v", doc)
+	}
+	voice, ok := doc.Children[1].(*Voice)
+	if !ok || voice.Name != "en-US-JennyNeural" {
+		t.Fatalf("%#v", doc.Children[1])
+	}
+	if e, ok := voice.Children[0].(*ExpressAs); !ok || e.Style != "sad" || len(e.Children) != 2 {
+		t.Fatalf("%#v", voice.Children[0])
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		doc          string
+		line, column int
+		msg          string
+	}{
+		{`<speak><voice name="a">你好</speak>`, 1, 26, "closed by"},
+		{"<speak>\n  <voice>你好</voice></speak>", 2, 3, "缺少属性name"},
+		{"<speak><voice name=\"a\">\n<break>停顿</break></voice></speak>", 2, 1, "不能包含内容"},
+		{`<speak><voice name="a"><voice name="b"/></voice></speak>`, 1, 24, "不能嵌套"},
+		{`<speak><sub alias="a"><break/></sub></speak>`, 1, 23, "只能包含文本"},
+		{`<speak><foo/></speak>`, 1, 8, "不支持的元素<foo>"},
+		{`<speak><emphasis level="loud">a</emphasis></speak>`, 1, 8, "emphasis level"},
+		{`<voice name="a"/>`, 1, 1, "根元素应为<speak>"},
+		{`<speak/><speak/>`, 1, 9, "根元素之后"},
+		{`你好`, 1, 1, "文本应在<speak>内"},
+		{``, 1, 1, "缺少<speak>根元素"},
+		{`<speak>&nbsp;</speak>`, 1, 8, "entity"},
+		{`<speak><voice name="a">`, 1, 24, "EOF"},
+	}
+	for _, tt := range tests {
+		err := Validate(tt.doc)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Fatalf("%s: %v", tt.doc, err)
+		}
+		if syntaxErr.Line != tt.line || syntaxErr.Column != tt.column || !strings.Contains(syntaxErr.Msg, tt.msg) {
+			t.Fatalf("%s: %v", tt.doc, err)
+		}
+	}
+
+	for _, doc := range []string{
+		`<speak/>`,
+		`<speak><p><s>句子</s></p><mstts:silence type="Leading" value="1s"/></speak>`,
+		`<speak xmlns:mstts="http://www.w3.org/2001/mstts"><voice name="a"><lang xml:lang="en-US">hi</lang></voice></speak>`,
+	} {
+		if err := Validate(doc); err != nil {
+			t.Fatalf("%s: %v", doc, err)
+		}
+	}
+}
+
+func TestWellFormed(t *testing.T) {
+	tests := []struct {
+		doc          string
+		line, column int
+		msg          string
+	}{
+		{`<speak><voice name="a">你好</speak>`, 1, 26, "closed by"},
+		{"<speak>\n</voice></speak>", 2, 1, "closed by"},
+		{`<voice name="a"/>`, 1, 1, "根元素应为<speak>"},
+		{`<speak/><speak/>`, 1, 9, "根元素之后"},
+		{`你好`, 1, 1, "文本应在<speak>内"},
+		{``, 1, 1, "缺少<speak>根元素"},
+		{`<speak><voice name="a">`, 1, 24, "EOF"},
+	}
+	for _, tt := range tests {
+		err := WellFormed(tt.doc)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Fatalf("%s: %v", tt.doc, err)
+		}
+		if syntaxErr.Line != tt.line || syntaxErr.Column != tt.column || !strings.Contains(syntaxErr.Msg, tt.msg) {
+			t.Fatalf("%s: %v", tt.doc, err)
+		}
+	}
+
+	/* 不限制元素与属性 */
+	for _, doc := range []string{
+		`<?xml version="1.0"?><!-- 注释 --><speak><foo/></speak>`,
+		`<speak><voice><bookmark/><break>停顿</break></voice></speak>`,
+		`<speak xmlns:mstts="http://www.w3.org/2001/mstts"><mstts:silence type="Sentenceboundary-exact" value="1s"/></speak>`,
+	} {
+		if err := WellFormed(doc); err != nil {
+			t.Fatalf("%s: %v", doc, err)
+		}
+	}
+}
+
+func TestFromMarkdown(t *testing.T) {
+	md := "# 第一章 *开始*\n\n这是**第一段**，包含[链接](https://example.com)和`代码`。\n第二行 & 结束\n\n" +
+		"- 列表一\n2. 列表二\n\n> 引用\n\n---\n```go\nfmt.Println(1)\n```\n\n| 名称 | 值 |\n|---|---:|\n| a | 1 |\n"
+
+	want := `第一章 开始<break time="700ms"/>这是第一段，包含链接和代码。` + "\n" + `第二行 &amp; 结束<break time="400ms"/>` +
+		`列表一<break time="300ms"/>列表二<break time="300ms"/>引用<break time="400ms"/><break time="400ms"/>` +
+		`名称   值` + "\n" + `a   1`
+	if s := String(FromMarkdown(md, nil)...); s != want {
+		t.Fatal(s)
+	}
+
+	s := String(FromMarkdown(md, &MarkdownOptions{Emphasis: true, CodeBlocks: CodeSpell})...)
+	if !strings.HasPrefix(s, `<emphasis level="strong">第一章 开始</emphasis>`) ||
+		!strings.Contains(s, `<say-as interpret-as="characters">fmt.Println(1)</say-as>`) {
+		t.Fatal(s)
+	}
+
+	if nodes := FromMarkdown("```\ncode\n```\n\n", nil); len(nodes) != 0 {
+		t.Fatalf("%#v", nodes)
+	}
+}
+
+func TestMap(t *testing.T) {
+	doc, err := Parse(`<speak><voice name="a"><mstts:express-as style="sad"><prosody rate="10%">你好<break/><sub alias="万维网">WWW</sub></prosody></mstts:express-as></voice><voice name="b">再见</voice></speak>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := PlainText(doc); s != "你好WWW再见" {
+		t.Fatal(s)
+	}
+
+	/* 替换发音人并去除express-as */
+	doc.Children = Map(doc.Children, func(n Node) Node {
+		switch t := n.(type) {
+		case *Voice:
+			t.Name += "1"
+		case *ExpressAs:
+			return Fragment(t.Children)
+		case *Break:
+			return nil
+		}
+		return n
+	})
+	want := `<voice name="a1"><prosody rate="10%">你好<sub alias="万维网">WWW</sub></prosody></voice><voice name="b1">再见</voice>`
+	if s := String(doc.Children...); s != want {
+		t.Fatal(s)
+	}
+}
@@ -10,10 +10,16 @@ func TestSsml(t *testing.T) {
 		Prosody:   &Prosody{Rate: 0, Pitch: 0, Volume: 0},
 		ExpressAs: &ExpressAs{Style: "angry", StyleDegree: 1.5, Role: "body"}}
 	ssml := pro.ElementString("测试文本")
-	t.Log(ssml)
+	want := `<voice name="zh-CN-XiaoxiaoNeural"><lang xml:lang="en-US"><mstts:express-as style="angry" styledegree="1.5" role="body">` +
+		`<prosody rate="0%" volume="0%" pitch="0%">测试文本</prosody></mstts:express-as></lang></voice>`
+	if ssml != want {
+		t.Fatal(ssml)
+	}
 }
 
 func TestProsody(t *testing.T) {
-	p := Prosody{Rate: 0, Volume: 0, Pitch: 0}
-	t.Log(p.ElementString("测试文本"))
+	p := Prosody{Rate: 10, Volume: 0, Pitch: -5}
+	if s := p.ElementString("测试文本"); s != `<prosody rate="10%" volume="0%" pitch="-5%">测试文本</prosody>` {
+		t.Fatal(s)
+	}
 }
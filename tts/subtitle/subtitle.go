@@ -0,0 +1,121 @@
+package subtitle
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jing332/tts-server-go/tts"
+)
+
+// 字幕格式
+const (
+	FormatSrt  = "srt"
+	FormatVtt  = "vtt"
+	FormatJson = "json"
+)
+
+const (
+	maxCueRunes    = 24              /* 单条字幕最大字数 */
+	maxCueDuration = time.Second * 5 /* 单条字幕最长时间 */
+)
+
+// Cue 一条字幕
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// Cues 根据边界事件生成字幕。有句子边界时一句一条，否则按标点与长度合并单词
+func Cues(boundaries []tts.Boundary) []Cue {
+	var cues []Cue
+	for _, b := range boundaries {
+		if b.Type == tts.SentenceBoundary {
+			cues = append(cues, Cue{Start: b.Offset, End: b.Offset + b.Duration, Text: strings.TrimSpace(b.Text)})
+		}
+	}
+	if len(cues) > 0 {
+		return cues
+	}
+
+	var cue *Cue
+	for _, b := range boundaries {
+		if b.Type != tts.WordBoundary {
+			continue
+		}
+		if cue == nil {
+			cues = append(cues, Cue{Start: b.Offset})
+			cue = &cues[len(cues)-1]
+		}
+		cue.Text = joinWord(cue.Text, b.Text)
+		cue.End = b.Offset + b.Duration
+		if endsSentence(b.Text) || utf8.RuneCountInString(cue.Text) >= maxCueRunes || cue.End-cue.Start >= maxCueDuration {
+			cue = nil
+		}
+	}
+	return cues
+}
+
+/* 拉丁字母之间需补空格, 中文直接拼接 */
+func joinWord(s, word string) string {
+	if s == "" {
+		return word
+	}
+	last, _ := utf8.DecodeLastRuneInString(s)
+	first, _ := utf8.DecodeRuneInString(word)
+	if last < utf8.RuneSelf && first < utf8.RuneSelf && !unicode.IsPunct(first) && !unicode.IsSpace(last) {
+		return s + " " + word
+	}
+	return s + word
+}
+
+func endsSentence(s string) bool {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return strings.ContainsRune("。！？；…!?;.", r)
+}
+
+// Srt 转为SRT字幕
+func Srt(cues []Cue) string {
+	var sb strings.Builder
+	for i, c := range cues {
+		sb.WriteString(strconv.Itoa(i + 1))
+		sb.WriteString("\n")
+		sb.WriteString(timestamp(c.Start, ",") + " --> " + timestamp(c.End, ","))
+		sb.WriteString("\n" + c.Text + "\n\n")
+	}
+	return sb.String()
+}
+
+// Vtt 转为WebVTT字幕
+func Vtt(cues []Cue) string {
+	var sb strings.Builder
+	sb.WriteString("WEBVTT\n\n")
+	for _, c := range cues {
+		sb.WriteString(timestamp(c.Start, ".") + " --> " + timestamp(c.End, "."))
+		sb.WriteString("\n" + c.Text + "\n\n")
+	}
+	return sb.String()
+}
+
+// ContentType 字幕格式对应的Content-Type
+func ContentType(format string) string {
+	switch format {
+	case FormatSrt:
+		return "application/x-subrip; charset=utf-8"
+	case FormatVtt:
+		return "text/vtt; charset=utf-8"
+	case FormatJson:
+		return "application/json; charset=utf-8"
+	}
+	return ""
+}
+
+/* 00:00:01,000 */
+func timestamp(d time.Duration, sep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
@@ -0,0 +1,55 @@
+package subtitle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jing332/tts-server-go/tts"
+)
+
+func word(text string, offset, duration int) tts.Boundary {
+	return tts.Boundary{Type: tts.WordBoundary, Text: text,
+		Offset: time.Duration(offset) * time.Millisecond, Duration: time.Duration(duration) * time.Millisecond}
+}
+
+func TestCuesFromWords(t *testing.T) {
+	cues := Cues([]tts.Boundary{
+		word("Hello", 100, 400), word("world", 500, 400), word(".", 900, 50),
+		word("你好", 1500, 300), word("世界", 1800, 300),
+	})
+	if len(cues) != 2 {
+		t.Fatalf("cues: %+v", cues)
+	}
+	if cues[0].Text != "Hello world." || cues[0].Start != 100*time.Millisecond || cues[0].End != 950*time.Millisecond {
+		t.Fatalf("cue 0: %+v", cues[0])
+	}
+	if cues[1].Text != "你好世界" {
+		t.Fatalf("cue 1: %+v", cues[1])
+	}
+}
+
+func TestCuesPreferSentence(t *testing.T) {
+	cues := Cues([]tts.Boundary{
+		word("你好", 0, 300),
+		{Type: tts.SentenceBoundary, Text: "你好。", Offset: 0, Duration: time.Second},
+	})
+	if len(cues) != 1 || cues[0].Text != "你好。" || cues[0].End != time.Second {
+		t.Fatalf("cues: %+v", cues)
+	}
+}
+
+func TestSrt(t *testing.T) {
+	cues := []Cue{{Start: 1500 * time.Millisecond, End: time.Hour + 2*time.Second, Text: "测试"}}
+	want := "1\n00:00:01,500 --> 01:00:02,000\n测试\n\n"
+	if got := Srt(cues); got != want {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestVtt(t *testing.T) {
+	cues := []Cue{{Start: 0, End: 61 * time.Second, Text: "test"}}
+	want := "WEBVTT\n\n00:00:00.000 --> 00:01:01.000\ntest\n\n"
+	if got := Vtt(cues); got != want {
+		t.Fatalf("got %q", got)
+	}
+}
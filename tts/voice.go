@@ -0,0 +1,38 @@
+package tts
+
+import (
+	"context"
+	"strings"
+)
+
+// Voice 统一格式的发音人
+type Voice struct {
+	Engine           string   `json:"engine"`
+	Id               string   `json:"id"` // 发音人ID, Creation接口合成时使用, 其余引擎与ShortName相同
+	Name             string   `json:"name"`
+	ShortName        string   `json:"shortName"` // 如 zh-CN-XiaoxiaoNeural
+	DisplayName      string   `json:"displayName"`
+	LocalName        string   `json:"localName"` // 本地化名称, 如 晓晓
+	Locale           string   `json:"locale"`
+	LocaleName       string   `json:"localeName"`
+	Gender           string   `json:"gender"` // Female, Male
+	Styles           []string `json:"styles,omitempty"`
+	Roles            []string `json:"roles,omitempty"`
+	SecondaryLocales []string `json:"secondaryLocales,omitempty"`
+}
+
+// RawVoicesEngine 可获取上游原始发音人列表的引擎, 用于兼容旧版网页
+type RawVoicesEngine interface {
+	RawVoices(ctx context.Context) ([]byte, error)
+}
+
+// SplitList 分割以逗号分隔的列表, 去除空项
+func SplitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}